@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/aeolyus/1brc/brc"
+)
+
+// annotate streams the lines of an input through in order, appending the
+// final mean temperature of each line's station as a third field, e.g.
+// Hamburg;12.0;13.4. The means come from the output of a prior run over the
+// input, or else from a first pass over it.
+func annotate(args []string) error {
+	fs := flag.NewFlagSet("annotate", flag.ExitOnError)
+	input := fs.String("input", "", "input file path, or - for stdin")
+	aggregate := fs.String(
+		"aggregate", "",
+		"output of a prior run to take the means from, instead of a first "+
+			"pass over the input",
+	)
+	out := fs.String("out", "", "output file path (default stdout)")
+	registerAliases(fs, map[string]string{"i": "input", "o": "out"})
+	fs.Parse(args)
+	if *input == "" || *input == stdinInput && *aggregate == "" {
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+
+	var means map[string]float64
+	var err error
+	if *aggregate != "" {
+		means, err = loadMeans(*aggregate)
+	} else {
+		means, err = computeMeans(*input)
+	}
+	if err != nil {
+		return err
+	}
+
+	r, err := openDecoded(*input)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	var w io.Writer = os.Stdout
+	if *out != "" && *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("could not create output file: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	return annotateLines(r, w, means)
+}
+
+// loadMeans reads the means of the stations from the output of a prior run
+func loadMeans(fpath string) (map[string]float64, error) {
+	text, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read aggregate: %w", err)
+	}
+	var rs brc.Results
+	if err := rs.UnmarshalText(text); err != nil {
+		return nil, fmt.Errorf("could not read aggregate: %w", err)
+	}
+	means := make(map[string]float64, len(rs))
+	for _, r := range rs {
+		means[r.Station] = r.Mean
+	}
+	return means, nil
+}
+
+// computeMeans aggregates the input to find the means of its stations
+func computeMeans(fpath string) (map[string]float64, error) {
+	ss, err := readStats(context.Background(), fpath, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing statistics: %w", err)
+	}
+	means := make(map[string]float64, len(ss.stats))
+	for station, v := range ss.stats {
+		means[station] = mean(v)
+	}
+	return means, nil
+}
+
+// annotateLines copies lines from r to w, appending the mean of the station of
+// each. Every line must be of a station with a mean, so that the annotated
+// lines all have the same fields.
+func annotateLines(r io.Reader, w io.Writer, means map[string]float64) error {
+	br := bufio.NewReaderSize(r, chunkSize)
+	bw := bufio.NewWriterSize(w, chunkSize)
+	var annotated []byte
+	for {
+		line, err := br.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			return errors.New("line longer than the chunk size")
+		}
+		if len(line) > 0 {
+			line = bytes.TrimSuffix(line, []byte{'\n'})
+			i := bytes.IndexByte(line, ';')
+			if i < 0 {
+				return fmt.Errorf("malformed line %q", line)
+			}
+			mean, ok := means[string(line[:i])]
+			if !ok {
+				return fmt.Errorf("station %q has no mean", line[:i])
+			}
+			annotated = append(annotated[:0], line...)
+			annotated = append(annotated, ';')
+			annotated = strconv.AppendFloat(annotated, mean, 'f', 1, 64)
+			annotated = append(annotated, '\n')
+			if _, err := bw.Write(annotated); err != nil {
+				return fmt.Errorf("could not write output: %w", err)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading file: %w", err)
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("could not write output: %w", err)
+	}
+	return nil
+}
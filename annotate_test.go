@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnnotateLines(t *testing.T) {
+	means := map[string]float64{"Oslo": -1, "St. John's": 12.35}
+	var out strings.Builder
+	require.NoError(t, annotateLines(
+		strings.NewReader("Oslo;-3.0\nSt. John's;12.3\nOslo;1.0"), &out, means,
+	))
+	assert.Equal(t, "Oslo;-3.0;-1.0\nSt. John's;12.3;12.3\nOslo;1.0;-1.0\n", out.String())
+
+	err := annotateLines(strings.NewReader("Oslo;1.0\nRome;2.0\n"), &out, means)
+	assert.ErrorContains(t, err, `station "Rome" has no mean`)
+	err = annotateLines(strings.NewReader("Oslo 1.0\n"), &out, means)
+	assert.ErrorContains(t, err, "malformed line")
+}
+
+func TestAnnotateMeans(t *testing.T) {
+	// A first pass over the input finds the same means as its output has
+	inputFiles, err := findFiles(sampleInputDir, sampleInputExt)
+	require.NoError(t, err)
+	for _, file := range inputFiles {
+		computed, err := computeMeans(file + sampleInputExt)
+		require.NoError(t, err, file)
+		loaded, err := loadMeans(file + sampleOutputExt)
+		require.NoError(t, err, file)
+		assert.Equal(t, loaded, computed, file)
+	}
+}
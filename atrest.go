@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// atRestKeyEnv is the environment variable an at rest key may be given in
+// instead of -key-file, so that it appears neither on the command line nor in
+// -report
+const atRestKeyEnv = "BRC_AT_REST_KEY"
+
+// atRestKeySize is the size of the AES-256 keys files are encrypted with
+const atRestKeySize = 32
+
+// atRestKey is the key spill files and the state are encrypted with, or nil to
+// write them in the clear. It is resolved before the run starts.
+var atRestKey []byte
+
+// loadAtRestKey returns the key in the -key-file file if given, else in the
+// environment, or nil if there is none. Keys are 32 bytes, raw or in hex or
+// base64.
+func loadAtRestKey() ([]byte, error) {
+	text, ok := os.LookupEnv(atRestKeyEnv)
+	src := atRestKeyEnv
+	if *keyFile != "" {
+		b, err := os.ReadFile(*keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read key: %w", err)
+		}
+		text, ok, src = string(b), true, *keyFile
+	}
+	if !ok {
+		return nil, nil
+	}
+	key, err := parseAtRestKey([]byte(text))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", src, err)
+	}
+	return key, nil
+}
+
+// parseAtRestKey decodes a key given raw or in hex or base64
+func parseAtRestKey(b []byte) ([]byte, error) {
+	if len(b) == atRestKeySize {
+		return b, nil
+	}
+	text := string(bytes.TrimSpace(b))
+	if key, err := hex.DecodeString(text); err == nil && len(key) == atRestKeySize {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil &&
+		len(key) == atRestKeySize {
+		return key, nil
+	}
+	return nil, fmt.Errorf(
+		"key must be %d bytes, raw or in hex or base64", atRestKeySize,
+	)
+}
+
+func newAtRestAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts and authenticates data with AES-256-GCM, along with the
+// additional data, returning the random nonce followed by the ciphertext
+func seal(key []byte, data []byte, additional []byte) ([]byte, error) {
+	aead, err := newAtRestAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, data, additional), nil
+}
+
+// unseal decrypts data sealed with seal, failing if it or the additional
+// data was tampered with or the key is wrong
+func unseal(key []byte, sealed []byte, additional []byte) ([]byte, error) {
+	aead, err := newAtRestAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("could not decrypt: truncated")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	data, err := aead.Open(nil, nonce, ciphertext, additional)
+	if err != nil {
+		return nil, errors.New("could not decrypt: wrong key or corrupt data")
+	}
+	return data, nil
+}
+
+// sealedSegmentSize is how much plaintext an encrypted stream seals at a time
+const sealedSegmentSize = 64 * 1024
+
+// An encrypted stream starts with a random nonce and goes on with segments of
+// up to sealedSegmentSize bytes, each sealed with the nonce XORed with its
+// index and given as
+//
+//	length     uint32 of the ciphertext
+//	ciphertext
+//
+// The last segment, which may be empty, is sealed as such, so that a stream
+// cut short at a segment boundary fails to decrypt rather than reading as
+// shorter.
+
+// sealWriter encrypts a stream
+type sealWriter struct {
+	w     io.Writer
+	aead  cipher.AEAD
+	nonce []byte
+	index uint64
+	buf   []byte
+	err   error
+}
+
+// newSealWriter starts an encrypted stream with the given key
+func newSealWriter(w io.Writer, key []byte) (*sealWriter, error) {
+	aead, err := newAtRestAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(nonce); err != nil {
+		return nil, err
+	}
+	return &sealWriter{
+		w:     w,
+		aead:  aead,
+		nonce: nonce,
+		buf:   make([]byte, 0, sealedSegmentSize),
+	}, nil
+}
+
+func (s *sealWriter) Write(p []byte) (int, error) {
+	n := 0
+	for s.err == nil && len(p) > 0 {
+		m := min(len(p), sealedSegmentSize-len(s.buf))
+		s.buf = append(s.buf, p[:m]...)
+		p, n = p[m:], n+m
+		if len(s.buf) == sealedSegmentSize {
+			s.flush(false)
+		}
+	}
+	return n, s.err
+}
+
+// Close seals the last segment. It does not close the underlying writer.
+func (s *sealWriter) Close() error {
+	s.flush(true)
+	return s.err
+}
+
+func (s *sealWriter) flush(last bool) {
+	if s.err != nil {
+		return
+	}
+	ciphertext := s.aead.Seal(
+		nil, segmentNonce(s.nonce, s.index), s.buf, segmentAdditional(last),
+	)
+	head := binary.LittleEndian.AppendUint32(nil, uint32(len(ciphertext)))
+	if _, err := s.w.Write(append(head, ciphertext...)); err != nil {
+		s.err = err
+	}
+	s.index++
+	s.buf = s.buf[:0]
+}
+
+// unsealReader decrypts a stream written by sealWriter
+type unsealReader struct {
+	r     io.Reader
+	aead  cipher.AEAD
+	nonce []byte
+	index uint64
+	buf   []byte
+	last  bool
+}
+
+// newUnsealReader starts decrypting a stream with the given key
+func newUnsealReader(r io.Reader, key []byte) (*unsealReader, error) {
+	aead, err := newAtRestAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(r, nonce); err != nil {
+		return nil, errors.New("could not decrypt: truncated")
+	}
+	return &unsealReader{r: r, aead: aead, nonce: nonce}, nil
+}
+
+func (u *unsealReader) Read(p []byte) (int, error) {
+	for len(u.buf) == 0 {
+		if u.last {
+			return 0, io.EOF
+		}
+		if err := u.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, u.buf)
+	u.buf = u.buf[n:]
+	return n, nil
+}
+
+func (u *unsealReader) next() error {
+	var head [4]byte
+	if _, err := io.ReadFull(u.r, head[:]); err != nil {
+		return errors.New("could not decrypt: truncated")
+	}
+	n := binary.LittleEndian.Uint32(head[:])
+	if n > sealedSegmentSize+uint32(u.aead.Overhead()) {
+		return errors.New("could not decrypt: corrupt segment")
+	}
+	ciphertext := make([]byte, n)
+	if _, err := io.ReadFull(u.r, ciphertext); err != nil {
+		return errors.New("could not decrypt: truncated")
+	}
+	nonce := segmentNonce(u.nonce, u.index)
+	for _, last := range []bool{false, true} {
+		data, err := u.aead.Open(nil, nonce, ciphertext, segmentAdditional(last))
+		if err == nil {
+			u.buf, u.last = data, last
+			u.index++
+			return nil
+		}
+	}
+	return errors.New("could not decrypt: wrong key or corrupt data")
+}
+
+// segmentNonce returns the nonce of a segment of an encrypted stream
+func segmentNonce(base []byte, index uint64) []byte {
+	nonce := append([]byte(nil), base...)
+	tail := nonce[len(nonce)-8:]
+	binary.LittleEndian.PutUint64(tail, binary.LittleEndian.Uint64(tail)^index)
+	return nonce
+}
+
+// segmentAdditional is the additional data segments are sealed with, marking
+// the last one
+func segmentAdditional(last bool) []byte {
+	if last {
+		return []byte{1}
+	}
+	return []byte{0}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, atRestKeySize)
+}
+
+func TestParseAtRestKey(t *testing.T) {
+	key := make([]byte, atRestKeySize)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	for _, text := range [][]byte{
+		key,
+		[]byte(hex.EncodeToString(key) + "\n"),
+		[]byte(base64.StdEncoding.EncodeToString(key)),
+	} {
+		parsed, err := parseAtRestKey(text)
+		require.NoError(t, err)
+		assert.Equal(t, key, parsed)
+	}
+	_, err := parseAtRestKey([]byte("secret"))
+	assert.ErrorContains(t, err, "key must be 32 bytes")
+}
+
+func TestSeal(t *testing.T) {
+	sealed, err := seal(testKey(1), []byte("Oslo;1.0\n"), []byte("head"))
+	require.NoError(t, err)
+	data, err := unseal(testKey(1), sealed, []byte("head"))
+	require.NoError(t, err)
+	assert.Equal(t, "Oslo;1.0\n", string(data))
+
+	_, err = unseal(testKey(2), sealed, []byte("head"))
+	assert.Error(t, err)
+	_, err = unseal(testKey(1), sealed, []byte("other"))
+	assert.Error(t, err)
+}
+
+func TestSealStream(t *testing.T) {
+	for _, size := range []int{
+		0, 10, sealedSegmentSize, 3*sealedSegmentSize + 17,
+	} {
+		data := bytes.Repeat([]byte("Hamburg;12.0\n"), size/13+1)[:size]
+		var buf bytes.Buffer
+		w, err := newSealWriter(&buf, testKey(1))
+		require.NoError(t, err)
+		_, err = w.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		sealed := buf.Bytes()
+		assert.NotContains(t, string(sealed), "Hamburg")
+
+		r, err := newUnsealReader(bytes.NewReader(sealed), testKey(1))
+		require.NoError(t, err)
+		got, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, data, got)
+
+		r, err = newUnsealReader(bytes.NewReader(sealed), testKey(2))
+		require.NoError(t, err)
+		_, err = io.ReadAll(r)
+		assert.ErrorContains(t, err, "wrong key")
+
+		// Dropping the last segment must not read as a shorter stream
+		last := len(sealed) - (4 + size%sealedSegmentSize + 16)
+		r, err = newUnsealReader(bytes.NewReader(sealed[:last]), testKey(1))
+		if err == nil {
+			_, err = io.ReadAll(r)
+		}
+		assert.ErrorContains(t, err, "truncated")
+	}
+}
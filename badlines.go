@@ -0,0 +1,110 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// maxBadLineLen is how much of a malformed line an example keeps
+const maxBadLineLen = 256
+
+// badLine is an example of a malformed line that was skipped. Offset is that
+// of the line in its input, decompressed if it is compressed, and is left out
+// where it is not known, as for blocks decompressed in parallel.
+type badLine struct {
+	Input  string `json:"input,omitempty"`
+	Offset *int64 `json:"offset,omitempty"`
+	Line   string `json:"line"`
+}
+
+// badLines counts the malformed lines of a run and keeps the first few as
+// examples for -report
+type badLines struct {
+	count    atomic.Int64
+	mu       sync.Mutex
+	max      int
+	examples []badLine
+}
+
+func newBadLines(max int) *badLines {
+	return &badLines{max: max}
+}
+
+// add records a malformed line found at pos in a chunk from the given origin
+func (b *badLines) add(origin *chunkOrigin, pos int, line []byte) {
+	b.count.Add(1)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.examples) >= b.max {
+		return
+	}
+	ex := badLine{Line: string(line[:min(len(line), maxBadLineLen)])}
+	if origin != nil {
+		ex.Input = origin.input
+		if origin.offset >= 0 {
+			offset := origin.offset + int64(pos)
+			ex.Offset = &offset
+		}
+	}
+	b.examples = append(b.examples, ex)
+}
+
+// sorted returns the examples in input order where it is known, as workers
+// find them in any order
+func (b *badLines) sorted() []badLine {
+	examples := slices.Clone(b.examples)
+	slices.SortStableFunc(examples, func(x, y badLine) int {
+		if c := cmp.Compare(x.Input, y.Input); c != 0 {
+			return c
+		}
+		if x.Offset == nil || y.Offset == nil {
+			return 0
+		}
+		return cmp.Compare(*x.Offset, *y.Offset)
+	})
+	return examples
+}
+
+// chunkOrigin is where a chunk starts in the input: the input file and the
+// offset in it, or -1 if the offset is not known
+type chunkOrigin struct {
+	input  string
+	offset int64
+}
+
+// sendFrom hands a chunk to the workers like send, recording where it comes
+// from if the workers report where lines are
+func (c *chunkCounts) sendFrom(
+	ctx context.Context, chunkChan chan<- []byte, chunk []byte,
+	origin chunkOrigin,
+) error {
+	if !c.trackOrigins || len(chunk) == 0 {
+		return c.send(ctx, chunkChan, chunk)
+	}
+	key := unsafe.SliceData(chunk)
+	c.origins.Store(key, origin)
+	delivered, err := c.deliver(ctx, chunkChan, chunk)
+	if !delivered {
+		// No worker will look up a chunk it never got
+		c.origins.Delete(key)
+	}
+	return err
+}
+
+// origin returns where a received chunk comes from, or nil if it was not
+// recorded. Workers take it as soon as they receive the chunk, even one they
+// skip, so that no origin outlives its chunk.
+func (c *chunkCounts) origin(chunk []byte) *chunkOrigin {
+	if !c.trackOrigins || len(chunk) == 0 {
+		return nil
+	}
+	if o, ok := c.origins.LoadAndDelete(unsafe.SliceData(chunk)); ok {
+		origin := o.(chunkOrigin)
+		return &origin
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvalBadLineExamples(t *testing.T) {
+	defer func(s string, n int, r *runReport, e int) {
+		*strategy, chunkSize, report, *badLineExamples = s, n, r, e
+	}(*strategy, chunkSize, report, *badLineExamples)
+	chunkSize = 64
+	*badLineExamples = 2
+
+	// Lines of 10 bytes, with a bad line every 25 of them
+	var b strings.Builder
+	for i := 0; i < 100; i++ {
+		if i%25 == 7 {
+			fmt.Fprintf(&b, "bad%06d\n", i)
+		} else {
+			b.WriteString("Oslo;12.3\n")
+		}
+	}
+	path := filepath.Join(t.TempDir(), "bad.txt")
+	require.NoError(t, os.WriteFile(path, []byte(b.String()), 0o644))
+
+	for _, s := range []string{strategyStream, strategyMmap, strategyReadAt} {
+		t.Run(s, func(t *testing.T) {
+			*strategy = s
+			report = &runReport{}
+			var out strings.Builder
+			require.NoError(t, eval(context.Background(), path, &out))
+			assert.Equal(t, "{Oslo=12.3/12.3/12.3}\n", out.String())
+			assert.EqualValues(t, 4, report.MalformedLines)
+			require.Len(t, report.MalformedExamples, 2)
+			for _, ex := range report.MalformedExamples {
+				assert.Equal(t, path, ex.Input)
+				require.NotNil(t, ex.Offset)
+				assert.Equal(t,
+					fmt.Sprintf("bad%06d", *ex.Offset/10), ex.Line,
+				)
+			}
+		})
+	}
+}
+
+func TestEvalSpillBadLines(t *testing.T) {
+	defer func(dir string, n int, r *runReport, e int) {
+		*spillDir, *spillPartitions, report, *badLineExamples = dir, n, r, e
+	}(*spillDir, *spillPartitions, report, *badLineExamples)
+	*spillDir, *spillPartitions = t.TempDir(), 4
+	*badLineExamples = 1
+
+	input := "Oslo;12.3\nno separator\nRome;x\nRome;20.0\nlast"
+	path := filepath.Join(t.TempDir(), "bad.txt")
+	require.NoError(t, os.WriteFile(path, []byte(input), 0o644))
+	report = &runReport{}
+	var out strings.Builder
+	require.NoError(t, eval(context.Background(), path, &out))
+	assert.Equal(t, "{Oslo=12.3/12.3/12.3, Rome=20.0/20.0/20.0}\n", out.String())
+	assert.EqualValues(t, 3, report.MalformedLines)
+	require.Len(t, report.MalformedExamples, 1)
+	ex := report.MalformedExamples[0]
+	assert.Equal(t, path, ex.Input)
+	require.NotNil(t, ex.Offset)
+	assert.EqualValues(t, 10, *ex.Offset)
+	assert.Equal(t, "no separator", ex.Line)
+}
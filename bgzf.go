@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// bgzf is gzip in members of at most 64 KiB, each recording its size in an
+// extra field, so the members can be found without decompressing them
+const (
+	// bgzfHeaderSize is the size of a member header with just the BC extra
+	// field
+	bgzfHeaderSize = 18
+	// bgzfIndexExt is appended to the name of a file for its index, which
+	// lists the offsets of the members after the first
+	bgzfIndexExt = ".gzi"
+)
+
+// bgzfBatchSize is about how much of a file is handed to a decompressor at
+// once, several members together, so that members of 64 KiB are not each a
+// chunk of their own
+var bgzfBatchSize int64 = 4 * 1024 * 1024
+
+// bgzfDecoder decodes bgzf files in parallel, their members found from the
+// index next to the file if there is one, or else from their headers
+type bgzfDecoder struct{}
+
+func init() {
+	registerDecoder(bgzfDecoder{}, []byte{0x1f, 0x8b, 0x08, 0x04}, ".bgz")
+}
+
+func (bgzfDecoder) name() string { return "bgzf" }
+
+func (bgzfDecoder) sniff(head []byte) bool {
+	return len(head) >= 14 && head[12] == 'B' && head[13] == 'C'
+}
+
+func (bgzfDecoder) newReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+func (bgzfDecoder) blocks(
+	fpath string, f io.ReaderAt, size int64,
+) ([]block, error) {
+	offsets, err := readBgzfIndex(fpath+bgzfIndexExt, size)
+	if errors.Is(err, os.ErrNotExist) {
+		offsets, err = scanBgzfMembers(f, size)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Batch consecutive members, ending the last batch at the end of the
+	// file
+	var blocks []block
+	start := int64(0)
+	for _, off := range append(offsets, size) {
+		if off-start >= bgzfBatchSize || off == size && off > start {
+			blocks = append(blocks, block{offset: start, size: off - start})
+			start = off
+		}
+	}
+	return blocks, nil
+}
+
+func (bgzfDecoder) decodeBlock(src []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// readBgzfIndex reads the offsets of the members of a bgzf file after the first
+// from its index: their count and then each as its compressed and
+// decompressed offsets, all little-endian uint64
+func readBgzfIndex(fpath string, size int64) ([]int64, error) {
+	b, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 8 {
+		return nil, fmt.Errorf("%s is truncated", fpath)
+	}
+	n := binary.LittleEndian.Uint64(b)
+	if uint64(len(b)-8) != n*16 {
+		return nil, fmt.Errorf("%s does not hold %d entries", fpath, n)
+	}
+	offsets := make([]int64, n)
+	prev := int64(0)
+	for i := range offsets {
+		off := int64(binary.LittleEndian.Uint64(b[8+i*16:]))
+		if off <= prev || off > size {
+			return nil, fmt.Errorf("%s is corrupt at entry %d", fpath, i)
+		}
+		offsets[i], prev = off, off
+	}
+	return offsets, nil
+}
+
+// scanBgzfMembers finds the offsets of the members of a bgzf file after the
+// first by reading the size in each header. Like the files written by bgzip,
+// members must have the BC field as their only extra field.
+func scanBgzfMembers(f io.ReaderAt, size int64) ([]int64, error) {
+	var offsets []int64
+	head := make([]byte, bgzfHeaderSize)
+	off := int64(0)
+	for off < size {
+		if _, err := f.ReadAt(head, off); err != nil {
+			return nil, fmt.Errorf("truncated member at %d", off)
+		}
+		if !bytes.HasPrefix(head, []byte{0x1f, 0x8b, 0x08, 0x04}) ||
+			binary.LittleEndian.Uint16(head[10:]) != 6 ||
+			!(bgzfDecoder{}).sniff(head) ||
+			binary.LittleEndian.Uint16(head[14:]) != 2 {
+			return nil, fmt.Errorf("not a bgzf member at %d", off)
+		}
+		off += int64(binary.LittleEndian.Uint16(head[16:])) + 1
+		if off < size {
+			offsets = append(offsets, off)
+		}
+	}
+	if off > size {
+		return nil, errors.New("last member is truncated")
+	}
+	return offsets, nil
+}
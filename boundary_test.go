@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// boundaryMaxInput is the largest sample split at every byte boundary
+const boundaryMaxInput = 1024
+
+// TestChunkBoundaries evaluates every small sample with every chunk size up to
+// its length, so that chunks are split at every possible byte boundary, and
+// checks the results do not depend on where the splits fall
+func TestChunkBoundaries(t *testing.T) {
+	defer func(c int, j int, s string) {
+		chunkSize, *jobs, *strategy = c, j, s
+	}(chunkSize, *jobs, *strategy)
+	*jobs = 4
+
+	inputFiles, err := findFiles(sampleInputDir, sampleInputExt)
+	if err != nil {
+		t.Fatalf("could not get input files: %v", err)
+	}
+	for _, file := range inputFiles {
+		info, err := os.Stat(file + sampleInputExt)
+		if err != nil {
+			t.Fatalf("could not stat input: %v", err)
+		}
+		if info.Size() > boundaryMaxInput {
+			continue
+		}
+		expected, err := readFile(file + sampleOutputExt)
+		if err != nil {
+			t.Fatalf("could not read output file: %v", err)
+		}
+		for _, s := range []string{strategyStream, strategyMmap, strategyReadAt} {
+			*strategy = s
+			name := fmt.Sprintf("%s/%s", filepath.Base(file), s)
+			t.Run(name, func(t *testing.T) {
+				for size := 1; size <= int(info.Size())+1; size++ {
+					chunkSize = size
+					var actual strings.Builder
+					if err := eval(context.Background(), file+sampleInputExt, &actual); err != nil {
+						t.Fatalf("chunk size %d: %v", size, err)
+					}
+					if actual.String() != expected {
+						t.Fatalf(
+							"chunk size %d: got %q, want %q",
+							size, actual.String(), expected,
+						)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package brc
+
+import (
+	"bytes"
+	"runtime"
+	"sync"
+)
+
+// Aggregate groups the lines of a source by key. Every line but blank ones is
+// passed to extract without its new line, and the values extracted for the
+// same key are combined with merge, which must be associative and
+// commutative since lines are aggregated by several workers at once. The line
+// is only valid during the call to extract, so keys must not alias it.
+//
+// The source is read sequentially with Chunks and the chunks are handed to
+// the workers over a channel, so any reader will do. Process is a separate
+// engine for the 1BRC format itself, which reads the input by ranges at
+// offsets and looks stations up without building a string per line.
+func Aggregate[K comparable, V any](
+	src Source, extract func([]byte) (K, V), merge func(V, V) V,
+) (map[K]V, error) {
+	workers := runtime.GOMAXPROCS(0)
+	chunks := make(chan []byte, workers)
+	partials := make([]map[K]V, workers)
+	var wg sync.WaitGroup
+	for i := range partials {
+		partials[i] = map[K]V{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range chunks {
+				aggregateLines(partials[i], chunk, extract, merge)
+			}
+		}()
+	}
+	var err error
+	for chunk, chunkErr := range Chunks(src, DefaultChunkSize) {
+		if chunkErr != nil {
+			err = chunkErr
+			break
+		}
+		chunks <- chunk
+	}
+	close(chunks)
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+
+	merged := partials[0]
+	for _, partial := range partials[1:] {
+		for k, v := range partial {
+			if m, ok := merged[k]; ok {
+				merged[k] = merge(m, v)
+			} else {
+				merged[k] = v
+			}
+		}
+	}
+	return merged, nil
+}
+
+// aggregateLines adds the values extracted from the lines of a chunk to a map
+func aggregateLines[K comparable, V any](
+	m map[K]V, chunk []byte, extract func([]byte) (K, V), merge func(V, V) V,
+) {
+	for len(chunk) > 0 {
+		line, rest, _ := bytes.Cut(chunk, []byte{'\n'})
+		chunk = rest
+		if len(line) == 0 {
+			continue
+		}
+		k, v := extract(line)
+		if old, ok := m[k]; ok {
+			m[k] = merge(old, v)
+		} else {
+			m[k] = v
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package brc
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/aeolyus/1brc/brc/fastparse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// malformed is the key the 1BRC extractor below files malformed lines under
+const malformed = "\x00malformed"
+
+// extractMeasurement is the 1BRC instantiation of Aggregate
+func extractMeasurement(line []byte) (string, Tenths) {
+	station, value, _ := fastparse.ScanLine(line)
+	t, n := fastparse.ParseTempTenths(value)
+	if station == nil || n != len(value) {
+		return malformed, Tenths{}
+	}
+	v := Tenths{}
+	v.Add(int64(t))
+	return string(station), v
+}
+
+func mergeMeasurements(a, b Tenths) Tenths {
+	a.Merge(&b)
+	return a
+}
+
+func TestAggregateMeasurements(t *testing.T) {
+	inputs, err := filepath.Glob("../test/samples/*.txt")
+	require.NoError(t, err)
+	for _, input := range inputs {
+		f, err := os.Open(input)
+		require.NoError(t, err)
+		defer f.Close()
+		want, err := Process(f, Options{})
+		require.NoError(t, err)
+
+		// Process reads with ReadAt, so the file is still at its start
+		stats, err := Aggregate(f, extractMeasurement, mergeMeasurements)
+		require.NoError(t, err, input)
+		delete(stats, malformed)
+		got := make(Results, 0, len(stats))
+		for station, v := range stats {
+			got = append(got, Result{Station: station, Stat: v.Stat()})
+		}
+		slices.SortFunc(got, func(a, b Result) int {
+			return strings.Compare(a.Station, b.Station)
+		})
+		assert.Equal(t, want, got, input)
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	// Counting the words of each length, blank lines aside
+	lines := strings.Repeat("a\nbb\ncc\n\nddd\n", 1000) + "e"
+	counts, err := Aggregate(
+		strings.NewReader(lines),
+		func(line []byte) (int, int) { return len(line), 1 },
+		func(a, b int) int { return a + b },
+	)
+	require.NoError(t, err)
+	assert.Equal(t, map[int]int{1: 1001, 2: 2000, 3: 1000}, counts)
+
+	_, err = Aggregate(
+		io.MultiReader(strings.NewReader("a\n"), iotest.ErrReader(assert.AnError)),
+		func(line []byte) (string, int) { return string(line), 1 },
+		func(a, b int) int { return a + b },
+	)
+	assert.ErrorIs(t, err, assert.AnError)
+
+	counts, err = Aggregate(
+		bytes.NewReader(nil),
+		func(line []byte) (int, int) { return len(line), 1 },
+		func(a, b int) int { return a + b },
+	)
+	require.NoError(t, err)
+	assert.Empty(t, counts)
+}
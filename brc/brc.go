@@ -0,0 +1,178 @@
+// Package brc holds the types shared by the 1BRC aggregation engine and
+// programs consuming its results, along with an engine that programs can
+// embed to aggregate measurements themselves.
+package brc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Stat is the aggregate of a station's measurements. Its field names are part
+// of its JSON, CSV and gob encodings and are kept stable.
+type Stat struct {
+	Min   float64 `json:"min" csv:"min"`
+	Mean  float64 `json:"mean" csv:"mean"`
+	Max   float64 `json:"max" csv:"max"`
+	Count int64   `json:"count" csv:"count"`
+}
+
+// Result is the aggregate of a single station
+type Result struct {
+	Station string `json:"station" csv:"station"`
+	Stat
+}
+
+// Results are the aggregates of every station, in output order
+type Results []Result
+
+// MarshalText formats the stat as min/mean/max with one decimal, as in the
+// challenge output, rounding each value with Round. The count is not part of
+// the text form.
+func (s Stat) MarshalText() ([]byte, error) {
+	return fmt.Appendf(
+		nil, "%.1f/%.1f/%.1f", Round(s.Min), Round(s.Mean), Round(s.Max),
+	), nil
+}
+
+// Round rounds a temperature to one decimal half up, toward positive
+// infinity, as the challenge's reference implementation does with
+// Math.round(x * 10) / 10. Formatting with %.1f alone would round half to
+// even instead, on the binary value.
+func Round(x float64) float64 {
+	return math.Floor(x*10+0.5) / 10
+}
+
+// UnmarshalText parses a stat formatted as min/mean/max
+func (s *Stat) UnmarshalText(text []byte) error {
+	parts := strings.Split(string(text), "/")
+	if len(parts) != 3 {
+		return fmt.Errorf("invalid stat %q: expected min/mean/max", text)
+	}
+	var values [3]float64
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return fmt.Errorf("invalid stat %q: %w", text, err)
+		}
+		values[i] = v
+	}
+	*s = Stat{Min: values[0], Mean: values[1], Max: values[2]}
+	return nil
+}
+
+// MarshalJSON encodes the stat as an object rather than its text form
+func (s Stat) MarshalJSON() ([]byte, error) {
+	type plain Stat
+	return json.Marshal(plain(s))
+}
+
+// MarshalText formats the result as station=min/mean/max
+func (r Result) MarshalText() ([]byte, error) {
+	text, _ := r.Stat.MarshalText()
+	return append([]byte(r.Station+"="), text...), nil
+}
+
+// UnmarshalText parses a result formatted as station=min/mean/max
+func (r *Result) UnmarshalText(text []byte) error {
+	i := bytes.LastIndexByte(text, '=')
+	if i < 0 {
+		return fmt.Errorf("invalid result %q: expected station=stat", text)
+	}
+	r.Station = string(text[:i])
+	return r.Stat.UnmarshalText(text[i+1:])
+}
+
+// MarshalJSON encodes the result as an object rather than its text form
+func (r Result) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Station string  `json:"station"`
+		Min     float64 `json:"min"`
+		Mean    float64 `json:"mean"`
+		Max     float64 `json:"max"`
+		Count   int64   `json:"count"`
+	}{r.Station, r.Min, r.Mean, r.Max, r.Count})
+}
+
+// MarshalText formats the results as in the challenge output, e.g.
+// {Abha=-23.0/18.0/59.2, Abidjan=-16.2/26.0/67.3}
+func (rs Results) MarshalText() ([]byte, error) {
+	b := []byte{'{'}
+	for i, r := range rs {
+		if i > 0 {
+			b = append(b, ", "...)
+		}
+		text, _ := r.MarshalText()
+		b = append(b, text...)
+	}
+	return append(b, '}'), nil
+}
+
+// resultEnd matches the stat ending a result in the text form of results.
+// Station names may hold commas and equal signs, so results are split at their
+// stats rather than at separators.
+var resultEnd = regexp.MustCompile(
+	`=(-?[0-9]+\.[0-9]/-?[0-9]+\.[0-9]/-?[0-9]+\.[0-9])(?:, |$)`,
+)
+
+// UnmarshalText parses results formatted as in the challenge output, with or
+// without a trailing new line
+func (rs *Results) UnmarshalText(text []byte) error {
+	text = bytes.TrimSuffix(text, []byte("\n"))
+	if len(text) < 2 || !bytes.HasPrefix(text, []byte("{")) ||
+		!bytes.HasSuffix(text, []byte("}")) {
+		return fmt.Errorf("invalid results: expected {station=stat, ...}")
+	}
+	inner := text[1 : len(text)-1]
+	results := Results{}
+	start := 0
+	for _, m := range resultEnd.FindAllSubmatchIndex(inner, -1) {
+		r := Result{Station: string(inner[start:m[0]])}
+		if err := r.Stat.UnmarshalText(inner[m[2]:m[3]]); err != nil {
+			return err
+		}
+		results = append(results, r)
+		start = m[1]
+	}
+	if start != len(inner) {
+		return fmt.Errorf("invalid result %q: expected station=stat", inner[start:])
+	}
+	*rs = results
+	return nil
+}
+
+// MarshalJSON encodes the results as an array of objects rather than their
+// text form
+func (rs Results) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]Result(rs))
+}
+
+// All returns an iterator over the stations and their stats, in output order
+func (rs Results) All() iter.Seq2[string, Stat] {
+	return func(yield func(string, Stat) bool) {
+		for _, r := range rs {
+			if !yield(r.Station, r.Stat) {
+				return
+			}
+		}
+	}
+}
+
+// Sorted returns an iterator over the stations and their stats in byte order
+// of the station names, whatever the output order. The results themselves are
+// left as they are.
+func (rs Results) Sorted() iter.Seq2[string, Stat] {
+	return func(yield func(string, Stat) bool) {
+		sorted := slices.SortedStableFunc(slices.Values(rs), func(a, b Result) int {
+			return strings.Compare(a.Station, b.Station)
+		})
+		Results(sorted).All()(yield)
+	}
+}
@@ -0,0 +1,137 @@
+package brc
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testResults = Results{
+	{"Abha", Stat{Min: -23, Mean: 18, Max: 59.2, Count: 3}},
+	{"Washington, D.C.", Stat{Min: -0.5, Mean: 14.6, Max: 33.3, Count: 1}},
+}
+
+func TestMarshalText(t *testing.T) {
+	text, err := testResults.MarshalText()
+	require.NoError(t, err)
+	assert.Equal(
+		t,
+		"{Abha=-23.0/18.0/59.2, Washington, D.C.=-0.5/14.6/33.3}",
+		string(text),
+	)
+
+	var r Result
+	require.NoError(t, r.UnmarshalText([]byte("a=b=-1.0/2.5/3.0")))
+	assert.Equal(t, Result{"a=b", Stat{Min: -1, Mean: 2.5, Max: 3}}, r)
+	assert.Error(t, r.UnmarshalText([]byte("a=1.0/2.0")))
+	assert.Error(t, r.UnmarshalText([]byte("a")))
+}
+
+func TestRound(t *testing.T) {
+	for _, tc := range []struct{ x, want float64 }{
+		{0.25, 0.3},
+		{-0.25, -0.2},
+		{1.05, 1.1},
+		{-1.05, -1.0},
+		{0.04, 0},
+		{-0.04, 0},
+		{-0.05, 0},
+		{-0.06, -0.1},
+		{59.2, 59.2},
+		{-99.9, -99.9},
+	} {
+		assert.Equal(t, tc.want, Round(tc.x), tc.x)
+	}
+
+	// Halves round up rather than to even, on the min and max as well
+	text, err := Stat{Min: -0.25, Mean: 0.25, Max: 2.25}.MarshalText()
+	require.NoError(t, err)
+	assert.Equal(t, "-0.2/0.3/2.3", string(text))
+}
+
+func TestMarshalJSON(t *testing.T) {
+	b, err := json.Marshal(testResults[:1])
+	require.NoError(t, err)
+	assert.JSONEq(
+		t,
+		`[{"station":"Abha","min":-23,"mean":18,"max":59.2,"count":3}]`,
+		string(b),
+	)
+
+	b, err = json.Marshal(testResults[0].Stat)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"min":-23,"mean":18,"max":59.2,"count":3}`, string(b))
+}
+
+func TestGob(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, gob.NewEncoder(&buf).Encode(testResults))
+	var decoded Results
+	require.NoError(t, gob.NewDecoder(&buf).Decode(&decoded))
+	assert.Equal(t, testResults, decoded)
+
+	buf.Reset()
+	require.NoError(t, gob.NewEncoder(&buf).Encode(testResults[0]))
+	var result Result
+	require.NoError(t, gob.NewDecoder(&buf).Decode(&result))
+	assert.Equal(t, testResults[0], result)
+}
+
+func TestIterators(t *testing.T) {
+	rs := Results{testResults[1], testResults[0]}
+	var stations []string
+	for station, s := range rs.All() {
+		stations = append(stations, station)
+		assert.NotZero(t, s.Count)
+	}
+	assert.Equal(t, []string{"Washington, D.C.", "Abha"}, stations)
+
+	stations = stations[:0]
+	for station, s := range rs.Sorted() {
+		stations = append(stations, station)
+		assert.Equal(t, testResults[len(stations)-1].Stat, s)
+	}
+	assert.Equal(t, []string{"Abha", "Washington, D.C."}, stations)
+	// Sorting leaves the results in their order
+	assert.Equal(t, "Washington, D.C.", rs[0].Station)
+
+	for range rs.Sorted() {
+		break
+	}
+}
+
+func TestUnmarshalResults(t *testing.T) {
+	var rs Results
+	require.NoError(t, rs.UnmarshalText([]byte(
+		"{Abha=-23.0/18.0/59.2, Washington, D.C.=-0.5/14.6/33.3}\n",
+	)))
+	assert.Equal(t, []string{"Abha", "Washington, D.C."}, []string{
+		rs[0].Station, rs[1].Station,
+	})
+	assert.Equal(t, Stat{Min: -0.5, Mean: 14.6, Max: 33.3}, rs[1].Stat)
+
+	require.NoError(t, rs.UnmarshalText([]byte("{}")))
+	assert.Empty(t, rs)
+	for _, text := range []string{"", "{", "Abha=1.0/2.0/3.0", "{Abha=1.0/2.0}"} {
+		assert.Error(t, rs.UnmarshalText([]byte(text)), text)
+	}
+
+	// Every sample output parses back into the same text
+	outs, err := filepath.Glob("../test/samples/*.out")
+	require.NoError(t, err)
+	require.NotEmpty(t, outs)
+	for _, out := range outs {
+		want, err := os.ReadFile(out)
+		require.NoError(t, err)
+		require.NoError(t, rs.UnmarshalText(want), out)
+		got, err := rs.MarshalText()
+		require.NoError(t, err)
+		assert.Equal(t, string(bytes.TrimSuffix(want, []byte("\n"))), string(got), out)
+	}
+}
@@ -0,0 +1,55 @@
+package brc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+)
+
+// Source is the input measurements are read from, one per line
+type Source = io.Reader
+
+// Chunks returns an iterator over the chunks of whole lines of a source. Each
+// chunk holds about size bytes and ends on a new line, except a last line
+// without one, which is yielded on its own; a line longer than size is
+// yielded whole along with the lines read with it. Chunks are freshly
+// allocated, so they may be kept and handed to other goroutines. A read error
+// is yielded with a nil chunk and ends the iteration.
+func Chunks(source Source, size int) iter.Seq2[[]byte, error] {
+	return func(yield func([]byte, error) bool) {
+		if size <= 0 {
+			yield(nil, fmt.Errorf("invalid chunk size %d", size))
+			return
+		}
+		readBuf := make([]byte, size)
+		var leftOver []byte
+		for {
+			n, err := io.ReadFull(source, readBuf)
+			data := readBuf[:n]
+			if i := bytes.LastIndexByte(data, '\n'); i >= 0 {
+				chunk := make([]byte, len(leftOver)+i+1)
+				copy(chunk, leftOver)
+				copy(chunk[len(leftOver):], data[:i+1])
+				if !yield(chunk, nil) {
+					return
+				}
+				data = data[i+1:]
+				leftOver = leftOver[:0]
+			}
+			leftOver = append(leftOver, data...)
+
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				if len(leftOver) > 0 {
+					yield(leftOver, nil)
+				}
+				return
+			}
+			if err != nil {
+				yield(nil, fmt.Errorf("error reading chunk: %w", err))
+				return
+			}
+		}
+	}
+}
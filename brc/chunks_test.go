@@ -0,0 +1,82 @@
+package brc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// collectChunks returns the chunks of a source, failing on errors
+func collectChunks(t *testing.T, source Source, size int) [][]byte {
+	t.Helper()
+	var chunks [][]byte
+	for chunk, err := range Chunks(source, size) {
+		require.NoError(t, err)
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+func TestChunks(t *testing.T) {
+	data, err := os.ReadFile("../test/samples/measurements-20.txt")
+	require.NoError(t, err)
+	for size := 1; size <= len(data)+1; size++ {
+		chunks := collectChunks(t, bytes.NewReader(data), size)
+		for _, chunk := range chunks {
+			require.True(t, bytes.HasSuffix(chunk, []byte("\n")), size)
+		}
+		require.Equal(t, data, bytes.Join(chunks, nil), size)
+	}
+}
+
+func TestChunksEdges(t *testing.T) {
+	// A long line is yielded whole along with the lines read with it
+	chunks := collectChunks(t, strings.NewReader("a;1\nlong;12.5\nb;2\n"), 6)
+	assert.Equal(t, [][]byte{
+		[]byte("a;1\n"), []byte("long;12.5\nb;2\n"),
+	}, chunks)
+
+	// A last line without a new line is yielded on its own
+	chunks = collectChunks(t, strings.NewReader("a;1\nb;2"), 64)
+	assert.Equal(t, [][]byte{[]byte("a;1\n"), []byte("b;2")}, chunks)
+
+	assert.Empty(t, collectChunks(t, strings.NewReader(""), 64))
+
+	// Chunks are not overwritten by later reads
+	chunks = collectChunks(t, iotest.OneByteReader(strings.NewReader("a;1\nb;2\n")), 4)
+	assert.Equal(t, [][]byte{[]byte("a;1\n"), []byte("b;2\n")}, chunks)
+}
+
+func TestChunksErrors(t *testing.T) {
+	errRead := errors.New("read failed")
+	source := io.MultiReader(strings.NewReader("a;1\n"), iotest.ErrReader(errRead))
+	var chunks [][]byte
+	var errs []error
+	for chunk, err := range Chunks(source, 2) {
+		chunks = append(chunks, chunk)
+		errs = append(errs, err)
+	}
+	require.Len(t, errs, 2)
+	assert.Equal(t, []byte("a;1\n"), chunks[0])
+	assert.NoError(t, errs[0])
+	assert.Nil(t, chunks[1])
+	assert.ErrorIs(t, errs[1], errRead)
+
+	for _, err := range Chunks(strings.NewReader("a;1\n"), 0) {
+		assert.Error(t, err)
+	}
+
+	// Stopping early does not read any further
+	r := strings.NewReader("a;1\nb;2\nc;3\n")
+	for range Chunks(r, 4) {
+		break
+	}
+	assert.Equal(t, 8, r.Len())
+}
@@ -0,0 +1,55 @@
+// Package fastparse provides the primitives used to parse 1BRC measurement
+// lines of the form <station>;<temperature>\n, where temperatures lie within
+// [-99.9, 99.9] and always have exactly one fractional digit.
+package fastparse
+
+import "bytes"
+
+// ParseTempTenths parses a temperature at the start of b, returning it in
+// tenths of a degree along with the number of bytes it spans. If b does not
+// start with a valid temperature, n is 0.
+func ParseTempTenths(b []byte) (tenths int16, n int) {
+	var neg bool
+	if len(b) > 0 && b[0] == '-' {
+		neg = true
+		n = 1
+	}
+	switch {
+	case len(b) >= n+3 && isDigit(b[n]) && b[n+1] == '.' && isDigit(b[n+2]):
+		tenths = int16(b[n]-'0')*10 + int16(b[n+2]-'0')
+		n += 3
+	case len(b) >= n+4 && isDigit(b[n]) && isDigit(b[n+1]) &&
+		b[n+2] == '.' && isDigit(b[n+3]):
+		tenths = int16(b[n]-'0')*100 + int16(b[n+1]-'0')*10 +
+			int16(b[n+3]-'0')
+		n += 4
+	default:
+		return 0, 0
+	}
+	if neg {
+		tenths = -tenths
+	}
+	return tenths, n
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// ScanLine splits the first line of b into its station and value, returning
+// the bytes after the line's new line as rest. A final line without a new
+// line spans the rest of b, and rest is then empty. If the line has no ';',
+// station is nil and value is the whole line.
+func ScanLine(b []byte) (station, value, rest []byte) {
+	line := b
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		line, rest = b[:i], b[i+1:]
+	} else {
+		rest = b[len(b):]
+	}
+	i := bytes.IndexByte(line, ';')
+	if i < 0 {
+		return nil, line, rest
+	}
+	return line[:i], line[i+1:], rest
+}
@@ -0,0 +1,208 @@
+package fastparse
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTempTenths(t *testing.T) {
+	tests := []struct {
+		in     string
+		tenths int16
+		n      int
+	}{
+		{"0.0", 0, 3},
+		{"1.5", 15, 3},
+		{"-1.5", -15, 4},
+		{"12.3", 123, 4},
+		{"-99.9\n", -999, 5},
+		{"99.9;", 999, 4},
+		{"", 0, 0},
+		{"-", 0, 0},
+		{"1", 0, 0},
+		{"1.", 0, 0},
+		{"123.4", 0, 0},
+		{".5", 0, 0},
+		{"1,5", 0, 0},
+		{"--1.0", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			tenths, n := ParseTempTenths([]byte(tt.in))
+			assert.Equal(t, tt.tenths, tenths)
+			assert.Equal(t, tt.n, n)
+		})
+	}
+}
+
+func TestParseTempTenthsExhaustive(t *testing.T) {
+	for tenths := -999; tenths <= 999; tenths++ {
+		in := strconv.FormatFloat(float64(tenths)/10, 'f', 1, 64)
+		got, n := ParseTempTenths([]byte(in))
+		if int(got) != tenths || n != len(in) {
+			t.Fatalf("%q: got %d (%d bytes), want %d", in, got, n, tenths)
+		}
+	}
+}
+
+// TestParseTempTenthsEncodings checks every encoding the parser accepts,
+// including negative zero and leading zeros, against strconv, with whatever
+// follows the value in a line
+func TestParseTempTenthsEncodings(t *testing.T) {
+	for _, sign := range []string{"", "-"} {
+		for whole := 0; whole < 110; whole++ {
+			// 0-9 as a single digit, then 00-99 as two
+			digits := strconv.Itoa(whole)
+			if whole >= 10 {
+				digits = fmt.Sprintf("%02d", whole-10)
+			}
+			for frac := 0; frac <= 9; frac++ {
+				value := sign + digits + "." + strconv.Itoa(frac)
+				want, err := strconv.ParseFloat(value, 64)
+				require.NoError(t, err)
+				for _, rest := range []string{"", "\n", ";", "0", "\nA;1.0"} {
+					tenths, n := ParseTempTenths([]byte(value + rest))
+					if int(tenths) != int(math.Round(want*10)) ||
+						n != len(value) {
+						t.Fatalf(
+							"%q: got %d (%d bytes), want %v",
+							value+rest, tenths, n, want,
+						)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestScanLine(t *testing.T) {
+	tests := []struct {
+		in                   string
+		station, value, rest string
+		noStation            bool
+	}{
+		{"Abha;12.3\nrest", "Abha", "12.3", "rest", false},
+		{"Abha;12.3", "Abha", "12.3", "", false},
+		{";1.0\n", "", "1.0", "", false},
+		{"a;b;1.0\n", "a", "b;1.0", "", false},
+		{"garbage\nrest", "", "garbage", "rest", true},
+		{"\n", "", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			station, value, rest := ScanLine([]byte(tt.in))
+			assert.Equal(t, tt.noStation, station == nil)
+			assert.Equal(t, tt.station, string(station))
+			assert.Equal(t, tt.value, string(value))
+			assert.Equal(t, tt.rest, string(rest))
+		})
+	}
+}
+
+// TestScanLineNames checks lines with station names of every length, and
+// any bytes but the separator and new line, against splitting them with
+// bytes.Cut
+func TestScanLineNames(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var input []byte
+	var names []string
+	for n := 0; n <= 128; n++ {
+		name := make([]byte, n)
+		rng.Read(name)
+		for i, c := range name {
+			if c == ';' || c == '\n' {
+				name[i] = 'x'
+			}
+		}
+		names = append(names, string(name))
+		input = append(input, name...)
+		input = append(input, ";-12.3\n"...)
+	}
+	for i := 0; len(input) > 0; i++ {
+		line, rest, _ := bytes.Cut(input, []byte{'\n'})
+		wantStation, wantValue, _ := bytes.Cut(line, []byte{';'})
+		station, value, gotRest := ScanLine(input)
+		assert.Equal(t, names[i], string(station))
+		assert.Equal(t, wantStation, station)
+		assert.Equal(t, wantValue, value)
+		assert.Equal(t, rest, gotRest)
+		input = gotRest
+	}
+}
+
+func FuzzParseTempTenths(f *testing.F) {
+	for _, s := range []string{"0.0", "-99.9", "12.3", "1.", "-", "9.99"} {
+		f.Add([]byte(s))
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		tenths, n := ParseTempTenths(b)
+		if n == 0 {
+			if tenths != 0 {
+				t.Fatalf("%q: invalid input returned %d", b, tenths)
+			}
+			return
+		}
+		want, err := strconv.ParseFloat(string(b[:n]), 64)
+		if err != nil {
+			t.Fatalf("%q: accepted %q which strconv rejects", b, b[:n])
+		}
+		if int16(math.Round(want*10)) != tenths {
+			t.Fatalf("%q: got %d, want %v", b, tenths, want)
+		}
+	})
+}
+
+func FuzzScanLine(f *testing.F) {
+	for _, s := range []string{"Abha;12.3\nBer;1.0\n", "a;1.0", "x\n", ""} {
+		f.Add([]byte(s))
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		for len(b) > 0 {
+			station, value, rest := ScanLine(b)
+			line := b[:len(b)-len(rest)]
+			line = bytes.TrimSuffix(line, []byte{'\n'})
+			if station == nil {
+				if !bytes.Equal(value, line) || bytes.IndexByte(line, ';') >= 0 {
+					t.Fatalf("%q: bad line without station", b)
+				}
+			} else if string(line) != string(station)+";"+string(value) {
+				t.Fatalf("%q: split into %q and %q", line, station, value)
+			}
+			if bytes.IndexByte(line, '\n') >= 0 || len(rest) >= len(b) {
+				t.Fatalf("%q: did not advance by a single line", b)
+			}
+			b = rest
+		}
+	})
+}
+
+// benchLines are lines in the shape of the 1BRC input, for the benchmarks
+var benchLines = bytes.Repeat(
+	[]byte("Hamburg;12.0\nBulawayo;8.9\nPalembang;-38.8\nSt. John's;15.2\n"),
+	1024,
+)
+
+func BenchmarkScanLine(b *testing.B) {
+	b.SetBytes(int64(len(benchLines)))
+	for range b.N {
+		for rest := benchLines; len(rest) > 0; {
+			_, _, rest = ScanLine(rest)
+		}
+	}
+}
+
+func BenchmarkParseTempTenths(b *testing.B) {
+	values := [][]byte{
+		[]byte("12.0"), []byte("8.9"), []byte("-38.8"), []byte("-1.5"),
+	}
+	for i := range b.N {
+		ParseTempTenths(values[i%len(values)])
+	}
+}
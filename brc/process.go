@@ -0,0 +1,319 @@
+package brc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aeolyus/1brc/brc/fastparse"
+)
+
+// DefaultChunkSize is the chunk size Process reads with by default
+const DefaultChunkSize = 16 << 20
+
+// Options configure Process. The zero value processes the whole input with
+// one worker per CPU.
+type Options struct {
+	// Workers is the number of ranges of the input read and aggregated at
+	// once, at least 1. It defaults to GOMAXPROCS.
+	Workers int
+	// ChunkSize is the number of bytes each worker reads at a time; lines
+	// longer than it are read whole nonetheless. It defaults to
+	// DefaultChunkSize.
+	ChunkSize int
+	// Size is the number of bytes of the input. It defaults to the size the
+	// input reports through a Size or Stat method, as those of bytes.Reader,
+	// io.SectionReader and os.File do.
+	Size int64
+}
+
+// Process aggregates the measurements of an input, one <station>;<temperature>
+// line each, into results sorted by station. Malformed lines are skipped. The
+// input is split into ranges of whole lines read in parallel with ReadAt, and
+// means are the exact means rounded half up to one decimal, as the CLI has
+// them.
+func Process(r io.ReaderAt, opts Options) (Results, error) {
+	var workers []*tenthsWorker
+	err := ReadRanges(r, opts, func() Worker {
+		w := &tenthsWorker{stats: map[string]*Tenths{}}
+		workers = append(workers, w)
+		return w
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	merged := map[string]*Tenths{}
+	for _, w := range workers {
+		for station, v := range w.stats {
+			if m, ok := merged[station]; ok {
+				m.Merge(v)
+			} else {
+				merged[station] = v
+			}
+		}
+	}
+	rs := make(Results, 0, len(merged))
+	for station, v := range merged {
+		rs = append(rs, Result{Station: station, Stat: v.Stat()})
+	}
+	slices.SortFunc(rs, func(a, b Result) int {
+		return strings.Compare(a.Station, b.Station)
+	})
+	return rs, nil
+}
+
+// A Worker aggregates the chunks of one range of the input as ReadRanges
+// reads them, so that programs embedding the engine can aggregate lines their
+// own way, e.g. writing side outputs as they go
+type Worker interface {
+	// BeforeRead is called before each read of n bytes of the range, e.g.
+	// to throttle or time reads
+	BeforeRead(n int) error
+	// Chunk aggregates a chunk of whole lines found at offset off of the
+	// input. The chunk is only valid during the call.
+	Chunk(chunk []byte, off int64) error
+	// Done is called once the whole range is aggregated
+	Done() error
+}
+
+// ReadRanges splits the input into ranges of whole lines, one per worker, and
+// has each range read with ReadAt chunk by chunk and handed to the Worker that
+// newWorker returned for it. newWorker is called once per range before any is
+// read. The first error of a worker stops the others at their next chunk and
+// is returned; a read past the end of the input is an io.ErrUnexpectedEOF.
+func ReadRanges(r io.ReaderAt, opts Options, newWorker func() Worker) error {
+	size, err := inputSize(r, opts.Size)
+	if err != nil {
+		return err
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	chunkSize := opts.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	bounds, err := lineBounds(r, size, workers)
+	if err != nil {
+		return err
+	}
+
+	ranges := make([]Worker, len(bounds)-1)
+	for i := range ranges {
+		ranges[i] = newWorker()
+	}
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+		failed   atomic.Bool
+	)
+	for i, w := range ranges {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := readRange(r, bounds[i], bounds[i+1], chunkSize, w, &failed)
+			if err != nil {
+				once.Do(func() { firstErr = err })
+				failed.Store(true)
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// tenthsWorker is the Worker of Process, aggregating the stations of its
+// range in tenths of a degree
+type tenthsWorker struct {
+	stats map[string]*Tenths
+}
+
+func (w *tenthsWorker) BeforeRead(int) error { return nil }
+
+func (w *tenthsWorker) Chunk(chunk []byte, _ int64) error {
+	for len(chunk) > 0 {
+		station, value, rest := fastparse.ScanLine(chunk)
+		chunk = rest
+		t, n := fastparse.ParseTempTenths(value)
+		if station == nil || n != len(value) {
+			continue
+		}
+		v, ok := w.stats[string(station)]
+		if !ok {
+			v = &Tenths{}
+			w.stats[string(station)] = v
+		}
+		v.Add(int64(t))
+	}
+	return nil
+}
+
+func (w *tenthsWorker) Done() error { return nil }
+
+// Tenths is the aggregate of a station's measurements in tenths of a degree,
+// which unlike floats sum exactly
+type Tenths struct {
+	Min, Max, Count, Sum int64
+}
+
+// Add records a measurement
+func (v *Tenths) Add(t int64) {
+	if v.Count == 0 {
+		*v = Tenths{Min: t, Max: t, Count: 1, Sum: t}
+		return
+	}
+	v.Min = min(v.Min, t)
+	v.Max = max(v.Max, t)
+	v.Count++
+	v.Sum += t
+}
+
+// Merge records the measurements of another aggregate
+func (v *Tenths) Merge(other *Tenths) {
+	if v.Count == 0 {
+		*v = *other
+		return
+	}
+	v.Min = min(v.Min, other.Min)
+	v.Max = max(v.Max, other.Max)
+	v.Count += other.Count
+	v.Sum += other.Sum
+}
+
+// Mean returns the mean in tenths, rounded half up. Rounding the sum in
+// integers keeps means right on a half exact.
+func (v *Tenths) Mean() int64 {
+	// Half up is floor((sum + count/2) / count), kept in integers by
+	// doubling both
+	n, d := 2*v.Sum+v.Count, 2*v.Count
+	q := n / d
+	if n%d < 0 {
+		q--
+	}
+	return q
+}
+
+// Stat converts the aggregate to degrees
+func (v *Tenths) Stat() Stat {
+	return Stat{
+		Min:   float64(v.Min) / 10,
+		Mean:  float64(v.Mean()) / 10,
+		Max:   float64(v.Max) / 10,
+		Count: v.Count,
+	}
+}
+
+// inputSize returns the given size of the input, or else the size it reports
+func inputSize(r io.ReaderAt, size int64) (int64, error) {
+	if size > 0 {
+		return size, nil
+	}
+	switch r := r.(type) {
+	case interface{ Size() int64 }:
+		return r.Size(), nil
+	case interface{ Stat() (os.FileInfo, error) }:
+		info, err := r.Stat()
+		if err != nil {
+			return 0, fmt.Errorf("could not stat input: %w", err)
+		}
+		return info.Size(), nil
+	}
+	return 0, errors.New("unknown input size: set Options.Size")
+}
+
+// lineBounds returns the offsets splitting the input into about n ranges of
+// whole lines, from 0 to its size
+func lineBounds(r io.ReaderAt, size int64, n int) ([]int64, error) {
+	bounds := []int64{0}
+	for i := 1; i < n; i++ {
+		off := size * int64(i) / int64(n)
+		if off <= bounds[len(bounds)-1] {
+			continue
+		}
+		// Move the bound just past the new line ending the line before it
+		end, err := nextLine(r, off-1, size)
+		if err != nil {
+			return nil, err
+		}
+		if end < size && end > bounds[len(bounds)-1] {
+			bounds = append(bounds, end)
+		}
+	}
+	return append(bounds, size), nil
+}
+
+// nextLine returns the offset following the first new line at or after off,
+// or the size of the input if there is none
+func nextLine(r io.ReaderAt, off, size int64) (int64, error) {
+	var piece [128]byte
+	for off < size {
+		n, err := r.ReadAt(piece[:min(int64(len(piece)), size-off)], off)
+		if i := bytes.IndexByte(piece[:n], '\n'); i >= 0 {
+			return off + int64(i) + 1, nil
+		}
+		off += int64(n)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, fmt.Errorf("could not read at %d: %w", off, err)
+		}
+		if n == 0 {
+			break
+		}
+	}
+	return size, nil
+}
+
+// readRange reads the lines within [start, end) of the input in chunks ending
+// on line boundaries and hands them to the worker, until another worker fails
+func readRange(
+	r io.ReaderAt, start, end int64, chunkSize int, w Worker,
+	failed *atomic.Bool,
+) error {
+	buf := make([]byte, chunkSize)
+	for pos := start; pos < end; {
+		if failed.Load() {
+			return nil
+		}
+		n := min(int64(len(buf)), end-pos)
+		var chunk []byte
+		for {
+			if int64(len(buf)) < n {
+				buf = make([]byte, n)
+			}
+			if err := w.BeforeRead(int(n)); err != nil {
+				return err
+			}
+			read, err := r.ReadAt(buf[:n], pos)
+			if int64(read) < n {
+				if err == nil || errors.Is(err, io.EOF) {
+					err = io.ErrUnexpectedEOF
+				}
+				return fmt.Errorf("could not read at %d: %w", pos, err)
+			}
+			chunk = buf[:n]
+			if pos+n == end {
+				break
+			}
+			if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 {
+				chunk = chunk[:i+1]
+				break
+			}
+			// The line does not fit, so read it again with more room
+			n = min(2*n, end-pos)
+		}
+		if err := w.Chunk(chunk, pos); err != nil {
+			return err
+		}
+		pos += int64(len(chunk))
+	}
+	return w.Done()
+}
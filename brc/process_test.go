@@ -0,0 +1,140 @@
+package brc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcess(t *testing.T) {
+	inputs, err := filepath.Glob("../test/samples/*.txt")
+	require.NoError(t, err)
+	require.NotEmpty(t, inputs)
+	for _, input := range inputs {
+		want, err := os.ReadFile(strings.TrimSuffix(input, ".txt") + ".out")
+		require.NoError(t, err)
+		f, err := os.Open(input)
+		require.NoError(t, err)
+		defer f.Close()
+		for _, opts := range []Options{
+			{}, {Workers: 1}, {Workers: 3, ChunkSize: 7}, {Workers: 64, ChunkSize: 1},
+		} {
+			rs, err := Process(f, opts)
+			require.NoError(t, err, input)
+			got, err := rs.MarshalText()
+			require.NoError(t, err)
+			assert.Equal(
+				t, string(bytes.TrimSuffix(want, []byte("\n"))), string(got),
+				"%s %+v", input, opts,
+			)
+		}
+	}
+}
+
+func TestProcessInputs(t *testing.T) {
+	data := "Oslo;-3.0\nno separator\nAbha;1x\nAbha;12.5\nOslo;8.0"
+	rs, err := Process(strings.NewReader(data), Options{Workers: 2})
+	require.NoError(t, err)
+	assert.Equal(t, Results{
+		{"Abha", Stat{Min: 12.5, Mean: 12.5, Max: 12.5, Count: 1}},
+		{"Oslo", Stat{Min: -3, Mean: 2.5, Max: 8, Count: 2}},
+	}, rs)
+
+	rs, err = Process(strings.NewReader(""), Options{})
+	require.NoError(t, err)
+	assert.Empty(t, rs)
+
+	// Without a Size method the size has to be given
+	type readerAt struct{ io.ReaderAt }
+	_, err = Process(readerAt{strings.NewReader(data)}, Options{})
+	assert.Error(t, err)
+	rs, err = Process(readerAt{strings.NewReader(data)}, Options{Size: int64(len(data))})
+	require.NoError(t, err)
+	assert.Len(t, rs, 2)
+
+	// An input shorter than its size is an error rather than partial results
+	_, err = Process(strings.NewReader(data), Options{Size: int64(len(data)) + 10})
+	assert.Error(t, err)
+}
+
+func TestLineBounds(t *testing.T) {
+	data := []byte("a;1.0\nbbbbbbbbbbbbbbbbbbbbbbbbbbbb;2.0\nc;3.0\nd;4.0")
+	r := bytes.NewReader(data)
+	for n := 1; n <= len(data)+1; n++ {
+		bounds, err := lineBounds(r, int64(len(data)), n)
+		require.NoError(t, err, n)
+		assert.Equal(t, int64(0), bounds[0], n)
+		assert.Equal(t, int64(len(data)), bounds[len(bounds)-1], n)
+		assert.LessOrEqual(t, len(bounds)-1, n)
+		for i, b := range bounds[1 : len(bounds)-1] {
+			assert.Less(t, bounds[i], b, n)
+			assert.Equal(t, byte('\n'), data[b-1], "%d workers, bound %d", n, b)
+		}
+	}
+}
+
+// chunkWorker records the chunks handed to it, failing on the chunk at fail
+type chunkWorker struct {
+	data   []byte
+	chunks map[int64]string
+	fail   int64
+	done   bool
+}
+
+func (w *chunkWorker) BeforeRead(int) error { return nil }
+
+func (w *chunkWorker) Chunk(chunk []byte, off int64) error {
+	if off == w.fail {
+		return errors.New("failed")
+	}
+	w.chunks[off] = string(chunk)
+	return nil
+}
+
+func (w *chunkWorker) Done() error {
+	w.done = true
+	return nil
+}
+
+func TestReadRanges(t *testing.T) {
+	data := strings.Repeat("Oslo;1.0\nAbha;-12.5\n", 50)
+	var workers []*chunkWorker
+	err := ReadRanges(
+		strings.NewReader(data), Options{Workers: 4, ChunkSize: 16},
+		func() Worker {
+			w := &chunkWorker{chunks: map[int64]string{}, fail: -1}
+			workers = append(workers, w)
+			return w
+		},
+	)
+	require.NoError(t, err)
+	require.Len(t, workers, 4)
+	// The chunks of every range are whole lines at their offsets, and
+	// together make up the input
+	covered := 0
+	for _, w := range workers {
+		assert.True(t, w.done)
+		for off, chunk := range w.chunks {
+			assert.Equal(t, data[off:off+int64(len(chunk))], chunk)
+			assert.True(t, strings.HasSuffix(chunk, "\n"), chunk)
+			covered += len(chunk)
+		}
+	}
+	assert.Equal(t, len(data), covered)
+
+	err = ReadRanges(
+		strings.NewReader(data), Options{Workers: 2, ChunkSize: 16},
+		func() Worker { return &chunkWorker{chunks: map[int64]string{}} },
+	)
+	assert.EqualError(t, err, "failed")
+
+	_, err = Process(strings.NewReader(data), Options{Size: int64(len(data)) + 1})
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,132 @@
+package main
+
+import "bytes"
+
+// byteMapMinSlots is the smallest number of slots of a byte map
+const byteMapMinSlots = 16
+
+// byteMapMaxPrealloc caps the stations a byte map is sized for up front. Its
+// slots are much larger than those of a map of pointers, so with every worker
+// holding one, beyond this it grows as stations come rather than trusting the
+// estimate.
+const byteMapMaxPrealloc = 1 << 16
+
+// byteMap is an open-addressing hash table of station statistics keyed on
+// byte slices, so that workers neither build a string per line nor allocate
+// one per new station. Station names are packed one after the other in a
+// single buffer, and the statistics are held in the slots themselves.
+type byteMap struct {
+	slots []byteMapSlot
+	names []byte
+	count int
+	mask  uint64
+}
+
+type byteMapSlot struct {
+	hash  uint64
+	start uint32
+	end   uint32
+	used  bool
+	stat  stat
+}
+
+// newByteMap returns a table with room for the expected number of stations
+// before it has to grow
+func newByteMap(expected int) *byteMap {
+	size := byteMapMinSlots
+	for size*3/4 < min(expected, byteMapMaxPrealloc) {
+		size <<= 1
+	}
+	return &byteMap{slots: make([]byteMapSlot, size), mask: uint64(size - 1)}
+}
+
+// fnv1a is the FNV-1a hash of a station name
+func fnv1a(station []byte) uint64 {
+	h := uint64(14695981039346656037)
+	for _, c := range station {
+		h ^= uint64(c)
+		h *= 1099511628211
+	}
+	return h
+}
+
+// entry returns the statistics of a station, adding it with empty ones if it
+// is not in the table yet
+func (m *byteMap) entry(station []byte) (v *stat, found bool) {
+	h := fnv1a(station)
+	for i := h & m.mask; ; i = (i + 1) & m.mask {
+		s := &m.slots[i]
+		if !s.used {
+			if (m.count+1)*4 > len(m.slots)*3 {
+				m.grow()
+				return m.entry(station)
+			}
+			m.count++
+			start := len(m.names)
+			m.names = append(m.names, station...)
+			*s = byteMapSlot{
+				hash: h, start: uint32(start), end: uint32(len(m.names)),
+				used: true,
+			}
+			return &s.stat, false
+		}
+		if s.hash == h && bytes.Equal(m.names[s.start:s.end], station) {
+			return &s.stat, true
+		}
+	}
+}
+
+// add records a temperature in tenths for a station
+func (m *byteMap) add(station []byte, tenths int64) {
+	v, _ := m.entry(station)
+	v.Add(tenths)
+}
+
+// merge adds the statistics of a station from another table
+func (m *byteMap) merge(station []byte, other stat) {
+	v, _ := m.entry(station)
+	v.Merge(&other)
+}
+
+// grow doubles the number of slots, placing the stations anew by their hash
+func (m *byteMap) grow() {
+	old := m.slots
+	m.slots = make([]byteMapSlot, 2*len(old))
+	m.mask = uint64(len(m.slots) - 1)
+	for _, s := range old {
+		if !s.used {
+			continue
+		}
+		i := s.hash & m.mask
+		for m.slots[i].used {
+			i = (i + 1) & m.mask
+		}
+		m.slots[i] = s
+	}
+}
+
+// len returns the number of stations in the table
+func (m *byteMap) len() int {
+	return m.count
+}
+
+// toMap converts the table into a regular stats map, to hand the statistics
+// over to the aggregator
+func (m *byteMap) toMap() map[string]*stat {
+	stats := make(map[string]*stat, m.count)
+	for i := range m.slots {
+		s := &m.slots[i]
+		if s.used {
+			v := s.stat
+			stats[string(m.names[s.start:s.end])] = &v
+		}
+	}
+	return stats
+}
+
+// reset empties the table for reuse, keeping its slots
+func (m *byteMap) reset() {
+	clear(m.slots)
+	m.names = m.names[:0]
+	m.count = 0
+}
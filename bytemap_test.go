@@ -0,0 +1,44 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestByteMapDifferential checks the byte map against a plain map as it grows
+// from its smallest size, and after being reset
+func TestByteMapDifferential(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var stations [][]byte
+	for n := 0; n <= 10_000; n++ {
+		stations = append(stations, randomStation(rng, 1+n%100))
+	}
+	m := newByteMap(0)
+	for _, count := range []int{1, 100, 10_000} {
+		want := map[string]*stat{}
+		for range 100_000 {
+			station := stations[rng.Intn(count)]
+			tenths := int64(rng.Intn(1999) - 999)
+			addStat(want, station, tenths)
+			m.add(station, tenths)
+		}
+		assert.Equal(t, len(want), m.len(), count)
+		assert.Equal(t, want, m.toMap(), count)
+		m.reset()
+		assert.Zero(t, m.len())
+		assert.Empty(t, m.toMap())
+	}
+}
+
+func TestByteMapMerge(t *testing.T) {
+	m := newByteMap(0)
+	m.add([]byte("Abha"), 15)
+	m.merge([]byte("Abha"), stat{Count: 2, Min: -30, Max: 20, Sum: -10})
+	m.merge([]byte("Ber"), stat{Count: 1, Min: 40, Max: 40, Sum: 40})
+	assert.Equal(t, map[string]*stat{
+		"Abha": {Count: 3, Min: -30, Max: 20, Sum: 5},
+		"Ber":  {Count: 1, Min: 40, Max: 40, Sum: 40},
+	}, m.toMap())
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// cardinalitySampleSize is the size of the input prefix sampled to estimate
+// the number of distinct stations
+const cardinalitySampleSize = 1024 * 1024 // 1 MiB
+
+// maxPreallocStations caps the estimated cardinality used for preallocation,
+// so a bad estimate cannot allocate huge tables up front
+const maxPreallocStations = 1 << 20
+
+// estimateStations returns the expected number of distinct stations in the
+// input, from the -expect-stations override if given or else by sampling a
+// prefix of the file
+func estimateStations(fpath string) (int, error) {
+	if *expectStations > 0 {
+		return *expectStations, nil
+	}
+	if fpath == stdinInput {
+		// The size of stdin is unknown, so the sample is taken as complete
+		sample, err := peekStdin(cardinalitySampleSize)
+		if err != nil {
+			return 0, err
+		}
+		return extrapolateStations(sample, -1), nil
+	}
+	f, err := os.Open(fpath)
+	if err != nil {
+		return 0, fmt.Errorf("could not open file: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("could not stat file: %w", err)
+	}
+	sample := make([]byte, cardinalitySampleSize)
+	n, err := io.ReadFull(f, sample)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) &&
+		!errors.Is(err, io.EOF) {
+		return 0, fmt.Errorf("error reading file: %w", err)
+	}
+	return extrapolateStations(sample[:n], info.Size()), nil
+}
+
+// extrapolateStations estimates the distinct stations of a file of the given
+// size from a sample of its first lines. If stations repeat often within the
+// sample the set is assumed to be complete, otherwise distinct stations are
+// assumed to keep appearing at the same rate through the rest of the file.
+func extrapolateStations(sample []byte, size int64) int {
+	if i := bytes.LastIndexByte(sample, '\n'); i >= 0 {
+		sample = sample[:i+1]
+	}
+	sampled := int64(len(sample))
+	seen := make(map[string]struct{})
+	lines := 0
+	for len(sample) > 0 {
+		i := bytes.IndexByte(sample, '\n')
+		if i < 0 {
+			break
+		}
+		if j := bytes.IndexByte(sample[:i], ';'); j >= 0 {
+			seen[string(sample[:j])] = struct{}{}
+		}
+		lines++
+		sample = sample[i+1:]
+	}
+	distinct := len(seen)
+	if distinct == 0 || distinct*4 <= lines {
+		return distinct
+	}
+	if size <= sampled {
+		return distinct
+	}
+	return int(min(int64(distinct)*size/sampled, maxPreallocStations))
+}
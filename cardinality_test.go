@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtrapolateStations(t *testing.T) {
+	var repeated, unique strings.Builder
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&repeated, "station%d;1.0\n", i%10)
+		fmt.Fprintf(&unique, "station%d;1.0\n", i)
+	}
+	size := int64(unique.Len())
+	tests := []struct {
+		name   string
+		sample string
+		size   int64
+		want   int
+	}{
+		{"empty", "", 0, 0},
+		{"repeated stations", repeated.String(), 100 * size, 10},
+		{"whole file sampled", unique.String(), size, 1000},
+		{"unique stations", unique.String(), 10 * size, 10000},
+		{"partial last line", "a;1.0\nb;2.0\nc;3", 12, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := extrapolateStations([]byte(tt.sample), tt.size)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Chaos options inject faults into the pipeline to exercise its error paths.
+// They are left out of the usage. The documented behavior is:
+//
+//   - a slow reader only slows the run down, until -timeout aborts it
+//   - a dropped chunk is caught as lost input and fails the run
+//   - a panicking worker fails the run with the panic instead of crashing
+const chaosPrefix = "chaos-"
+
+var chaosSlowReader = flag.Duration(
+	"chaos-slow-reader", 0, "sleep this long before handing out each chunk",
+)
+var chaosDropChunk = flag.Int(
+	"chaos-drop-chunk", 0, "drop every nth chunk handed out",
+)
+var chaosWorkerPanic = flag.Int(
+	"chaos-worker-panic", 0, "panic in each worker on its nth chunk",
+)
+
+// printDefaults prints the defaults of all flags but the chaos options
+func printDefaults(fs *flag.FlagSet) {
+	visible := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	visible.SetOutput(fs.Output())
+	fs.VisitAll(func(f *flag.Flag) {
+		if !strings.HasPrefix(f.Name, chaosPrefix) {
+			visible.Var(f.Value, f.Name, f.Usage)
+			visible.Lookup(f.Name).DefValue = f.DefValue
+		}
+	})
+	visible.PrintDefaults()
+}
+
+// chunkCounts accounts for the bytes handed out to the workers and received
+// by them, so that input lost in between fails the run. If workers report
+// where lines are, it also carries where each chunk comes from.
+type chunkCounts struct {
+	sent, received atomic.Int64
+	chunks         atomic.Int64
+	bad            *badLines
+	trackOrigins   bool
+	origins        sync.Map
+	watchdog       *watchdog
+	stages         *pipelineStages
+}
+
+// send hands a chunk to the workers
+func (c *chunkCounts) send(
+	ctx context.Context, chunkChan chan<- []byte, chunk []byte,
+) error {
+	_, err := c.deliver(ctx, chunkChan, chunk)
+	return err
+}
+
+// deliver hands a chunk to the workers like send, reporting whether a worker
+// got it rather than it being dropped or the run cancelled first
+func (c *chunkCounts) deliver(
+	ctx context.Context, chunkChan chan<- []byte, chunk []byte,
+) (bool, error) {
+	if err := c.watchdog.throttle(ctx, chunkChan); err != nil {
+		return false, err
+	}
+	if keep, err := c.handOut(ctx, chunk); !keep || err != nil {
+		return false, err
+	}
+	if c.stages != nil {
+		c.stages.sampleDepth(len(chunkChan))
+		c.stages.reader.items.Add(1)
+		defer func(start time.Time) {
+			c.stages.reader.wait.Add(int64(time.Since(start)))
+		}(time.Now())
+	}
+	select {
+	case chunkChan <- chunk:
+		return true, nil
+	case <-ctx.Done():
+		c.sent.Add(-int64(len(chunk)))
+		return false, ctx.Err()
+	}
+}
+
+// handOut accounts for a chunk about to be handed to the workers, once a slow
+// reader has waited. It returns false if the chunk is to be dropped instead.
+func (c *chunkCounts) handOut(ctx context.Context, chunk []byte) (bool, error) {
+	if *chaosSlowReader > 0 {
+		select {
+		case <-time.After(*chaosSlowReader):
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+	c.sent.Add(int64(len(chunk)))
+	n := c.chunks.Add(1)
+	return *chaosDropChunk <= 0 || n%int64(*chaosDropChunk) != 0, nil
+}
+
+// check returns an error if not all bytes handed out were received
+func (c *chunkCounts) check() error {
+	if lost := c.sent.Load() - c.received.Load(); lost != 0 {
+		return fmt.Errorf(
+			"lost %d bytes of input between the reader and the workers", lost,
+		)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testChaos evaluates a sample input in small chunks with every strategy and
+// returns the errors
+func testChaos(t *testing.T, ctx context.Context) map[string]error {
+	defer func(s string, n int) { *strategy, chunkSize = s, n }(*strategy, chunkSize)
+	chunkSize = 4096
+	input := filepath.Join(sampleInputDir, "measurements-10000-unique-keys.txt")
+	errs := make(map[string]error)
+	for _, s := range []string{strategyStream, strategyMmap, strategyReadAt} {
+		*strategy = s
+		var out strings.Builder
+		errs[s] = eval(ctx, input, &out)
+	}
+	return errs
+}
+
+func TestChaosSlowReader(t *testing.T) {
+	defer func(d time.Duration) { *chaosSlowReader = d }(*chaosSlowReader)
+	*chaosSlowReader = time.Millisecond
+	t.Run("results", testSamples)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	for s, err := range testChaos(t, ctx) {
+		assert.ErrorIs(t, err, context.DeadlineExceeded, s)
+	}
+}
+
+func TestChaosDropChunk(t *testing.T) {
+	defer func(n int) { *chaosDropChunk = n }(*chaosDropChunk)
+	*chaosDropChunk = 3
+	for s, err := range testChaos(t, context.Background()) {
+		assert.ErrorContains(t, err, "lost", s)
+	}
+}
+
+func TestChaosWorkerPanic(t *testing.T) {
+	defer func(n int) { *chaosWorkerPanic = n }(*chaosWorkerPanic)
+	*chaosWorkerPanic = 2
+	for s, err := range testChaos(t, context.Background()) {
+		assert.ErrorContains(t, err, "worker panicked: chaos: worker panic", s)
+	}
+}
+
+func TestChaosDropChunkForgetsOrigins(t *testing.T) {
+	defer func(n int) { *chaosDropChunk = n }(*chaosDropChunk)
+	*chaosDropChunk = 1
+	counts := &chunkCounts{trackOrigins: true}
+	chunkChan := make(chan []byte, 1)
+	origin := chunkOrigin{input: "measurements.txt"}
+	assert.NoError(t, counts.sendFrom(
+		context.Background(), chunkChan, []byte("Oslo;1.0\n"), origin,
+	))
+
+	*chaosDropChunk = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, counts.sendFrom(
+		ctx, make(chan []byte), []byte("Oslo;2.0\n"), origin,
+	), context.Canceled)
+
+	counts.origins.Range(func(key, _ any) bool {
+		t.Errorf("origin of %v kept after its chunk was not handed out", key)
+		return true
+	})
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// cleaner writes a normalized copy of the input as it is aggregated: only the
+// lines that parse, with station names trimmed, values with exactly one
+// decimal and LF line endings. The copy is compressed with zstd if its name
+// ends in .zst.
+type cleaner struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *zstd.Encoder
+	w   *bufio.Writer
+	err error
+}
+
+// newCleaner creates the file the cleaned copy is written to
+func newCleaner(fpath string) (*cleaner, error) {
+	f, err := os.Create(fpath)
+	if err != nil {
+		return nil, fmt.Errorf("could not create clean file: %w", err)
+	}
+	c := &cleaner{f: f}
+	var w io.Writer = f
+	if filepath.Ext(fpath) == ".zst" {
+		if c.enc, err = zstd.NewWriter(f); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("could not compress clean file: %w", err)
+		}
+		w = c.enc
+	}
+	c.w = bufio.NewWriter(w)
+	return c, nil
+}
+
+// write appends lines that a worker cleaned
+func (c *cleaner) write(lines []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		_, c.err = c.w.Write(lines)
+	}
+}
+
+// close flushes and closes the clean file, returning the first error any write
+// ran into
+func (c *cleaner) close() error {
+	firstErr := c.err
+	if err := c.w.Flush(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	if c.enc != nil {
+		if err := c.enc.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if err := c.f.Close(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+// utf8BOM is the byte order mark some editors start files with
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// cleanFields normalizes the fields of a line before it is parsed: a byte
+// order mark, surrounding whitespace and a carriage return are removed
+func cleanFields(station, value []byte) ([]byte, []byte) {
+	station = bytes.TrimPrefix(station, utf8BOM)
+	return bytes.TrimSpace(station), bytes.TrimSpace(value)
+}
+
+// appendCleanLine appends a parsed line in its normalized form
+func appendCleanLine(buf []byte, station []byte, tenths int16) []byte {
+	buf = append(buf, station...)
+	buf = append(buf, ';')
+	buf = strconv.AppendFloat(buf, float64(tenths)/10, 'f', 1, 64)
+	return append(buf, '\n')
+}
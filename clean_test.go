@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvalCleanOut(t *testing.T) {
+	defer func(s string) { *cleanOut = s }(*cleanOut)
+	dir := t.TempDir()
+	input := filepath.Join(dir, "dirty.txt")
+	require.NoError(t, os.WriteFile(input, []byte(
+		"\xef\xbb\xbfOslo;1.5\r\n"+
+			"\tAbha ;30.0 \n"+
+			"not a line\n"+
+			";2.0\n"+
+			"Oslo;-3.25\n"+
+			"Oslo;-3.0\r\n",
+	), 0o644))
+
+	for _, name := range []string{"clean.txt", "clean.zst"} {
+		t.Run(name, func(t *testing.T) {
+			*cleanOut = filepath.Join(dir, name)
+			var out strings.Builder
+			require.NoError(t, eval(context.Background(), input, &out))
+			assert.Equal(t,
+				"{Abha=30.0/30.0/30.0, Oslo=-3.0/-0.7/1.5}\n", out.String(),
+			)
+
+			f, err := os.Open(*cleanOut)
+			require.NoError(t, err)
+			defer f.Close()
+			var r io.Reader = f
+			if filepath.Ext(name) == ".zst" {
+				d, err := zstd.NewReader(f)
+				require.NoError(t, err)
+				defer d.Close()
+				r = d
+			}
+			cleaned, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.ElementsMatch(t,
+				[]string{"Oslo;1.5", "Abha;30.0", "Oslo;-3.0"},
+				strings.Fields(string(cleaned)),
+			)
+
+			// The cleaned copy gives the same results
+			*cleanOut = ""
+			var again strings.Builder
+			require.NoError(t, eval(
+				context.Background(), filepath.Join(dir, name), &again,
+			))
+			assert.Equal(t, out.String(), again.String())
+		})
+	}
+}
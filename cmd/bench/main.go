@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var input = flag.String("input", "", "measurements file to run -cmd on")
+var command = flag.String(
+	"cmd", "1brc",
+	"command to benchmark, run with -input, -format jsonl and -gcstats "+
+		"appended",
+)
+var runs = flag.Int("runs", 5, "number of times to run -cmd")
+var dropCachesFlag = flag.Bool(
+	"drop-caches", false,
+	"drop the page cache before every run, so that the input is read from "+
+		"disk (linux only, needs root)",
+)
+var jsonOut = flag.Bool(
+	"json", false, "print the runs and their median as JSON instead of a table",
+)
+
+// run is what a single run of the command took
+type run struct {
+	Wall       float64 `json:"wall_seconds"`
+	Rows       int64   `json:"rows"`
+	RowsPerSec float64 `json:"rows_per_second"`
+	// PeakRSS is 0 where the platform does not report it
+	PeakRSS  int64   `json:"peak_rss_bytes"`
+	GCCycles uint32  `json:"gc_cycles"`
+	GCPause  float64 `json:"gc_pause_seconds"`
+}
+
+// summary is the runs of a benchmark with the median of each measure
+type summary struct {
+	Command string `json:"command"`
+	Input   string `json:"input"`
+	Runs    []run  `json:"runs"`
+	Median  run    `json:"median"`
+}
+
+func main() {
+	flag.Parse()
+
+	if *input == "" || *runs < 1 {
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	s := summary{Command: *command, Input: *input}
+	for i := range *runs {
+		if *dropCachesFlag {
+			if err := dropCaches(); err != nil {
+				log.Fatal("could not drop the page cache: ", err)
+			}
+		}
+		r, err := runCommand(*command, *input)
+		if err != nil {
+			log.Fatalf("run %d: %v", i+1, err)
+		}
+		s.Runs = append(s.Runs, r)
+	}
+	s.Median = median(s.Runs)
+
+	var err error
+	if *jsonOut {
+		err = writeJSON(os.Stdout, s)
+	} else {
+		err = writeTable(os.Stdout, s)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// runCommand runs the command on the measurements file once and measures it
+func runCommand(command, input string) (run, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return run{}, errors.New("empty command")
+	}
+	cmd := exec.Command(args[0], append(
+		args[1:], "-input", input, "-format", "jsonl", "-gcstats",
+	)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	start := time.Now()
+	err := cmd.Run()
+	wall := time.Since(start).Seconds()
+	if err != nil {
+		return run{}, fmt.Errorf("%s: %w\n%s", command, err, stderr.Bytes())
+	}
+	r, err := parseRun(&stdout, &stderr)
+	if err != nil {
+		return run{}, fmt.Errorf("%s: %w", command, err)
+	}
+	r.Wall = wall
+	r.RowsPerSec = float64(r.Rows) / wall
+	r.PeakRSS = peakRSS(cmd.ProcessState)
+	return r, nil
+}
+
+// gcLine is the line -gcstats prints to stderr
+var gcLine = regexp.MustCompile(`(?m)^gc: (\d+) cycles, ([0-9.]+) s paused`)
+
+// parseRun sums the counts of the stations the command wrote as JSON Lines and
+// reads the garbage collection work it printed
+func parseRun(stdout, stderr io.Reader) (run, error) {
+	var r run
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var station struct {
+			Count int64 `json:"count"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &station); err != nil {
+			return run{}, fmt.Errorf("could not parse output: %w", err)
+		}
+		r.Rows += station.Count
+	}
+	if err := scanner.Err(); err != nil {
+		return run{}, fmt.Errorf("could not read output: %w", err)
+	}
+	text, err := io.ReadAll(stderr)
+	if err != nil {
+		return run{}, err
+	}
+	m := gcLine.FindSubmatch(text)
+	if m == nil {
+		return run{}, errors.New("no garbage collection stats on stderr")
+	}
+	cycles, _ := strconv.ParseUint(string(m[1]), 10, 32)
+	r.GCCycles = uint32(cycles)
+	r.GCPause, _ = strconv.ParseFloat(string(m[2]), 64)
+	return r, nil
+}
+
+// median returns the median of each measure of the runs, the lower of the
+// middle two for an even number of them
+func median(runs []run) run {
+	mid := func(values []float64) float64 {
+		slices.Sort(values)
+		return values[(len(values)-1)/2]
+	}
+	var wall, rows, rate, rss, cycles, pause []float64
+	for _, r := range runs {
+		wall = append(wall, r.Wall)
+		rows = append(rows, float64(r.Rows))
+		rate = append(rate, r.RowsPerSec)
+		rss = append(rss, float64(r.PeakRSS))
+		cycles = append(cycles, float64(r.GCCycles))
+		pause = append(pause, r.GCPause)
+	}
+	return run{
+		Wall:       mid(wall),
+		Rows:       int64(mid(rows)),
+		RowsPerSec: mid(rate),
+		PeakRSS:    int64(mid(rss)),
+		GCCycles:   uint32(mid(cycles)),
+		GCPause:    mid(pause),
+	}
+}
+
+// writeJSON writes the summary as an indented JSON object
+func writeJSON(w io.Writer, s summary) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// writeTable writes a row per run and one with the medians
+func writeTable(w io.Writer, s summary) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "run\twall\trows/s\tpeak rss\tgc cycles\tgc pause\t")
+	row := func(name string, r run) {
+		rss := "-"
+		if r.PeakRSS > 0 {
+			rss = fmt.Sprintf("%.1f MiB", float64(r.PeakRSS)/(1<<20))
+		}
+		fmt.Fprintf(
+			tw, "%s\t%.3f s\t%.0f\t%s\t%d\t%.3f s\t\n",
+			name, r.Wall, r.RowsPerSec, rss, r.GCCycles, r.GCPause,
+		)
+	}
+	for i, r := range s.Runs {
+		row(strconv.Itoa(i+1), r)
+	}
+	row("median", s.Median)
+	return tw.Flush()
+}
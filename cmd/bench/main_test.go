@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRun(t *testing.T) {
+	stdout := `{"station":"Abha","min":-23,"mean":18,"max":59.2,"count":3}` + "\n" +
+		`{"station":"Oslo","min":-3,"mean":1.5,"max":8,"count":1000000}` + "\n"
+	stderr := "2026/10/15 14:00:00 some log\ngc: 12 cycles, 0.004 s paused\n"
+	r, err := parseRun(strings.NewReader(stdout), strings.NewReader(stderr))
+	require.NoError(t, err)
+	assert.Equal(t, run{Rows: 1000003, GCCycles: 12, GCPause: 0.004}, r)
+
+	_, err = parseRun(strings.NewReader(stdout), strings.NewReader(""))
+	assert.ErrorContains(t, err, "no garbage collection stats")
+	_, err = parseRun(
+		strings.NewReader("{Abha=-23.0/18.0/59.2}\n"), strings.NewReader(stderr),
+	)
+	assert.ErrorContains(t, err, "could not parse output")
+}
+
+func TestMedian(t *testing.T) {
+	runs := []run{
+		{Wall: 3, Rows: 10, RowsPerSec: 3.3, PeakRSS: 300, GCCycles: 1, GCPause: 0.3},
+		{Wall: 1, Rows: 10, RowsPerSec: 10, PeakRSS: 100, GCCycles: 3, GCPause: 0.1},
+		{Wall: 2, Rows: 10, RowsPerSec: 5, PeakRSS: 200, GCCycles: 2, GCPause: 0.2},
+	}
+	assert.Equal(
+		t,
+		run{Wall: 2, Rows: 10, RowsPerSec: 5, PeakRSS: 200, GCCycles: 2, GCPause: 0.2},
+		median(runs),
+	)
+	// An even number of runs takes the lower middle one
+	assert.Equal(t, 1.0, median(runs[:2]).Wall)
+}
+
+func TestWriteTable(t *testing.T) {
+	s := summary{Runs: []run{
+		{Wall: 1.5, RowsPerSec: 1000, PeakRSS: 3 << 20, GCCycles: 2, GCPause: 0.01},
+		{Wall: 2, RowsPerSec: 500},
+	}}
+	s.Median = median(s.Runs)
+	var out strings.Builder
+	require.NoError(t, writeTable(&out, s))
+	assert.Equal(t, ""+
+		"     run     wall  rows/s  peak rss  gc cycles  gc pause\n"+
+		"       1  1.500 s    1000   3.0 MiB          2   0.010 s\n"+
+		"       2  2.000 s     500         -          0   0.000 s\n"+
+		"  median  1.500 s     500         -          0   0.000 s\n",
+		out.String(),
+	)
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// dropCaches writes out dirty pages and drops the page cache, so that the next
+// run reads its input from disk
+func dropCaches() error {
+	syscall.Sync()
+	return os.WriteFile("/proc/sys/vm/drop_caches", []byte("3"), 0)
+}
+
+// peakRSS returns the peak resident set size of an exited process in bytes
+func peakRSS(state *os.ProcessState) int64 {
+	usage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0
+	}
+	// Linux reports it in KiB
+	return usage.Maxrss * 1024
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// dropCaches is only implemented on Linux, which can be told to drop the page
+// cache through /proc
+func dropCaches() error {
+	return errors.New("-drop-caches is only supported on linux")
+}
+
+// peakRSS is only reported on Linux, so it is unknown elsewhere
+func peakRSS(state *os.ProcessState) int64 {
+	return 0
+}
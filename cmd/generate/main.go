@@ -17,9 +17,23 @@ type weatherStation struct {
 	meanTemp float64
 }
 
-func (w weatherStation) measurement() int {
-	m := rand.NormFloat64()*10 + w.meanTemp
-	return int(math.Ceil(m * 10))
+// measurement returns a temperature of the station in tenths of a degree,
+// normally distributed around its mean and rounded half up like the official
+// generator's Math.round
+func (w weatherStation) measurement(rng *rand.Rand) int {
+	m := rng.NormFloat64()*10 + w.meanTemp
+	return int(math.Floor(m*10 + 0.5))
+}
+
+// appendTenths appends a temperature given in tenths of a degree with one
+// decimal, keeping the sign of those between -1 and 0
+func appendTenths(b []byte, tenths int) []byte {
+	if tenths < 0 {
+		b = append(b, '-')
+		tenths = -tenths
+	}
+	b = strconv.AppendInt(b, int64(tenths/10), 10)
+	return append(b, '.', byte('0'+tenths%10))
 }
 
 var stations = []weatherStation{
@@ -438,14 +452,21 @@ var stations = []weatherStation{
 	{"Zürich", 9.3},
 }
 
-var size = flag.Int("size", 0, "number of records to create")
+var rows = flag.Int("rows", 0, "number of rows to create")
 var out = flag.String("out", "measurements.txt", "file to write to")
 var cpuprofile = flag.String("cpuprofile", "", "write cpu profile to file")
+var seed = flag.Int64(
+	"seed", 0, "seed for the measurements (0 for a random seed, logged)",
+)
+
+func init() {
+	flag.Var(flag.Lookup("rows").Value, "size", "alias for -rows")
+}
 
 func main() {
 	flag.Parse()
 
-	if *size <= 0 {
+	if *rows <= 0 {
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
@@ -468,10 +489,17 @@ func main() {
 	}
 	defer f.Close()
 
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	log.Printf("generating measurements with -seed %d\n", *seed)
+	rng := rand.New(rand.NewSource(*seed))
+
 	start := time.Now()
 	w := bufio.NewWriter(f)
 	defer w.Flush()
-	for i := 0; i < *size; i++ {
+	var line []byte
+	for i := 0; i < *rows; i++ {
 		if i > 0 && i%50_000_000 == 0 {
 			log.Printf(
 				"wrote %d measurements in %.1f s\n",
@@ -479,19 +507,19 @@ func main() {
 				time.Now().Sub(start).Abs().Seconds(),
 			)
 		}
-		station := stations[rand.Intn(len(stations))]
-		temp := station.measurement()
-		_, err := w.WriteString(station.id + ";" +
-			strconv.Itoa(temp/10) + "." +
-			strconv.Itoa(int(math.Abs(float64(temp%10)))) + "\n")
-		if err != nil {
+		station := stations[rng.Intn(len(stations))]
+		temp := station.measurement(rng)
+		line = append(line[:0], station.id...)
+		line = append(line, ';')
+		line = append(appendTenths(line, temp), '\n')
+		if _, err := w.Write(line); err != nil {
 			log.Fatal("error writing measurements: ", err)
 		}
 	}
 
 	log.Printf(
 		"created file with %d measurements in %.1f s\n",
-		*size,
+		*rows,
 		time.Now().Sub(start).Abs().Seconds(),
 	)
 }
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppendTenths(t *testing.T) {
+	for tenths, want := range map[int]string{
+		0: "0.0", 5: "0.5", -5: "-0.5", -10: "-1.0", 123: "12.3", -999: "-99.9",
+	} {
+		assert.Equal(t, want, string(appendTenths(nil, tenths)))
+	}
+}
+
+func TestMeasurement(t *testing.T) {
+	// Every measurement parses back to the tenths it was generated as
+	rng := rand.New(rand.NewSource(1))
+	for range 10_000 {
+		temp := stations[0].measurement(rng)
+		v, err := strconv.ParseFloat(string(appendTenths(nil, temp)), 64)
+		assert.NoError(t, err)
+		assert.Equal(t, float64(temp)/10, v)
+	}
+}
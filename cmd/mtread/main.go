@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -11,17 +12,51 @@ import (
 	"runtime"
 	"runtime/pprof"
 	"sync"
+	"time"
+	"unsafe"
+)
+
+// Page sizes that chunks may be aligned to
+const (
+	pageSize     int64 = 4 * 1024
+	hugePageSize int64 = 2 * 1024 * 1024
+)
+
+// Read modes
+const (
+	modeRead     = "read"
+	modeSendfile = "sendfile"
+	modeSplice   = "splice"
 )
 
 // Set chunk size
-const chunkSize int64 = 64 * 1024 * 1024
+var chunkSize int64 = 64 * 1024 * 1024
 
 var input = flag.String("input", "", "file to read")
 var jobs = flag.Int("jobs", runtime.NumCPU(), "number of concurrent jobs")
 var cpuprofile = flag.String("cpuprofile", "", "file to read cpu profile to ")
+var hugePages = flag.Bool("hugepages", false, "align chunks to 2 MiB pages")
+var reportPath = flag.String(
+	"report", "",
+	"write a JSON report of the run, with the effective alignment, to file",
+)
+var mode = flag.String(
+	"mode", modeRead,
+	"how to copy the file: read, sendfile or splice (stdout must be a pipe)",
+)
 
 func main() {
 	flag.Parse()
+	// Exit only once run has returned, so its deferred profile, throughput
+	// and report are written even when the copy fails
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+// run copies the input to stdout as the flags ask
+func run() error {
 	// Profiling
 	if *cpuprofile != "" {
 		f, err := os.Create(*cpuprofile)
@@ -34,27 +69,77 @@ func main() {
 		}
 		defer pprof.StopCPUProfile()
 	}
+	// Align chunk offsets and lengths to pages
+	align := pageSize
+	if *hugePages {
+		align = hugePageSize
+	}
+	chunkSize = alignUp(chunkSize, align)
+	fmt.Fprintf(
+		os.Stderr, "alignment: %d bytes, chunk size: %d bytes\n",
+		align, chunkSize,
+	)
+
 	// Open the file
 	file, err := os.Open(*input)
 	if err != nil {
-		fmt.Println("Error:", err)
-		return
+		return err
 	}
 	defer file.Close()
 
 	// Get the file size
 	fileInfo, err := file.Stat()
 	if err != nil {
-		fmt.Println("Error getting file info:", err)
-		return
+		return fmt.Errorf("could not get file info: %w", err)
 	}
 	fileSize := fileInfo.Size()
 
+	start := time.Now()
+	sequential := false
+	defer func() {
+		elapsed := time.Since(start).Seconds()
+		fmt.Fprintf(
+			os.Stderr, "%s: %d bytes in %.3f s (%.1f MiB/s)\n",
+			*mode, fileSize, elapsed,
+			float64(fileSize)/elapsed/(1024*1024),
+		)
+		if *reportPath == "" {
+			return
+		}
+		r := runReport{
+			Mode: *mode, Sequential: sequential, Jobs: *jobs,
+			Alignment: align, ChunkSize: chunkSize, Bytes: fileSize,
+			Elapsed: elapsed,
+		}
+		if err := r.write(*reportPath); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+		}
+	}()
+
+	// Pipes and some FUSE filesystems cannot be read at offsets, so read
+	// them sequentially instead
+	if !canReadAt(file, fileInfo) {
+		fmt.Fprintln(
+			os.Stderr, "input cannot be read at offsets, reading it sequentially",
+		)
+		sequential = true
+		n, err := io.Copy(os.Stdout, file)
+		fileSize = n
+		return err
+	}
+
+	// Copy the file in the kernel without touching userspace
+	if *mode != modeRead {
+		_, err := passthrough(*mode, file, os.Stdout, fileSize)
+		return err
+	}
+
 	// Get number of chunks and chunks per reader
 	chunks := (fileSize + chunkSize - 1) / chunkSize
 	chunksPerReader := (chunks + int64(*jobs) - 1) / int64(*jobs)
 
 	out := make(chan []byte)
+	errs := make(chan error, *jobs)
 	var wg sync.WaitGroup
 	for i := 0; i < *jobs; i++ {
 		wg.Add(1)
@@ -65,81 +150,192 @@ func main() {
 			start := int64(i) * chunksPerReader * chunkSize
 			end := start + chunksPerReader*chunkSize
 			end = min(end, fileSize)
-			// Buffer to read chunks into
-			buf := make([]byte, chunkSize)
-
-			// Read file by chunks
-			for pos, n := start, 0; pos < end; pos += int64(n) {
-				// Read a chunk
-				n, err = file.ReadAt(buf, pos)
-				if err != nil && !errors.Is(err, io.EOF) {
-					panic(err)
-				}
-
-				// Don't read past chunk limits
-				n = min(n, int(end-pos))
-				buf = buf[:n]
-
-				// If no bytes were read, break the loop
-				if n == 0 {
-					break
-				}
-
-				// If not the first chunk in the file and is
-				// first chunk in this worker, read from after
-				// the first new line
-				//
-				// aaa;1.2
-				// bbb;3.4
-				// ccc;5.6
-				//
-				// The above example may be split into chunks
-				// as follows below
-				//
-				// aaa;1.2
-				//  +--- chunk split here
-				//  |
-				//  v
-				// bbb;3.4
-				// ccc;5.6
-				//
-				// worker 1          | worker 2
-				// [(chunk1, chunk2) | (chunk3, chunk4)]
-				// ...aaa;1.2\nbb    | b;3.4\nccc;...
-				//
-				// In this case, we want worker 1 to read the
-				// full line of bbb and worker 2 to start
-				// reading at ccc.
-				if pos != 0 && pos == start {
-					i := bytes.Index(buf, []byte{'\n'})
-					buf = buf[i+1:]
-				}
-				_, err := file.Seek(pos+int64(n), 0)
-				reader := bufio.NewReader(file)
-				overflow, err := reader.ReadBytes('\n')
-				if err != nil && !errors.Is(err, io.EOF) {
-					panic(err)
-				}
-
-				send := make([]byte, len(buf))
-				copy(send, buf)
-				send = append(send, overflow...)
-				n += len(overflow)
-
-				out <- send
+			// Page aligned buffer to read chunks into
+			buf := alignedBuffer(chunkSize, align)
 
+			if err := readRange(file, start, end, buf, out); err != nil {
+				errs <- err
 			}
 		}(i)
 	}
 
-	done := make(chan bool)
+	done := make(chan error)
 	go func() {
+		w := bufio.NewWriter(os.Stdout)
+		var err error
 		for data := range out {
-			fmt.Print(string(data))
+			// Keep draining after a failed write so the readers finish
+			if err == nil {
+				_, err = w.Write(data)
+			}
 		}
-		done <- true
+		if err == nil {
+			err = w.Flush()
+		}
+		done <- err
 	}()
 	wg.Wait()
 	close(out)
-	<-done
+	writeErr := <-done
+	close(errs)
+	if err := <-errs; err != nil {
+		return err
+	}
+	return writeErr
+}
+
+// runReport describes a run, notably the alignment its reads ended up with
+type runReport struct {
+	Mode string `json:"mode"`
+	// Sequential is set when the input could not be read at offsets
+	Sequential bool    `json:"sequential,omitempty"`
+	Jobs       int     `json:"jobs"`
+	Alignment  int64   `json:"alignment_bytes"`
+	ChunkSize  int64   `json:"chunk_size"`
+	Bytes      int64   `json:"bytes"`
+	Elapsed    float64 `json:"elapsed_seconds"`
+}
+
+// write writes the report as JSON to the given path
+func (r runReport) write(fpath string) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode report: %w", err)
+	}
+	if err := os.WriteFile(fpath, append(b, '\n'), 0o644); err != nil {
+		return fmt.Errorf("could not write report: %w", err)
+	}
+	return nil
+}
+
+// canReadAt reports whether the file supports reads at offsets
+func canReadAt(file *os.File, info os.FileInfo) bool {
+	if !info.Mode().IsRegular() {
+		return false
+	}
+	var probe [1]byte
+	_, err := file.ReadAt(probe[:], 0)
+	return err == nil || errors.Is(err, io.EOF)
+}
+
+// readRange reads the lines starting within [start, end) of a file chunk by
+// chunk into buf and sends copies of them to out
+func readRange(
+	file *os.File, start, end int64, buf []byte, out chan<- []byte,
+) error {
+	// Read file by chunks, keeping every read offset aligned
+	for pos := start; pos < end; pos += chunkSize {
+		// Read a chunk
+		n, err := file.ReadAt(buf, pos)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("could not read at %d: %w", pos, err)
+		}
+
+		// Don't read past chunk limits
+		n = min(n, int(end-pos))
+		data := buf[:n]
+
+		// If no bytes were read, break the loop
+		if n == 0 {
+			break
+		}
+
+		// A chunk owns every line that starts inside it.
+		// If not the first chunk in the file, skip the
+		// tail of the line started by the previous chunk
+		// and read the tail of our own last line past
+		// the chunk end.
+		//
+		// aaa;1.2
+		// bbb;3.4
+		// ccc;5.6
+		//
+		// The above example may be split into chunks
+		// as follows below
+		//
+		// aaa;1.2
+		//  +--- chunk split here
+		//  |
+		//  v
+		// bbb;3.4
+		// ccc;5.6
+		//
+		// chunk 1           | chunk 2
+		// ...aaa;1.2\nbb    | b;3.4\nccc;...
+		//
+		// In this case, we want chunk 1 to read the
+		// full line of bbb and chunk 2 to start
+		// reading at ccc.
+		if pos != 0 {
+			starts, err := lineStartsAt(file, pos)
+			if err != nil {
+				return err
+			}
+			if !starts {
+				i := bytes.IndexByte(data, '\n')
+				if i < 0 {
+					continue
+				}
+				data = data[i+1:]
+			}
+		}
+		var overflow []byte
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			overflow, err = readLineTail(file, pos+int64(n))
+			if err != nil {
+				return err
+			}
+		}
+
+		send := make([]byte, len(data), len(data)+len(overflow))
+		copy(send, data)
+		send = append(send, overflow...)
+
+		out <- send
+	}
+	return nil
+}
+
+// lineStartsAt reports whether a line starts at the given file offset
+func lineStartsAt(file *os.File, off int64) (bool, error) {
+	var prev [1]byte
+	if _, err := file.ReadAt(prev[:], off-1); err != nil {
+		return false, fmt.Errorf("could not read at %d: %w", off-1, err)
+	}
+	return prev[0] == '\n', nil
+}
+
+// readLineTail reads from the given file offset up to and including the next
+// new line, or up to the end of the file
+func readLineTail(file *os.File, off int64) ([]byte, error) {
+	var tail []byte
+	var piece [128]byte
+	for {
+		n, err := file.ReadAt(piece[:], off)
+		if i := bytes.IndexByte(piece[:n], '\n'); i >= 0 {
+			return append(tail, piece[:i+1]...), nil
+		}
+		tail = append(tail, piece[:n]...)
+		off += int64(n)
+		if errors.Is(err, io.EOF) {
+			return tail, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read at %d: %w", off, err)
+		}
+	}
+}
+
+// alignUp rounds n up to the nearest multiple of align
+func alignUp(n, align int64) int64 {
+	return (n + align - 1) / align * align
+}
+
+// alignedBuffer returns a buffer of the given size whose first byte sits on an
+// align boundary, as required for O_DIRECT reads
+func alignedBuffer(size, align int64) []byte {
+	buf := make([]byte, size+align)
+	addr := int64(uintptr(unsafe.Pointer(&buf[0])))
+	off := alignUp(addr, align) - addr
+	return buf[off : off+size : off+size]
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestReadRangeBoundaries reads small samples split into ranges and chunks of
+// every size up to their length, checking that every line is read exactly once
+// whatever byte boundaries the splits fall on
+func TestReadRangeBoundaries(t *testing.T) {
+	defer func(c int64) { chunkSize = c }(chunkSize)
+	inputs, err := filepath.Glob("../../test/samples/measurements-*.txt")
+	if err != nil {
+		t.Fatalf("could not find samples: %v", err)
+	}
+	for _, input := range inputs {
+		content, err := os.ReadFile(input)
+		if err != nil {
+			t.Fatalf("could not read sample: %v", err)
+		}
+		if len(content) > 1024 {
+			continue
+		}
+		t.Run(filepath.Base(input), func(t *testing.T) {
+			file, err := os.Open(input)
+			if err != nil {
+				t.Fatalf("could not open sample: %v", err)
+			}
+			defer file.Close()
+			size := int64(len(content))
+			for chunkSize = 1; chunkSize <= size+1; chunkSize++ {
+				for ranges := int64(1); ranges <= 3; ranges++ {
+					chunks := (size + chunkSize - 1) / chunkSize
+					perRange := (chunks + ranges - 1) / ranges
+					var actual bytes.Buffer
+					for i := int64(0); i < ranges; i++ {
+						start := i * perRange * chunkSize
+						end := min(start+perRange*chunkSize, size)
+						out := make(chan []byte)
+						go func() {
+							err := readRange(
+								file, start, end, make([]byte, chunkSize), out,
+							)
+							if err != nil {
+								t.Errorf("could not read range: %v", err)
+							}
+							close(out)
+						}()
+						for chunk := range out {
+							actual.Write(chunk)
+						}
+					}
+					if !bytes.Equal(actual.Bytes(), content) {
+						t.Fatalf(
+							"chunk size %d, %d ranges: got %q, want %q",
+							chunkSize, ranges, actual.Bytes(), content,
+						)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRunReportWrite(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "report.json")
+	r := runReport{
+		Mode: modeRead, Jobs: 4, Alignment: hugePageSize,
+		ChunkSize: hugePageSize, Bytes: 10, Elapsed: 1.5,
+	}
+	if err := r.write(fpath); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(b, []byte(`"alignment_bytes": 2097152`)) {
+		t.Errorf("report does not record the alignment:\n%s", b)
+	}
+}
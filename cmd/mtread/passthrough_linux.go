@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// maxSpliceSize caps the bytes moved per sendfile/splice call, matching the
+// kernel's own per call limit
+const maxSpliceSize = 0x7ffff000
+
+// passthrough copies size bytes from src to dst without going through a
+// userspace buffer, using sendfile or splice depending on the mode
+func passthrough(mode string, src, dst *os.File, size int64) (int64, error) {
+	var written int64
+	for written < size {
+		n := int(min(size-written, maxSpliceSize))
+		var err error
+		switch mode {
+		case modeSendfile:
+			off := written
+			n, err = syscall.Sendfile(int(dst.Fd()), int(src.Fd()), &off, n)
+		case modeSplice:
+			off := written
+			var m int64
+			m, err = syscall.Splice(
+				int(src.Fd()), &off, int(dst.Fd()), nil, n, 0,
+			)
+			n = int(m)
+		default:
+			return written, fmt.Errorf("unknown passthrough mode %q", mode)
+		}
+		if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EINTR) {
+			continue
+		}
+		if err != nil {
+			return written, fmt.Errorf("%s failed: %w", mode, err)
+		}
+		if n == 0 {
+			break
+		}
+		written += int64(n)
+	}
+	return written, nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// passthrough is only implemented on Linux, where sendfile and splice exist
+func passthrough(mode string, src, dst *os.File, size int64) (int64, error) {
+	return 0, fmt.Errorf("%s mode is only supported on linux", mode)
+}
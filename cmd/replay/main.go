@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// tick is the average interval at which rows are released and flushed
+const tick = 10 * time.Millisecond
+
+var input = flag.String("input", "", "measurements file to replay")
+var rate = flag.Float64(
+	"rate", 1000, "rows per second to replay at (0 for as fast as possible)",
+)
+var jitter = flag.Float64(
+	"jitter", 0,
+	"fraction by which each interval between releases of rows may vary, "+
+		"from 0 to 1",
+)
+var seed = flag.Int64(
+	"seed", 0, "seed for the jitter (0 for a random seed, logged)",
+)
+
+func main() {
+	flag.Parse()
+
+	if *input == "" || *rate < 0 || *jitter < 0 || *jitter > 1 {
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	f, err := os.Open(*input)
+	if err != nil {
+		log.Fatal("could not open measurements file: ", err)
+	}
+	defer f.Close()
+
+	start := time.Now()
+	if *seed == 0 {
+		*seed = start.UnixNano()
+	}
+	if *jitter > 0 {
+		log.Printf("replaying with -seed %d\n", *seed)
+	}
+	rng := rand.New(rand.NewSource(*seed))
+	rows, err := replay(f, os.Stdout, *rate, *jitter, rng)
+	if err != nil {
+		log.Fatal("error replaying measurements: ", err)
+	}
+	elapsed := time.Since(start).Seconds()
+	log.Printf(
+		"replayed %d measurements in %.1f s (%.0f rows/s)\n",
+		rows, elapsed, float64(rows)/elapsed,
+	)
+}
+
+// replay copies the lines of r to w at the given rate in rows per second.
+// Rows are released in batches every tick, with each tick varied by up to
+// the jitter fraction; since the batches are sized by the time elapsed, the
+// jitter does not change the average rate. It returns the rows copied.
+func replay(
+	r io.Reader, w io.Writer, rate, jitter float64, rng *rand.Rand,
+) (int, error) {
+	in := bufio.NewReader(r)
+	out := bufio.NewWriter(w)
+	start := time.Now()
+	rows := 0
+	for {
+		due := int(rate * time.Since(start).Seconds())
+		for rate == 0 || rows < due {
+			line, err := in.ReadSlice('\n')
+			if errors.Is(err, bufio.ErrBufferFull) {
+				// Copy overlong lines through in pieces
+				if _, err := out.Write(line); err != nil {
+					return rows, err
+				}
+				continue
+			}
+			if len(line) > 0 {
+				if _, err := out.Write(line); err != nil {
+					return rows, err
+				}
+				rows++
+			}
+			if errors.Is(err, io.EOF) {
+				return rows, out.Flush()
+			}
+			if err != nil {
+				return rows, err
+			}
+		}
+		if err := out.Flush(); err != nil {
+			return rows, err
+		}
+		vary := 1 + jitter*(2*rng.Float64()-1)
+		time.Sleep(time.Duration(float64(tick) * vary))
+	}
+}
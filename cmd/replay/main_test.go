@@ -0,0 +1,29 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplay(t *testing.T) {
+	input := strings.Repeat("Hamburg;12.0\n", 100) + "Oslo;-3.0"
+	for _, rate := range []float64{0, 2000} {
+		var out strings.Builder
+		start := time.Now()
+		rows, err := replay(
+			strings.NewReader(input), &out, rate, 0.5, rand.New(rand.NewSource(1)),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, 101, rows)
+		assert.Equal(t, input, out.String())
+		if rate > 0 {
+			// 101 rows at 2000 rows/s take at least 50 ms
+			assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+		}
+	}
+}
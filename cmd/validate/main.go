@@ -0,0 +1,165 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/aeolyus/1brc/brc"
+)
+
+var input = flag.String(
+	"input", "", "measurements file to process, instead of reading -got",
+)
+var command = flag.String(
+	"cmd", "",
+	"command computing the results of -input, run with -input appended, "+
+		"instead of processing it with brc.Process",
+)
+var got = flag.String(
+	"got", "", "output of another implementation to check, instead of -input",
+)
+var want = flag.String("want", "", "reference output to check against")
+var tolerance = flag.Float64(
+	"tolerance", 0, "difference in degrees allowed between temperatures",
+)
+
+func main() {
+	flag.Parse()
+
+	if *want == "" || (*input == "") == (*got == "") || *tolerance < 0 {
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	wantResults, err := readResults(*want)
+	if err != nil {
+		log.Fatal("could not read reference output: ", err)
+	}
+	var gotResults brc.Results
+	if *got != "" {
+		gotResults, err = readResults(*got)
+	} else if *command != "" {
+		gotResults, err = runCommand(*command, *input)
+	} else {
+		gotResults, err = processFile(*input)
+	}
+	if err != nil {
+		log.Fatal("could not get output to check: ", err)
+	}
+
+	mismatches := diff(wantResults, gotResults, *tolerance)
+	for _, m := range mismatches {
+		fmt.Println(m)
+	}
+	if len(mismatches) > 0 {
+		log.Fatalf("%d mismatches over %d stations\n", len(mismatches), len(wantResults))
+	}
+	log.Printf("all %d stations match\n", len(wantResults))
+}
+
+// readResults parses a file of results in the challenge output format
+func readResults(fpath string) (brc.Results, error) {
+	text, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+	var rs brc.Results
+	if err := rs.UnmarshalText(text); err != nil {
+		return nil, fmt.Errorf("%s: %w", fpath, err)
+	}
+	return rs, nil
+}
+
+// processFile computes the results of the measurements file with brc.Process
+func processFile(fpath string) (brc.Results, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return brc.Process(f, brc.Options{})
+}
+
+// runCommand runs a command on the measurements file and parses its output
+func runCommand(command, input string) (brc.Results, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+	cmd := exec.Command(args[0], append(args[1:], "-input", input)...)
+	cmd.Stderr = os.Stderr
+	text, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", command, err)
+	}
+	var rs brc.Results
+	if err := rs.UnmarshalText(text); err != nil {
+		return nil, fmt.Errorf("%s: %w", command, err)
+	}
+	return rs, nil
+}
+
+// diff describes how the results differ from the expected ones: stations
+// missing, unexpected or repeated, which of the min, mean and max of a station
+// differ by more than the tolerance, and where the order of the stations first
+// differs
+func diff(want, got brc.Results, tolerance float64) []string {
+	var mismatches []string
+	gotStats := make(map[string]brc.Stat, len(got))
+	for _, r := range got {
+		if _, ok := gotStats[r.Station]; ok {
+			mismatches = append(mismatches, fmt.Sprintf("%s: repeated", r.Station))
+		}
+		gotStats[r.Station] = r.Stat
+	}
+	wantStats := make(map[string]bool, len(want))
+	for _, r := range want {
+		wantStats[r.Station] = true
+		g, ok := gotStats[r.Station]
+		if !ok {
+			mismatches = append(mismatches, fmt.Sprintf("%s: missing", r.Station))
+			continue
+		}
+		var fields []string
+		for _, f := range []struct {
+			name      string
+			want, got float64
+		}{
+			{"min", r.Min, g.Min}, {"mean", r.Mean, g.Mean}, {"max", r.Max, g.Max},
+		} {
+			// Temperatures have one decimal, so allow for their binary error
+			if math.Abs(f.want-f.got) > tolerance+1e-9 {
+				fields = append(fields, fmt.Sprintf(
+					"%s %.1f, want %.1f", f.name, f.got, f.want,
+				))
+			}
+		}
+		if len(fields) > 0 {
+			mismatches = append(mismatches, fmt.Sprintf(
+				"%s: %s", r.Station, strings.Join(fields, ", "),
+			))
+		}
+	}
+	for _, r := range got {
+		if !wantStats[r.Station] {
+			mismatches = append(mismatches, fmt.Sprintf("%s: unexpected", r.Station))
+		}
+	}
+	if len(mismatches) == 0 {
+		for i := range want {
+			if want[i].Station != got[i].Station {
+				mismatches = append(mismatches, fmt.Sprintf(
+					"%s: out of order, want %s at position %d",
+					got[i].Station, want[i].Station, i+1,
+				))
+				break
+			}
+		}
+	}
+	return mismatches
+}
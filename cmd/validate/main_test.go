@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aeolyus/1brc/brc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parseResults(t *testing.T, text string) brc.Results {
+	t.Helper()
+	var rs brc.Results
+	require.NoError(t, rs.UnmarshalText([]byte(text)))
+	return rs
+}
+
+func TestDiff(t *testing.T) {
+	want := parseResults(t, "{Abha=-23.0/18.0/59.2, Oslo=-3.0/1.5/8.0, Washington, D.C.=-0.5/14.6/33.3}")
+
+	assert.Empty(t, diff(want, want, 0))
+
+	got := parseResults(t, "{Abha=-23.0/18.1/59.3, Oslo=-3.0/1.5/8.0, Rome=1.0/1.0/1.0}")
+	assert.Equal(t, []string{
+		"Abha: mean 18.1, want 18.0, max 59.3, want 59.2",
+		"Washington, D.C.: missing",
+		"Rome: unexpected",
+	}, diff(want, got, 0))
+	assert.Equal(t, []string{
+		"Washington, D.C.: missing",
+		"Rome: unexpected",
+	}, diff(want, got, 0.1))
+
+	got = parseResults(t, "{Oslo=-3.0/1.5/8.0, Abha=-23.0/18.0/59.2, Washington, D.C.=-0.5/14.6/33.3}")
+	assert.Equal(t, []string{
+		"Oslo: out of order, want Abha at position 1",
+	}, diff(want, got, 0))
+
+	got = append(want[:len(want):len(want)], want[0])
+	assert.Equal(t, []string{"Abha: repeated"}, diff(want, got, 0))
+}
+
+func TestProcessFile(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "measurements.txt")
+	require.NoError(t, os.WriteFile(fpath, []byte(
+		"Oslo;1.5\nAbha;-23.0\nOslo;-3.0\nAbha;59.2\nOslo;8.0\n",
+	), 0o644))
+
+	got, err := processFile(fpath)
+	require.NoError(t, err)
+	assert.Empty(t, diff(parseResults(t, "{Abha=-23.0/18.1/59.2, Oslo=-3.0/2.2/8.0}"), got, 0))
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Compatibility profiles reproducing the output of reference implementations
+// down to their rounding and ordering
+const (
+	// compatCustom is the output as given by the other flags
+	compatCustom = "custom"
+	// compatJava is the Java baseline of the challenge, which rounds means
+	// half up with Math.round and sorts stations in a TreeMap
+	compatJava = "1brc-java"
+	// compatGoNaive is the straightforward Go solution, which formats means
+	// with %.1f and sorts stations with sort.Strings
+	compatGoNaive = "go-naive"
+)
+
+var compatProfiles = []string{compatCustom, compatJava, compatGoNaive}
+
+// Ways the means can be rounded to a tenth
+const (
+	// roundHalfUp rounds half up, toward positive infinity, as the challenge
+	// specifies and its reference implementation does
+	roundHalfUp = "half-up"
+	// roundCeil rounds anything above a tenth up to the next one, as earlier
+	// versions did
+	roundCeil = "ceil"
+)
+
+var roundings = []string{roundHalfUp, roundCeil}
+
+// compatMean returns the mean temperature of a station in degrees, rounded to
+// one decimal place as the -compat profile has it
+func compatMean(v *stat) float64 {
+	switch *compat {
+	case compatJava:
+		// Math.round(x) is floor(x + 0.5) on the mean in doubles
+		return math.Floor(degrees(v.Sum)/float64(v.Count)*10+0.5) / 10
+	case compatGoNaive:
+		// %.1f rounds the binary value of the mean half to even
+		mean := degrees(v.Sum) / float64(v.Count)
+		rounded, _ := strconv.ParseFloat(strconv.FormatFloat(mean, 'f', 1, 64), 64)
+		return rounded
+	default:
+		return mean(v)
+	}
+}
+
+// compareStations compares station names in the order of the -compat profile:
+// Java strings compare by UTF-16 code units, which differs from comparing
+// UTF-8 bytes for characters beyond the Basic Multilingual Plane
+func compareStations(a, b string) int {
+	if *compat != compatJava {
+		return strings.Compare(a, b)
+	}
+	ua, ub := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+	for i := range min(len(ua), len(ub)) {
+		if ua[i] != ub[i] {
+			return int(ua[i]) - int(ub[i])
+		}
+	}
+	return len(ua) - len(ub)
+}
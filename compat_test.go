@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvalCompat(t *testing.T) {
+	defer func(s string) { *compat = s }(*compat)
+	// A has a mean of 1.0333, B of exactly 0.25, and U+FF61 sorts before
+	// U+1F600 in UTF-8 but after it in UTF-16
+	input := filepath.Join(t.TempDir(), "input.txt")
+	require.NoError(t, os.WriteFile(input, []byte(
+		"A;1.0\nA;1.0\nA;1.1\nB;0.5\nB;0.0\n｡;1.0\n😀;2.0\n",
+	), 0o644))
+	for profile, expected := range map[string]string{
+		compatCustom: "{A=1.0/1.0/1.1, B=0.0/0.3/0.5, " +
+			"｡=1.0/1.0/1.0, 😀=2.0/2.0/2.0}\n",
+		compatJava: "{A=1.0/1.0/1.1, B=0.0/0.3/0.5, " +
+			"😀=2.0/2.0/2.0, ｡=1.0/1.0/1.0}\n",
+		compatGoNaive: "{A=1.0/1.0/1.1, B=0.0/0.2/0.5, " +
+			"｡=1.0/1.0/1.0, 😀=2.0/2.0/2.0}\n",
+	} {
+		*compat = profile
+		var out strings.Builder
+		require.NoError(t, eval(context.Background(), input, &out), profile)
+		assert.Equal(t, expected, out.String(), profile)
+	}
+}
+
+func TestMeanRounding(t *testing.T) {
+	defer func(r string) { *rounding = r }(*rounding)
+	// Sums are in tenths, so {1, 2} is a mean of 0.05
+	for _, tc := range []struct {
+		sum, count     int64
+		halfUp, ceiled float64
+	}{
+		{30, 10, 0.3, 0.3},
+		{34, 10, 0.3, 0.4},
+		{35, 10, 0.4, 0.4},
+		{-35, 10, -0.3, -0.3},
+		{-36, 10, -0.4, -0.3},
+		{31, 3, 1.0, 1.1},
+		{-20, 3, -0.7, -0.6},
+		{1, 2, 0.1, 0.1},
+		{-1, 2, 0, 0},
+		{-3, 2, -0.1, -0.1},
+		{-999, 1, -99.9, -99.9},
+	} {
+		v := &stat{Sum: tc.sum, Count: tc.count}
+		*rounding = roundHalfUp
+		assert.Equal(t, tc.halfUp, mean(v), "%d/%d", tc.sum, tc.count)
+		*rounding = roundCeil
+		assert.Equal(t, tc.ceiled, mean(v), "%d/%d", tc.sum, tc.count)
+	}
+}
+
+func TestCompareStationsJava(t *testing.T) {
+	defer func(s string) { *compat = s }(*compat)
+	*compat = compatJava
+	assert.Negative(t, compareStations("Abha", "Abéché"))
+	assert.Negative(t, compareStations("Ab", "Abha"))
+	assert.Zero(t, compareStations("Oslo", "Oslo"))
+	assert.Negative(t, compareStations("😀", "｡"))
+}
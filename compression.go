@@ -0,0 +1,56 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compressions the output can be written with
+const (
+	compressionNone = "none"
+	compressionGzip = "gzip"
+	compressionZstd = "zstd"
+)
+
+var compressions = []string{compressionNone, compressionGzip, compressionZstd}
+
+// outputCompression returns how the output is compressed: as given, or else
+// by the extension of its path
+func outputCompression(fpath, compression string) string {
+	if compression != "" {
+		return compression
+	}
+	switch filepath.Ext(fpath) {
+	case ".gz":
+		return compressionGzip
+	case ".zst":
+		return compressionZstd
+	default:
+		return compressionNone
+	}
+}
+
+// compressWriter returns a writer compressing to w. Closing it flushes the
+// compressed stream but leaves w open.
+func compressWriter(w io.Writer, compression string) (io.WriteCloser, error) {
+	switch compression {
+	case compressionGzip:
+		return gzip.NewWriter(w), nil
+	case compressionZstd:
+		return zstd.NewWriter(w)
+	default:
+		return nopWriteCloser{w}, nil
+	}
+}
+
+// nopWriteCloser is a writer with a Close method that does nothing
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
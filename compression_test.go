@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutputCompression(t *testing.T) {
+	assert.Equal(t, compressionGzip, outputCompression("out.json.gz", ""))
+	assert.Equal(t, compressionZstd, outputCompression("out.zst", ""))
+	assert.Equal(t, compressionNone, outputCompression("out.txt", ""))
+	assert.Equal(t, compressionNone, outputCompression("", ""))
+	assert.Equal(t, compressionNone, outputCompression("out.gz", compressionNone))
+	assert.Equal(t, compressionZstd, outputCompression("", compressionZstd))
+}
+
+func TestCompressWriter(t *testing.T) {
+	defer func(f string) { *outputFormat = f }(*outputFormat)
+	*outputFormat = formatJSON
+	input := filepath.Join(sampleInputDir, "measurements-10000-unique-keys.txt")
+	expected, err := os.CreateTemp(t.TempDir(), "expected")
+	require.NoError(t, err)
+	defer expected.Close()
+	require.NoError(t, eval(context.Background(), input, expected))
+	want, err := os.ReadFile(expected.Name())
+	require.NoError(t, err)
+
+	// The compressed output decompresses to the plain one
+	for _, c := range []string{compressionGzip, compressionZstd} {
+		t.Run(c, func(t *testing.T) {
+			fpath := filepath.Join(t.TempDir(), "out")
+			f, err := os.Create(fpath)
+			require.NoError(t, err)
+			defer f.Close()
+			w, err := compressWriter(f, c)
+			require.NoError(t, err)
+			require.NoError(t, eval(context.Background(), input, w))
+			require.NoError(t, w.Close())
+			raw, err := os.ReadFile(fpath)
+			require.NoError(t, err)
+			assert.NotEqual(t, want, raw)
+
+			r, err := openDecoded(fpath)
+			require.NoError(t, err)
+			defer r.Close()
+			got, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, string(want), string(got))
+		})
+	}
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/aeolyus/1brc/internal/pipeline"
+)
+
+// decoder decompresses input files of one format
+type decoder interface {
+	// name is the name of the format, e.g. gzip
+	name() string
+	// newReader returns a reader of the decompressed stream
+	newReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// blockDecoder is a decoder of a format whose files may consist of blocks
+// that decompress independently of each other, and so in parallel
+type blockDecoder interface {
+	decoder
+	// blocks returns the blocks of the file at fpath in order, or nil if
+	// they cannot be found without decompressing it
+	blocks(fpath string, f io.ReaderAt, size int64) ([]block, error)
+	// decodeBlock decompresses a single block
+	decodeBlock(src []byte) ([]byte, error)
+}
+
+// block is the extent of an independently compressed block of a file
+type block struct {
+	offset int64
+	size   int64
+}
+
+// registeredDecoder is a decoder with how to recognize its files
+type registeredDecoder struct {
+	dec   decoder
+	magic []byte
+	ext   string
+}
+
+// sniffer is a decoder that checks more of the start of a file than its
+// magic bytes, for formats that are a special case of another
+type sniffer interface {
+	sniff(head []byte) bool
+}
+
+// decoders are the registered decoders
+var decoders []registeredDecoder
+
+// registerDecoder registers a decoder for files starting with the magic bytes,
+// or named with the extension where they cannot be peeked at. Where the magic
+// bytes of several decoders match, the longest wins.
+func registerDecoder(dec decoder, magic []byte, ext string) {
+	decoders = append(decoders, registeredDecoder{dec, magic, ext})
+}
+
+func init() {
+	registerDecoder(gzipDecoder{}, []byte{0x1f, 0x8b}, ".gz")
+}
+
+// detectDecoder returns the decoder of a compressed input file, or nil if it
+// is not compressed. Regular files and stdin, which is buffered, are recognized
+// by their first bytes, other inputs such as pipes by their extension, since
+// peeking at them would consume the input.
+func detectDecoder(fpath string) (decoder, error) {
+	if fpath == stdinInput {
+		head, err := peekStdin(16)
+		if err != nil {
+			return nil, err
+		}
+		return matchDecoder(head), nil
+	}
+	info, err := os.Stat(fpath)
+	if err != nil {
+		return nil, fmt.Errorf("could not stat file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		for _, d := range decoders {
+			if filepath.Ext(fpath) == d.ext {
+				return d.dec, nil
+			}
+		}
+		return nil, nil
+	}
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, fmt.Errorf("could not open file: %w", err)
+	}
+	defer f.Close()
+	head := make([]byte, 16)
+	n, _ := io.ReadFull(f, head)
+	return matchDecoder(head[:n]), nil
+}
+
+// matchDecoder returns the decoder of the format the first bytes of an input
+// are the magic number of, the longest matching one if several do, or nil
+func matchDecoder(head []byte) decoder {
+	var match *registeredDecoder
+	for i, d := range decoders {
+		if !bytes.HasPrefix(head, d.magic) {
+			continue
+		}
+		if s, ok := d.dec.(sniffer); ok && !s.sniff(head) {
+			continue
+		}
+		if match == nil || len(d.magic) > len(match.magic) {
+			match = &decoders[i]
+		}
+	}
+	if match == nil {
+		return nil
+	}
+	return match.dec
+}
+
+// decodedInput is an input file, or stdin, read sequentially and decompressed
+type decodedInput struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (d *decodedInput) Close() error {
+	var firstErr error
+	for i := len(d.closers) - 1; i >= 0; i-- {
+		if err := d.closers[i].Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// openDecoded opens an input to be read sequentially, decompressing it if it
+// is compressed, for passes over the input outside of the pipeline
+func openDecoded(fpath string) (io.ReadCloser, error) {
+	dec, err := detectDecoder(fpath)
+	if err != nil {
+		return nil, err
+	}
+	d := &decodedInput{Reader: stdin()}
+	if fpath != stdinInput {
+		f, err := os.Open(fpath)
+		if err != nil {
+			return nil, fmt.Errorf("could not open file: %w", err)
+		}
+		d.Reader = f
+		d.closers = append(d.closers, f)
+	}
+	if dec != nil {
+		r, err := dec.newReader(bufio.NewReaderSize(d.Reader, chunkSize))
+		if err != nil {
+			d.Close()
+			return nil, fmt.Errorf("could not decompress %s: %w", dec.name(), err)
+		}
+		d.Reader = r
+		d.closers = append(d.closers, r)
+	}
+	return d, nil
+}
+
+// readCompressed reads a compressed input file and returns a map of station
+// statistics
+func readCompressed(
+	ctx context.Context, fpath string, dec decoder, rs *runState,
+) (*stationStats, error) {
+	if report != nil {
+		report.Strategy = strategyStream
+		report.ExpectedStations = *expectStations
+	}
+	// The cardinality cannot be sampled without decompressing, so workers
+	// start small unless told otherwise
+	return process(ctx, rs, *expectStations, func(
+		ctx context.Context, chunkChan chan<- []byte, counts *chunkCounts,
+	) error {
+		defer close(chunkChan)
+		return decodeChunks(ctx, fpath, dec, chunkChan, counts)
+	})
+}
+
+// decodeChunks decompresses an input file into a channel in chunks ending on
+// line boundaries, in parallel if its format and file allow it
+func decodeChunks(
+	ctx context.Context,
+	fpath string,
+	dec decoder,
+	chunkChan chan<- []byte,
+	counts *chunkCounts,
+) error {
+	if fpath == stdinInput {
+		return decodeStream(ctx, stdin(), fpath, dec, chunkChan, counts)
+	}
+	f, err := os.Open(fpath)
+	if err != nil {
+		return fmt.Errorf("could not open file: %w", err)
+	}
+	defer f.Close()
+	if bd, ok := dec.(blockDecoder); ok {
+		info, err := f.Stat()
+		if err != nil {
+			return fmt.Errorf("could not stat file: %w", err)
+		}
+		var blocks []block
+		if info.Mode().IsRegular() {
+			if blocks, err = bd.blocks(fpath, f, info.Size()); err != nil {
+				return fmt.Errorf(
+					"could not read %s blocks: %w", dec.name(), err,
+				)
+			}
+		}
+		if blocks != nil {
+			return decodeBlocks(
+				ctx, f, fpath, bd, blocks, chunkChan, counts,
+			)
+		}
+	}
+	return decodeStream(
+		ctx, bufio.NewReaderSize(f, chunkSize), fpath, dec, chunkChan, counts,
+	)
+}
+
+// decodeStream decompresses an input read sequentially into a channel in
+// chunks ending on line boundaries
+func decodeStream(
+	ctx context.Context,
+	src io.Reader,
+	fpath string,
+	dec decoder,
+	chunkChan chan<- []byte,
+	counts *chunkCounts,
+) error {
+	r, err := dec.newReader(src)
+	if err != nil {
+		return fmt.Errorf("could not decompress %s: %w", dec.name(), err)
+	}
+	defer r.Close()
+	leftOver, total, err := readLines(ctx, r, fpath, chunkChan, counts, nil)
+	if err != nil {
+		return err
+	}
+	if len(leftOver) > 0 {
+		return counts.sendFrom(
+			ctx, chunkChan, leftOver,
+			chunkOrigin{fpath, total - int64(len(leftOver))},
+		)
+	}
+	return nil
+}
+
+// decodeBlocks decompresses the blocks of a file in parallel into a channel.
+// Lines may span blocks, so the whole lines of each block are sent as soon as
+// it is decompressed, and the pieces of lines at its edges are joined with
+// those of its neighbours once every block is done.
+func decodeBlocks(
+	ctx context.Context,
+	f io.ReaderAt,
+	fpath string,
+	dec blockDecoder,
+	blocks []block,
+	chunkChan chan<- []byte,
+	counts *chunkCounts,
+) error {
+	// Where decompressed blocks start is not known until they all are
+	origin := chunkOrigin{fpath, -1}
+	// edges holds the pieces of lines before the first and after the last
+	// newline of each block, or all of it if it has none. They are copies,
+	// so that a block can be freed once its whole lines are sent.
+	type edges struct {
+		head, tail []byte
+		newline    bool
+	}
+	blockEdges := make([]edges, len(blocks))
+	workers := *jobs
+	if workers <= 0 {
+		workers = defaultJobs(cgroupLimits())
+	}
+	err := pipeline.Run(ctx, 0, workers,
+		func(ctx context.Context, indexes chan<- int) error {
+			defer close(indexes)
+			for i := range blocks {
+				select {
+				case indexes <- i:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			return nil
+		},
+		func(ctx context.Context, indexes <-chan int) error {
+			for i := range indexes {
+				src := make([]byte, blocks[i].size)
+				if _, err := f.ReadAt(src, blocks[i].offset); err != nil {
+					return fmt.Errorf("error reading file: %w", err)
+				}
+				data, err := dec.decodeBlock(src)
+				if err != nil {
+					return fmt.Errorf(
+						"could not decompress %s block at %d: %w",
+						dec.name(), blocks[i].offset, err,
+					)
+				}
+				first := bytes.IndexByte(data, '\n')
+				if first < 0 {
+					blockEdges[i] = edges{head: bytes.Clone(data)}
+					continue
+				}
+				last := bytes.LastIndexByte(data, '\n')
+				blockEdges[i] = edges{
+					head:    bytes.Clone(data[:first+1]),
+					tail:    bytes.Clone(data[last+1:]),
+					newline: true,
+				}
+				if whole := data[first+1 : last+1]; len(whole) > 0 {
+					err := counts.sendFrom(ctx, chunkChan, whole, origin)
+					if err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	var joined, line []byte
+	for _, e := range blockEdges {
+		line = append(line, e.head...)
+		if e.newline {
+			joined = append(joined, line...)
+			line = append(line[:0], e.tail...)
+		}
+	}
+	joined = append(joined, line...)
+	if len(joined) > 0 {
+		return counts.sendFrom(ctx, chunkChan, joined, origin)
+	}
+	return nil
+}
+
+// gzipDecoder decodes gzip files, whose members can only be found by
+// decompressing them
+type gzipDecoder struct{}
+
+func (gzipDecoder) name() string { return "gzip" }
+
+func (gzipDecoder) newReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
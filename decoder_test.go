@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// compressGzip compresses data with gzip
+func compressGzip(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+// compressZstd compresses data with zstd as a single frame
+func compressZstd(t *testing.T, data []byte) []byte {
+	t.Helper()
+	enc, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	defer enc.Close()
+	return enc.EncodeAll(data, nil)
+}
+
+// compressSeekableZstd compresses data in the zstd seekable format, in frames
+// of frameSize bytes regardless of lines, with checksums in the seek table if
+// asked for
+func compressSeekableZstd(
+	t *testing.T, data []byte, frameSize int, checksums bool,
+) []byte {
+	t.Helper()
+	enc, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	defer enc.Close()
+	var out, table []byte
+	frames := 0
+	for len(data) > 0 {
+		n := min(frameSize, len(data))
+		frame := enc.EncodeAll(data[:n], nil)
+		out = append(out, frame...)
+		table = binary.LittleEndian.AppendUint32(table, uint32(len(frame)))
+		table = binary.LittleEndian.AppendUint32(table, uint32(n))
+		if checksums {
+			table = binary.LittleEndian.AppendUint32(table, 0)
+		}
+		data = data[n:]
+		frames++
+	}
+	table = binary.LittleEndian.AppendUint32(table, uint32(frames))
+	descriptor := byte(0)
+	if checksums {
+		descriptor = zstdSeekChecksumFlag
+	}
+	table = append(table, descriptor)
+	table = binary.LittleEndian.AppendUint32(table, zstdSeekableMagic)
+	out = binary.LittleEndian.AppendUint32(out, zstdSkippableMagic)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(table)))
+	return append(out, table...)
+}
+
+func TestEvalCompressed(t *testing.T) {
+	input := filepath.Join(sampleInputDir, "measurements-10000-unique-keys")
+	data, err := os.ReadFile(input + sampleInputExt)
+	require.NoError(t, err)
+	expected, err := readFile(input + sampleOutputExt)
+	require.NoError(t, err)
+	dir := t.TempDir()
+	for name, compressed := range map[string][]byte{
+		"a.gz":          compressGzip(t, data),
+		"a.zst":         compressZstd(t, data),
+		"seekable.zst":  compressSeekableZstd(t, data, 1000, false),
+		"checksums.zst": compressSeekableZstd(t, data, 4096, true),
+		"one-frame.zst": compressSeekableZstd(t, data, len(data), false),
+		// Compressed files are recognized by their content, not their name
+		"unnamed": compressGzip(t, data),
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			require.NoError(t, os.WriteFile(path, compressed, 0o644))
+			var out strings.Builder
+			require.NoError(t, eval(context.Background(), path, &out))
+			assert.Equal(t, expected, out.String())
+		})
+	}
+}
+
+func TestEvalCompressedFiles(t *testing.T) {
+	input := filepath.Join(sampleInputDir, "measurements-10000-unique-keys")
+	expected, err := readFile(input + sampleOutputExt)
+	require.NoError(t, err)
+	shards := splitSample(t, input+sampleInputExt, 100, 2000)
+	// Mix a plain shard with compressed ones
+	for i, compress := range []func([]byte) []byte{
+		func(b []byte) []byte { return compressGzip(t, b) },
+		func(b []byte) []byte { return compressSeekableZstd(t, b, 512, false) },
+	} {
+		data, err := os.ReadFile(shards[i])
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(shards[i], compress(data), 0o644))
+	}
+	var out strings.Builder
+	require.NoError(t, evalFiles(context.Background(), shards, &out))
+	assert.Equal(t, expected, out.String())
+}
+
+func TestZstdBlocks(t *testing.T) {
+	data := []byte(strings.Repeat("Hamburg;12.0\n", 100))
+	seekable := compressSeekableZstd(t, data, 100, false)
+	blocks, err := zstdDecoder{}.blocks(
+		"", bytes.NewReader(seekable), int64(len(seekable)),
+	)
+	require.NoError(t, err)
+	assert.Len(t, blocks, 13)
+	assert.Zero(t, blocks[0].offset)
+
+	// A plain zstd file has no blocks to decompress in parallel
+	plain := compressZstd(t, data)
+	blocks, err = zstdDecoder{}.blocks(
+		"", bytes.NewReader(plain), int64(len(plain)),
+	)
+	require.NoError(t, err)
+	assert.Nil(t, blocks)
+
+	// A seek table not matching the frames is rejected
+	corrupt := append([]byte(nil), seekable...)
+	binary.LittleEndian.PutUint32(corrupt[len(corrupt)-9:], 12)
+	_, err = zstdDecoder{}.blocks(
+		"", bytes.NewReader(corrupt), int64(len(corrupt)),
+	)
+	assert.Error(t, err)
+}
+
+// compressBgzf compresses data in bgzf members of up to memberSize bytes of
+// input each, followed by the empty end of file member, returning the file and
+// its index
+func compressBgzf(t *testing.T, data []byte, memberSize int) ([]byte, []byte) {
+	t.Helper()
+	var out, index []byte
+	var members uint64
+	member := func(data []byte) {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		w.Extra = []byte{'B', 'C', 2, 0, 0, 0}
+		_, err := w.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		b := buf.Bytes()
+		binary.LittleEndian.PutUint16(b[16:], uint16(len(b)-1))
+		if len(out) > 0 {
+			index = binary.LittleEndian.AppendUint64(index, uint64(len(out)))
+			index = binary.LittleEndian.AppendUint64(index, 0)
+			members++
+		}
+		out = append(out, b...)
+	}
+	for len(data) > 0 {
+		n := min(memberSize, len(data))
+		member(data[:n])
+		data = data[n:]
+	}
+	member(nil)
+	return out, append(binary.LittleEndian.AppendUint64(nil, members), index...)
+}
+
+func TestEvalBgzf(t *testing.T) {
+	input := filepath.Join(sampleInputDir, "measurements-10000-unique-keys")
+	data, err := os.ReadFile(input + sampleInputExt)
+	require.NoError(t, err)
+	expected, err := readFile(input + sampleOutputExt)
+	require.NoError(t, err)
+	compressed, index := compressBgzf(t, data, 3000)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "measurements.txt.gz")
+	require.NoError(t, os.WriteFile(path, compressed, 0o644))
+
+	dec, err := detectDecoder(path)
+	require.NoError(t, err)
+	assert.Equal(t, bgzfDecoder{}, dec)
+
+	// Members are found from their headers, or from the index if there is
+	// one, and decompressed in batches of a few
+	defer func(n int64) { bgzfBatchSize = n }(bgzfBatchSize)
+	bgzfBatchSize = 4096
+	for _, indexed := range []bool{false, true} {
+		if indexed {
+			require.NoError(t, os.WriteFile(path+bgzfIndexExt, index, 0o644))
+		}
+		var out strings.Builder
+		require.NoError(t, eval(context.Background(), path, &out))
+		assert.Equal(t, expected, out.String())
+	}
+}
+
+func TestBgzfBlocks(t *testing.T) {
+	data := []byte(strings.Repeat("Hamburg;12.0\n", 1000))
+	compressed, index := compressBgzf(t, data, 100)
+	size := int64(len(compressed))
+	scanned, err := scanBgzfMembers(bytes.NewReader(compressed), size)
+	require.NoError(t, err)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.gz")
+	require.NoError(t, os.WriteFile(path+bgzfIndexExt, index, 0o644))
+	indexed, err := readBgzfIndex(path+bgzfIndexExt, size)
+	require.NoError(t, err)
+	assert.Equal(t, scanned, indexed)
+	// 130 members of data and the end of file member
+	assert.Len(t, scanned, 130)
+
+	// Members are batched, and the batches cover the whole file
+	blocks, err := bgzfDecoder{}.blocks(path, bytes.NewReader(compressed), size)
+	require.NoError(t, err)
+	require.Len(t, blocks, 1)
+	assert.Equal(t, block{offset: 0, size: size}, blocks[0])
+
+	_, err = scanBgzfMembers(bytes.NewReader(compressed[:size-5]), size-5)
+	assert.Error(t, err)
+	_, err = readBgzfIndex(path+bgzfIndexExt, 10)
+	assert.ErrorContains(t, err, "corrupt")
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+)
+
+// dedupeShards is the number of independently locked parts of the set of
+// seen lines, so that workers rarely wait on each other
+const dedupeShards = 256
+
+// deduper remembers every line seen in a run so that repeats of a line are
+// dropped wherever in the input they are. Lines are kept exactly rather than
+// as hashes, so no line is ever dropped for colliding with another.
+type deduper struct {
+	seed    maphash.Seed
+	shards  [dedupeShards]dedupeShard
+	removed atomic.Int64
+}
+
+// dedupeShard is the part of the seen lines with hashes falling to it
+type dedupeShard struct {
+	mu    sync.Mutex
+	lines map[string]struct{}
+}
+
+func newDeduper() *deduper {
+	d := &deduper{seed: maphash.MakeSeed()}
+	for i := range d.shards {
+		d.shards[i].lines = make(map[string]struct{})
+	}
+	return d
+}
+
+// duplicate reports whether the line was seen before, remembering it if not.
+// Its newline is ignored, so the last line of a file matches without one.
+func (d *deduper) duplicate(line []byte) bool {
+	line = bytes.TrimSuffix(line, []byte{'\n'})
+	s := &d.shards[maphash.Bytes(d.seed, line)%dedupeShards]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.lines[string(line)]; ok {
+		d.removed.Add(1)
+		return true
+	}
+	s.lines[string(line)] = struct{}{}
+	return false
+}
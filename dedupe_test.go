@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvalDedupe(t *testing.T) {
+	defer func(b bool) { *dedupeFlag = b }(*dedupeFlag)
+	defer func(r *runReport) { report = r }(report)
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.txt")
+	require.NoError(t, os.WriteFile(a, []byte(
+		"Oslo;1.0\nAbha;30.0\nOslo;1.0\nOslo;2.0\n",
+	), 0o644))
+	// Repeats are found across files too, and the last line matches without
+	// its newline
+	require.NoError(t, os.WriteFile(b, []byte("Abha;30.0\nOslo;2.0"), 0o644))
+
+	*dedupeFlag = true
+	report = &runReport{}
+	var out strings.Builder
+	require.NoError(t, evalFiles(context.Background(), []string{a, b}, &out))
+	assert.Equal(t,
+		"{Abha=30.0/30.0/30.0, Oslo=1.0/1.5/2.0}\n", out.String(),
+	)
+	assert.EqualValues(t, 3, report.Duplicates)
+}
+
+func TestDeduper(t *testing.T) {
+	d := newDeduper()
+	assert.False(t, d.duplicate([]byte("Oslo;1.0\n")))
+	assert.True(t, d.duplicate([]byte("Oslo;1.0")))
+	assert.False(t, d.duplicate([]byte("Oslo;1.0\r\n")))
+	assert.False(t, d.duplicate([]byte("Oslo;1.00\n")))
+	assert.EqualValues(t, 1, d.removed.Load())
+}
+
+func TestReadStatsConcurrentRuns(t *testing.T) {
+	// Runs keep their state apart, so each dedupes only its own input
+	dir := t.TempDir()
+	fpaths := make([]string, 4)
+	for i := range fpaths {
+		fpaths[i] = filepath.Join(dir, fmt.Sprintf("%d.txt", i))
+		input := strings.Repeat("Oslo;1.0\n", i+1)
+		require.NoError(t, os.WriteFile(fpaths[i], []byte(input), 0o644))
+	}
+	states := make([]*runState, len(fpaths))
+	var wg sync.WaitGroup
+	for i, fpath := range fpaths {
+		states[i] = &runState{dedupe: newDeduper()}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := readStats(context.Background(), fpath, states[i])
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	for i, rs := range states {
+		assert.EqualValues(t, i, rs.dedupe.removed.Load())
+	}
+}
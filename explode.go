@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// histogramMin is the lowest temperature in tenths of a degree the histograms
+// of -explode-bin-width bin, the bins covering every valid temperature from it
+const histogramMin = -1000
+
+// histograms count the temperatures of each station in bins of equal width,
+// for -explode-dir. Each worker counts the lines it sees, and the counts are
+// merged once it is done.
+type histograms struct {
+	mu     sync.Mutex
+	width  int64
+	counts map[string][]int64
+}
+
+// newHistograms starts histograms with bins of the given width in tenths
+func newHistograms(width int64) *histograms {
+	return &histograms{width: width, counts: make(map[string][]int64)}
+}
+
+// workerHistograms are the histograms of the stations seen by one worker
+type workerHistograms struct {
+	width  int64
+	counts map[string][]int64
+}
+
+// newWorker returns the histograms for a worker to count its lines in
+func (h *histograms) newWorker() *workerHistograms {
+	return &workerHistograms{width: h.width, counts: make(map[string][]int64)}
+}
+
+// histogramBins returns the number of bins of a width in tenths covering
+// every valid temperature
+func histogramBins(width int64) int64 {
+	return (2*-histogramMin + width - 1) / width
+}
+
+// add counts a temperature in tenths for a station
+func (wh *workerHistograms) add(station []byte, tenths int64) {
+	counts, ok := wh.counts[string(station)]
+	if !ok {
+		counts = make([]int64, histogramBins(wh.width))
+		wh.counts[string(station)] = counts
+	}
+	counts[(tenths-histogramMin)/wh.width]++
+}
+
+// done hands a worker's histograms over to be merged
+func (h *histograms) done(wh *workerHistograms) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for station, counts := range wh.counts {
+		total, ok := h.counts[station]
+		if !ok {
+			h.counts[station] = counts
+			continue
+		}
+		for i, n := range counts {
+			total[i] += n
+		}
+	}
+}
+
+// writeExploded writes a CSV file per station to a directory, holding a
+// header and a single row with the min, mean, max and count of the station,
+// followed by the counts of the histogram bins from its min to its max if
+// there are histograms. Stations whose files would only differ in case are
+// refused before anything is written, since one would overwrite the other on
+// case-insensitive filesystems such as those of macOS and Windows.
+func writeExploded(ss *stationStats, hists *histograms, dir string) error {
+	names := make(map[string]string, len(ss.stats))
+	for station := range ss.stats {
+		folded := strings.ToLower(explodedName(station))
+		if other, ok := names[folded]; ok {
+			a, b := min(station, other), max(station, other)
+			return fmt.Errorf(
+				"stations %q and %q would share a file on case-insensitive "+
+					"filesystems", a, b,
+			)
+		}
+		names[folded] = station
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("could not create explode directory: %w", err)
+	}
+	for station, v := range ss.stats {
+		header := []string{"min", "mean", "max", "count"}
+		row := []string{
+			strconv.FormatFloat(degrees(v.Min), 'f', 1, 64),
+			strconv.FormatFloat(compatMean(v), 'f', 1, 64),
+			strconv.FormatFloat(degrees(v.Max), 'f', 1, 64),
+			strconv.FormatInt(v.Count, 10),
+		}
+		if hists != nil {
+			counts := hists.counts[station]
+			first := (v.Min - histogramMin) / hists.width
+			last := (v.Max - histogramMin) / hists.width
+			for i := first; i <= last; i++ {
+				from := histogramMin + i*hists.width
+				header = append(header, fmt.Sprintf(
+					"%.1f..%.1f", degrees(from), degrees(from+hists.width),
+				))
+				n := int64(0)
+				if counts != nil {
+					n = counts[i]
+				}
+				row = append(row, strconv.FormatInt(n, 10))
+			}
+		}
+		fpath := filepath.Join(dir, explodedName(station)+".csv")
+		if err := writeExplodedFile(fpath, header, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeExplodedFile writes the header and row of a station to its file
+func writeExplodedFile(fpath string, header, row []string) error {
+	f, err := os.Create(fpath)
+	if err != nil {
+		return fmt.Errorf("could not create explode file: %w", err)
+	}
+	w := csv.NewWriter(f)
+	w.Write(header)
+	w.Write(row)
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return fmt.Errorf("could not write explode file: %w", err)
+	}
+	return f.Close()
+}
+
+// explodedName returns the file name of a station, without extension. Letters,
+// digits, spaces and -_(),' are kept, and any other byte is percent-encoded,
+// as is a leading dot, so that every station gets a distinct name that is
+// neither hidden nor outside of the directory. Names may still differ only in
+// case, which writeExploded checks for.
+func explodedName(station string) string {
+	if station == "" {
+		return "%"
+	}
+	var b strings.Builder
+	for i := 0; i < len(station); {
+		r, size := utf8.DecodeRuneInString(station[i:])
+		keep := size > 1 || r != utf8.RuneError
+		keep = keep && (unicode.IsLetter(r) || unicode.IsDigit(r) ||
+			strings.ContainsRune(" -_(),'", r) || r == '.' && i > 0)
+		if keep {
+			b.WriteString(station[i : i+size])
+		} else {
+			for _, c := range []byte(station[i : i+size]) {
+				fmt.Fprintf(&b, "%%%02X", c)
+			}
+		}
+		i += size
+	}
+	return b.String()
+}
+
+// binWidth converts a bin width in degrees to tenths, or 0 for none
+func binWidth(degrees float64) int64 {
+	return int64(math.Round(degrees * 10))
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplodedName(t *testing.T) {
+	cases := map[string]string{
+		"Abéché":           "Abéché",
+		"Washington, D.C.": "Washington, D.C.",
+		"a/b":              "a%2Fb",
+		".hidden":          "%2Ehidden",
+		"..":               "%2E.",
+		"":                 "%",
+		"%":                "%25",
+		"\xff":             "%FF",
+	}
+	names := map[string]bool{}
+	for station, want := range cases {
+		name := explodedName(station)
+		assert.Equal(t, want, name, station)
+		assert.False(t, names[name], station)
+		names[name] = true
+	}
+}
+
+func TestEvalExplodeDir(t *testing.T) {
+	defer func(d string, w float64, n int, j int) {
+		*explodeDir, *explodeBinWidth, chunkSize, *jobs = d, w, n, j
+	}(*explodeDir, *explodeBinWidth, chunkSize, *jobs)
+	// Several workers each count part of the stations' lines
+	chunkSize, *jobs = 64, 4
+	input := filepath.Join(t.TempDir(), "input.txt")
+	require.NoError(t, os.WriteFile(input, []byte(
+		"Oslo;-3.0\nSt. John's;5.0\nOslo;1.0\nOslo;2.4\nSt. John's;5.9\n",
+	), 0o644))
+	*explodeDir = filepath.Join(t.TempDir(), "out")
+	*explodeBinWidth = 2.5
+	var out strings.Builder
+	require.NoError(t, eval(context.Background(), input, &out))
+	assert.Equal(t, "{Oslo=-3.0/0.1/2.4, St. John's=5.0/5.5/5.9}\n", out.String())
+
+	oslo, err := os.ReadFile(filepath.Join(*explodeDir, "Oslo.csv"))
+	require.NoError(t, err)
+	assert.Equal(
+		t,
+		"min,mean,max,count,-5.0..-2.5,-2.5..0.0,0.0..2.5\n"+
+			"-3.0,0.1,2.4,3,1,0,2\n",
+		string(oslo),
+	)
+	john, err := os.ReadFile(filepath.Join(*explodeDir, "St. John's.csv"))
+	require.NoError(t, err)
+	assert.Equal(t, "min,mean,max,count,5.0..7.5\n5.0,5.5,5.9,2,2\n", string(john))
+}
+
+func TestExplodeDirFlags(t *testing.T) {
+	defer func(w float64) { *explodeBinWidth = w }(*explodeBinWidth)
+	*explodeBinWidth = 0.25
+	assert.ErrorContains(t, validateFlags(), "must be a positive multiple of 0.1")
+	*explodeBinWidth = 1
+	assert.ErrorContains(t, validateFlags(), "can only be used with -explode-dir")
+}
+
+func TestWriteExplodedCaseCollision(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "out")
+	ss := &stationStats{stats: map[string]*stat{
+		"Oslo": {Min: 10, Max: 10, Count: 1, Sum: 10},
+		"OSLO": {Min: 20, Max: 20, Count: 1, Sum: 20},
+	}}
+	err := writeExploded(ss, nil, dir)
+	assert.EqualError(
+		t, err,
+		`stations "OSLO" and "Oslo" would share a file on case-insensitive filesystems`,
+	)
+	// Nothing is written
+	assert.NoDirExists(t, dir)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// extractPlaceholder is replaced by the station name in -extract-out
+const extractPlaceholder = "{station}"
+
+// stringList is a flag that may be repeated, collecting every value
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// extractor writes the raw lines of selected stations to separate files
+type extractor struct {
+	files map[string]*extractFile
+}
+
+// extractFile is the destination of a single station's lines, shared by all
+// workers. Write errors are kept until the file is closed.
+type extractFile struct {
+	mu  sync.Mutex
+	f   *os.File
+	w   *bufio.Writer
+	err error
+}
+
+// newExtractor creates one output file per station from the path template,
+// which must contain {station} if more than one station is extracted
+func newExtractor(stations []string, template string) (*extractor, error) {
+	if len(stations) > 1 && !strings.Contains(template, extractPlaceholder) {
+		return nil, fmt.Errorf(
+			"-extract-out must contain %s to extract several stations",
+			extractPlaceholder,
+		)
+	}
+	ex := &extractor{files: make(map[string]*extractFile)}
+	for _, station := range stations {
+		if _, ok := ex.files[station]; ok {
+			continue
+		}
+		fpath := strings.ReplaceAll(template, extractPlaceholder, station)
+		f, err := os.Create(fpath)
+		if err != nil {
+			ex.close()
+			return nil, fmt.Errorf("could not create extract file: %w", err)
+		}
+		ex.files[station] = &extractFile{f: f, w: bufio.NewWriter(f)}
+	}
+	return ex, nil
+}
+
+// write appends lines that a worker collected for a station
+func (ex *extractor) write(station string, lines []byte) {
+	ef := ex.files[station]
+	ef.mu.Lock()
+	defer ef.mu.Unlock()
+	if ef.err == nil {
+		_, ef.err = ef.w.Write(lines)
+	}
+}
+
+// flush writes out the lines a worker buffered for each station
+func (ex *extractor) flush(buffered map[string][]byte) {
+	for station, lines := range buffered {
+		if len(lines) > 0 {
+			ex.write(station, lines)
+			buffered[station] = lines[:0]
+		}
+	}
+}
+
+// close flushes and closes every extract file, returning the first error any
+// write ran into
+func (ex *extractor) close() error {
+	var firstErr error
+	for _, ef := range ex.files {
+		if ef.err != nil && firstErr == nil {
+			firstErr = ef.err
+		}
+		if err := ef.w.Flush(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if err := ef.f.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
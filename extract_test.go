@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtract(t *testing.T) {
+	defer func(l stringList, out string) {
+		extractStations, *extractOut = l, out
+	}(extractStations, *extractOut)
+	dir := t.TempDir()
+	extractStations = stringList{"ham", "jel"}
+	*extractOut = filepath.Join(dir, extractPlaceholder+".txt")
+
+	input := filepath.Join(sampleInputDir, "measurements-rounding.txt")
+	require.NoError(t, eval(context.Background(), input, io.Discard))
+
+	content, err := readFile(input)
+	require.NoError(t, err)
+	for _, station := range extractStations {
+		expected := []string{}
+		for _, line := range strings.Split(content, "\n") {
+			if strings.HasPrefix(line, station+";") {
+				expected = append(expected, line)
+			}
+		}
+		actual, err := os.ReadFile(filepath.Join(dir, station+".txt"))
+		require.NoError(t, err)
+		assert.ElementsMatch(t, expected, strings.Fields(string(actual)))
+	}
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aeolyus/1brc/internal/pipeline"
+)
+
+// inputFile is one of several input files with its size when the run started,
+// or -1 if it is not a regular file, and its decoder if it is compressed
+type inputFile struct {
+	path string
+	size int64
+	dec  decoder
+}
+
+// whole reports whether the file is small enough to be handed to a worker as
+// a single chunk
+func (f inputFile) whole() bool {
+	return f.dec == nil && f.size >= 0 && f.size <= int64(chunkSize)
+}
+
+// inputPaths returns the input files of the run: -input followed by any
+// further files given as arguments
+func inputPaths() []string {
+	var paths []string
+	if *input != "" {
+		paths = append(paths, *input)
+	}
+	return append(paths, flag.Args()...)
+}
+
+// timeBound is a flag bounding the modification times of input files, given
+// as a date, an RFC 3339 time or an age such as 36h or 7d
+type timeBound struct{ time.Time }
+
+func (b *timeBound) String() string {
+	if b.IsZero() {
+		return ""
+	}
+	return b.Format(time.RFC3339)
+}
+
+func (b *timeBound) Set(s string) error {
+	if t, err := time.ParseInLocation(dayLayout, s, time.Local); err == nil {
+		b.Time = t
+		return nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		b.Time = t
+		return nil
+	}
+	var age retention
+	if err := age.Set(s); err != nil {
+		return fmt.Errorf("%q is neither a date, a time nor an age", s)
+	}
+	b.Time = now().Add(-time.Duration(age))
+	return nil
+}
+
+// directoryInput reports whether any of the inputs is a directory
+func directoryInput() bool {
+	for _, fpath := range inputPaths() {
+		if info, err := os.Stat(fpath); err == nil && info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// excluded reports whether a file or directory found under a directory input
+// matches an -exclude pattern, by either its path relative to the directory
+// or its name
+func excluded(rel string, name string) bool {
+	for _, pattern := range excludePatterns {
+		if ok, _ := filepath.Match(pattern, filepath.ToSlash(rel)); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// modifiedWithin reports whether a modification time is within -since,
+// inclusive, and -until, exclusive
+func modifiedWithin(mtime time.Time) bool {
+	if !since.IsZero() && mtime.Before(since.Time) {
+		return false
+	}
+	return until.IsZero() || mtime.Before(until.Time)
+}
+
+// severalInputs reports whether the run reads more than one input file, or a
+// directory or list of them
+func severalInputs() bool {
+	if *inputList != "" {
+		return true
+	}
+	paths := inputPaths()
+	if len(paths) != 1 {
+		return len(paths) > 1
+	}
+	info, err := os.Stat(paths[0])
+	return err == nil && info.IsDir()
+}
+
+// expandInputs replaces every directory among the inputs by the files in it
+// with the -ext extension, descending into subdirectories with -recursive.
+// Files of a directory are listed in lexical order, so that runs over the same
+// layout read and report them in the same order. Hidden files and directories
+// are skipped, as are those matching -exclude and files modified outside of
+// -since and -until.
+func expandInputs(fpaths []string) ([]string, error) {
+	var files []string
+	for _, fpath := range fpaths {
+		if fpath == stdinInput {
+			files = append(files, fpath)
+			continue
+		}
+		info, err := os.Stat(fpath)
+		if err != nil {
+			return nil, fmt.Errorf("could not stat file: %w", err)
+		}
+		if !info.IsDir() {
+			files = append(files, fpath)
+			continue
+		}
+		n := len(files)
+		err = filepath.WalkDir(fpath, func(
+			path string, d fs.DirEntry, err error,
+		) error {
+			if err != nil {
+				return err
+			}
+			if path == fpath {
+				return nil
+			}
+			rel, err := filepath.Rel(fpath, path)
+			if err != nil {
+				return err
+			}
+			skip := strings.HasPrefix(d.Name(), ".") || excluded(rel, d.Name())
+			if d.IsDir() {
+				if skip || !*recursive {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if skip || filepath.Ext(path) != *inputExt {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if modifiedWithin(info.ModTime()) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not list directory: %w", err)
+		}
+		if len(files) == n {
+			return nil, fmt.Errorf(
+				"no input files with extension %q left in %s", *inputExt, fpath,
+			)
+		}
+	}
+	return files, nil
+}
+
+// statInputs records the size of every input file
+func statInputs(fpaths []string) ([]inputFile, error) {
+	files := make([]inputFile, len(fpaths))
+	for i, fpath := range fpaths {
+		info, err := os.Stat(fpath)
+		if err != nil {
+			return nil, fmt.Errorf("could not stat file: %w", err)
+		}
+		files[i] = inputFile{path: fpath, size: -1}
+		if info.Mode().IsRegular() {
+			files[i].size = info.Size()
+		}
+		if files[i].dec, err = detectDecoder(fpath); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// readFiles reads several input files and returns a map of station statistics
+// across all of them. The files are always streamed rather than mapped.
+func readFiles(
+	ctx context.Context, fpaths []string, rs *runState,
+) (*stationStats, error) {
+	files, err := statInputs(fpaths)
+	if err != nil {
+		return nil, err
+	}
+	// Shards usually split the same stations, so the largest file tells
+	// the most about the cardinality of all of them
+	var largest *inputFile
+	for i, f := range files {
+		if f.dec == nil && (largest == nil || f.size > largest.size) {
+			largest = &files[i]
+		}
+	}
+	stations := *expectStations
+	if largest != nil {
+		if stations, err = estimateStations(largest.path); err != nil {
+			return nil, err
+		}
+	}
+	if report != nil {
+		report.Strategy = strategyStream
+		report.ExpectedStations = stations
+	}
+	return process(ctx, rs, stations, func(
+		ctx context.Context, chunkChan chan<- []byte, counts *chunkCounts,
+	) error {
+		return scheduleFiles(ctx, files, chunkChan, counts)
+	})
+}
+
+// readEachFile reads the input files one after the other, returning the
+// statistics of each besides those across all of them
+func readEachFile(
+	ctx context.Context, fpaths []string, rs *runState,
+) (*stationStats, []*stationStats, error) {
+	total := &stationStats{stats: make(map[string]*stat)}
+	perFile := make([]*stationStats, len(fpaths))
+	for i, fpath := range fpaths {
+		ss, err := readStats(ctx, fpath, rs)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", fpath, err)
+		}
+		mergeStats(total.stats, ss.stats)
+		perFile[i] = ss
+	}
+	return total, perFile, nil
+}
+
+// scheduleFiles feeds several input files to a channel. Files no larger than
+// a chunk are read whole by as many readers as there are workers, each file
+// becoming a single chunk, so that thousands of small shards are not each cut
+// up and carried over line by line; larger files are chunked one at a time
+// alongside them.
+func scheduleFiles(
+	ctx context.Context, files []inputFile, chunkChan chan<- []byte,
+	counts *chunkCounts,
+) error {
+	defer close(chunkChan)
+	if *maxReadMbps > 0 {
+		// The limit is held by a single bucket, so read one file at a
+		// time
+		throttle := newTokenBucket(*maxReadMbps, chunkSize)
+		for _, f := range files {
+			if err := sendFile(ctx, f, chunkChan, counts, throttle); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := pipeline.NewFirstError(cancel)
+	var large []inputFile
+	for _, f := range files {
+		if !f.whole() {
+			large = append(large, f)
+		}
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for _, f := range large {
+			if err := sendFile(ctx, f, chunkChan, counts, nil); err != nil {
+				errs.Set(err)
+				return
+			}
+		}
+	}()
+	readers := *jobs
+	if readers <= 0 {
+		readers = defaultJobs(cgroupLimits())
+	}
+	errs.Set(pipeline.Run(ctx, 0, readers,
+		func(ctx context.Context, small chan<- inputFile) error {
+			defer close(small)
+			for _, f := range files {
+				if !f.whole() {
+					continue
+				}
+				select {
+				case small <- f:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			return nil
+		},
+		func(ctx context.Context, small <-chan inputFile) error {
+			for f := range small {
+				err := sendFile(ctx, f, chunkChan, counts, nil)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	))
+	wg.Wait()
+	if err := errs.Err(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// sendFile feeds one input file to a channel, as a single chunk if it is small
+// enough and chunk by chunk otherwise
+func sendFile(
+	ctx context.Context, f inputFile, chunkChan chan<- []byte,
+	counts *chunkCounts, throttle *tokenBucket,
+) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if f.dec != nil {
+		return decodeChunks(ctx, f.path, f.dec, chunkChan, counts)
+	}
+	if !f.whole() {
+		return readChunks(ctx, f.path, chunkChan, counts, throttle)
+	}
+	if throttle != nil {
+		if err := throttle.wait(ctx, int(f.size)); err != nil {
+			return err
+		}
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return fmt.Errorf("could not read file: %w", err)
+	}
+	if *tolerateGrowth && int64(len(data)) > f.size {
+		data = data[:f.size]
+	} else if err := sizeChanged(f.size, int64(len(data))); err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	return counts.sendFrom(ctx, chunkChan, data, chunkOrigin{f.path, 0})
+}
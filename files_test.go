@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// splitSample splits a sample input into shards of the given sizes in lines,
+// the last one taking the remaining lines
+func splitSample(t *testing.T, fpath string, sizes ...int) []string {
+	t.Helper()
+	data, err := os.ReadFile(fpath)
+	require.NoError(t, err)
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	dir := t.TempDir()
+	var paths []string
+	for i := 0; i <= len(sizes); i++ {
+		n := len(lines)
+		if i < len(sizes) {
+			n = min(sizes[i], n)
+		}
+		path := filepath.Join(dir, fmt.Sprintf("shard-%d.txt", i))
+		require.NoError(t, os.WriteFile(path, bytes.Join(lines[:n], nil), 0o644))
+		paths = append(paths, path)
+		lines = lines[n:]
+	}
+	return paths
+}
+
+func TestEvalFiles(t *testing.T) {
+	defer func(n int, mbps float64) {
+		chunkSize, *maxReadMbps = n, mbps
+	}(chunkSize, *maxReadMbps)
+	// Mix shards read whole with ones larger than a chunk
+	chunkSize = 4096
+	input := filepath.Join(sampleInputDir, "measurements-10000-unique-keys")
+	expected, err := readFile(input + sampleOutputExt)
+	require.NoError(t, err)
+	shards := splitSample(t, input+sampleInputExt, 10, 1000, 1, 50, 3000, 7)
+	for _, mbps := range []float64{0, 1e6} {
+		*maxReadMbps = mbps
+		t.Run(fmt.Sprint(mbps), func(t *testing.T) {
+			var out strings.Builder
+			require.NoError(t, evalFiles(context.Background(), shards, &out))
+			assert.Equal(t, expected, out.String())
+		})
+	}
+}
+
+func TestEvalFilesMissing(t *testing.T) {
+	input := filepath.Join(sampleInputDir, "measurements-1.txt")
+	missing := filepath.Join(t.TempDir(), "missing.txt")
+	err := evalFiles(
+		context.Background(), []string{input, missing}, &strings.Builder{},
+	)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestScheduleFilesWhole(t *testing.T) {
+	defer func(n int) { chunkSize = n }(chunkSize)
+	chunkSize = 4096
+	input := filepath.Join(sampleInputDir, "measurements-10000-unique-keys.txt")
+	shards := splitSample(t, input, 10, 20, 300)
+	files, err := statInputs(shards)
+	require.NoError(t, err)
+
+	chunkChan := make(chan []byte, 1024)
+	counts := &chunkCounts{}
+	require.NoError(t, scheduleFiles(
+		context.Background(), files, chunkChan, counts,
+	))
+	var chunks []string
+	for chunk := range chunkChan {
+		chunks = append(chunks, string(chunk))
+	}
+	// The small shards come whole, the last one in several chunks
+	var total int64
+	for _, f := range files {
+		data, err := os.ReadFile(f.path)
+		require.NoError(t, err)
+		if f.whole() {
+			assert.Contains(t, chunks, string(data))
+		}
+		total += f.size
+	}
+	assert.False(t, files[3].whole())
+	assert.Greater(t, len(chunks), len(files))
+	assert.Equal(t, total, counts.sent.Load())
+}
+
+func TestExpandInputs(t *testing.T) {
+	defer func(ext string, r bool) {
+		*inputExt, *recursive = ext, r
+	}(*inputExt, *recursive)
+	dir := t.TempDir()
+	for _, name := range []string{
+		"2024-06-02.txt", "2024-06-01.txt", "notes.md", ".hidden.txt",
+		"06/03.txt", "06/01.txt", ".git/x.txt",
+	} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte("a;1.0\n"), 0o644))
+	}
+	single := filepath.Join(sampleInputDir, "measurements-1.txt")
+	at := func(names ...string) []string {
+		paths := []string{single}
+		for _, name := range names {
+			paths = append(paths, filepath.Join(dir, name))
+		}
+		return paths
+	}
+
+	files, err := expandInputs([]string{single, dir})
+	require.NoError(t, err)
+	assert.Equal(t, at("2024-06-01.txt", "2024-06-02.txt"), files)
+
+	*recursive = true
+	files, err = expandInputs([]string{single, dir})
+	require.NoError(t, err)
+	assert.Equal(
+		t, at("06/01.txt", "06/03.txt", "2024-06-01.txt", "2024-06-02.txt"),
+		files,
+	)
+
+	*inputExt = ".csv"
+	_, err = expandInputs([]string{dir})
+	assert.ErrorContains(t, err, `no input files with extension ".csv"`)
+}
+
+func TestEvalDirectory(t *testing.T) {
+	input := filepath.Join(sampleInputDir, "measurements-10000-unique-keys")
+	expected, err := readFile(input + sampleOutputExt)
+	require.NoError(t, err)
+	shards := splitSample(t, input+sampleInputExt, 100, 2000, 5)
+	files, err := expandInputs([]string{filepath.Dir(shards[0])})
+	require.NoError(t, err)
+	assert.Equal(t, shards, files)
+	var out strings.Builder
+	require.NoError(t, evalFiles(context.Background(), files, &out))
+	assert.Equal(t, expected, out.String())
+}
+
+func TestExpandInputsFilters(t *testing.T) {
+	defer func(r bool, ex stringList, s, u timeBound) {
+		*recursive, excludePatterns, since, until = r, ex, s, u
+	}(*recursive, excludePatterns, since, until)
+	*recursive = true
+	dir := t.TempDir()
+	day := func(d int) time.Time {
+		return time.Date(2024, 6, d, 12, 0, 0, 0, time.Local)
+	}
+	for name, mtime := range map[string]time.Time{
+		"06-01.txt":     day(1),
+		"06-02.txt":     day(2),
+		"06-03.txt":     day(3),
+		"06-03.tmp.txt": day(3),
+		"old/06-01.txt": day(1),
+	} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte("a;1.0\n"), 0o644))
+		require.NoError(t, os.Chtimes(path, mtime, mtime))
+	}
+	at := func(names ...string) []string {
+		var paths []string
+		for _, name := range names {
+			paths = append(paths, filepath.Join(dir, name))
+		}
+		return paths
+	}
+
+	excludePatterns = stringList{"*.tmp.txt", "old"}
+	files, err := expandInputs([]string{dir})
+	require.NoError(t, err)
+	assert.Equal(t, at("06-01.txt", "06-02.txt", "06-03.txt"), files)
+
+	require.NoError(t, since.Set("2024-06-02"))
+	require.NoError(t, until.Set("2024-06-03"))
+	files, err = expandInputs([]string{dir})
+	require.NoError(t, err)
+	assert.Equal(t, at("06-02.txt"), files)
+
+	require.NoError(t, since.Set("2024-06-04"))
+	until = timeBound{}
+	_, err = expandInputs([]string{dir})
+	assert.ErrorContains(t, err, "no input files")
+}
+
+func TestTimeBound(t *testing.T) {
+	defer func(f func() time.Time) { now = f }(now)
+	now = func() time.Time { return time.Date(2024, 6, 8, 0, 0, 0, 0, time.UTC) }
+	var b timeBound
+	require.NoError(t, b.Set("2024-06-01"))
+	assert.Equal(t, time.Date(2024, 6, 1, 0, 0, 0, 0, time.Local), b.Time)
+	require.NoError(t, b.Set("2024-06-01T10:00:00Z"))
+	assert.Equal(t, "2024-06-01T10:00:00Z", b.String())
+	require.NoError(t, b.Set("7d"))
+	assert.Equal(t, "2024-06-01T00:00:00Z", b.String())
+	require.NoError(t, b.Set("36h"))
+	assert.Equal(t, "2024-06-06T12:00:00Z", b.String())
+	assert.Error(t, b.Set("yesterday"))
+}
+
+func TestEvalPerFile(t *testing.T) {
+	defer func(b bool) { *perFileFlag = b }(*perFileFlag)
+	*perFileFlag = true
+	dir := t.TempDir()
+	shards := []string{
+		filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt"),
+	}
+	require.NoError(t, os.WriteFile(
+		shards[0], []byte("Oslo;1.0\nAbha;30.0\n"), 0o644,
+	))
+	require.NoError(t, os.WriteFile(
+		shards[1], []byte("Oslo;-5.0\nOslo;2.0\n"), 0o644,
+	))
+	var out strings.Builder
+	require.NoError(t, evalFiles(context.Background(), shards, &out))
+	assert.Equal(t, strings.Join([]string{
+		"{Abha=30.0/30.0/30.0, Oslo=-5.0/-0.7/2.0}",
+		shards[0] + "\t{Abha=30.0/30.0/30.0, Oslo=1.0/1.0/1.0}",
+		shards[1] + "\t{Oslo=-5.0/-1.5/2.0}",
+		"",
+	}, "\n"), out.String())
+}
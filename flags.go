@@ -0,0 +1,600 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+var input = flag.String("input", "", "input file path")
+var inputList = flag.String(
+	"input-list", "",
+	"file listing further input files, one per line, each optionally "+
+		"followed by its expected size and SHA-256 digest",
+)
+var inputExt = flag.String(
+	"ext", ".txt", "extension of the files to read from a directory -input",
+)
+var recursive = flag.Bool(
+	"recursive", false, "read files in subdirectories of a directory -input",
+)
+var excludePatterns stringList
+var since, until timeBound
+var output = flag.String("output", "", "output file path (default stdout)")
+var outputCompressionFlag = flag.String(
+	"output-compression", "",
+	"compress the output, one of "+strings.Join(compressions, ", ")+
+		" (default by the extension of -output, .gz or .zst)",
+)
+var jobs = flag.Int(
+	"jobs", 0, "number of concurrent jobs (0 to derive from the CPU quota)",
+)
+var chunkSizeFlag = flag.Int(
+	"chunk-size", 0,
+	"size in bytes of the chunks handed to workers "+
+		"(0 to derive from the memory limit)",
+)
+var memLimit = flag.Int64(
+	"memlimit", 0,
+	"soft limit in bytes on the heap, nearing which a run prefetches less "+
+		"and then falls back to -spill-dir aggregation in the temporary "+
+		"directory where it can (0 for none)",
+)
+var prefetch = flag.Int(
+	"prefetch", -1,
+	"number of chunks read ahead of the workers "+
+		"(-1 to derive from the memory limit)",
+)
+var cpuprofile = flag.String("cpuprofile", "", "write cpu profile to file")
+var memprofile = flag.String(
+	"memprofile", "", "write heap profile to file once the run is done",
+)
+var traceFile = flag.String("trace", "", "write execution trace to file")
+var strategy = flag.String(
+	"strategy", strategyAuto,
+	"how to read the input: auto, stream, mmap or readat",
+)
+var remoteFS = flag.Bool(
+	"remote-fs", false,
+	"tune reading for a network filesystem with larger chunks, deeper "+
+		"prefetch and a single sequential reader (detected where possible)",
+)
+var reportPath = flag.String(
+	"report", "", "write a JSON manifest of the run to file",
+)
+var reportDigest = flag.Bool(
+	"report-digest", false,
+	"record the SHA-256 digest of the input in -report, reading it again "+
+		"once the run is done",
+)
+var version = flag.Bool("version", false, "print build information and exit")
+var gcStats = flag.Bool(
+	"gcstats", false, "print garbage collection cycles and pauses to stderr",
+)
+var twoStage = flag.Bool(
+	"two-stage", false,
+	"experimentally split parsing and aggregation into separate stages, "+
+		"parsers batching records for aggregator shards",
+)
+var batchSize = flag.Int(
+	"batch-size", 4096,
+	"number of records parsers hand to an aggregator shard at once with "+
+		"-two-stage",
+)
+var stageStats = flag.Bool(
+	"stats", false,
+	"print the items, wait and busy time of each pipeline stage to stderr",
+)
+var noGC = flag.Bool(
+	"nogc", false,
+	"disable garbage collection during the run and collect once at the end",
+)
+var background = flag.Bool(
+	"background", false,
+	"lower CPU and I/O priority so long runs do not starve interactive work",
+)
+var maxReadMbps = flag.Float64(
+	"max-read-mbps", 0,
+	"limit reading the input to this many megabits per second (0 for no limit)",
+)
+var timeout = flag.Duration(
+	"timeout", 0, "abort the run if processing takes longer, e.g. 120s",
+)
+var soakRuns = flag.Int(
+	"soak", 0,
+	"run the pipeline this many times, checking results stay identical "+
+		"and memory bounded",
+)
+var estimateCardinalityFlag = flag.Bool(
+	"estimate-cardinality", false,
+	"only write an estimate of the number of distinct stations, within "+
+		"about 1%, without aggregating them",
+)
+var tolerateGrowth = flag.Bool(
+	"tolerate-growth", false,
+	"process only the size the input had when opened if it grows meanwhile",
+)
+var statePath = flag.String(
+	"state", "",
+	"file of aggregates from previous runs to add the input to and update",
+)
+var retain retention
+var keyFile = flag.String(
+	"key-file", "",
+	"file holding a 32-byte key, raw or in hex or base64, to encrypt -state "+
+		"and -spill-dir files with (default $"+atRestKeyEnv+")",
+)
+var force = flag.Bool(
+	"force", false, "process the input even if it does not look like text",
+)
+var tableMode = flag.String(
+	"table", tableMerge,
+	"how workers aggregate: merge their own tables at the end, or update "+
+		"a shared one",
+)
+var flushInterval = flag.Duration(
+	"flush-interval", 10*time.Second,
+	"how often workers hand their stats to the aggregator (0 for only at "+
+		"the end)",
+)
+var seed = flag.Int64(
+	"seed", 0,
+	"seed for randomized features (0 for a random seed, recorded in -report)",
+)
+var expectStations = flag.Int(
+	"expect-stations", 0,
+	"expected number of distinct stations (0 to estimate from a sample)",
+)
+var sqlQuery = flag.String(
+	"query", "",
+	"print the result of a SQL query over the stats table instead, e.g.\n"+
+		"SELECT station, mean FROM stats WHERE max > 40 "+
+		"ORDER BY mean DESC LIMIT 10",
+)
+var bucketByInitial = flag.Bool(
+	"bucket-by-initial", false,
+	"print the number of stations and measurements and the mean temperature "+
+		"per initial letter of the station names instead",
+)
+var sortBy = flag.String(
+	"sort-by", colStation,
+	"columns to sort the output by, each optionally followed by :desc, "+
+		"e.g. mean:desc,station",
+)
+var noSort = flag.Bool(
+	"no-sort", false,
+	"write stations unsorted, in an unspecified order that varies between "+
+		"runs",
+)
+var compat = flag.String(
+	"compat", compatCustom,
+	"reproduce the rounding and ordering of a reference implementation, "+
+		"one of "+strings.Join(compatProfiles, ", ")+
+		" (as given by the other flags)",
+)
+var rounding = flag.String(
+	"rounding", roundHalfUp,
+	"how means are rounded to a tenth, one of "+strings.Join(roundings, ", ")+
+		" ("+roundCeil+" for the output of earlier versions)",
+)
+var outputFormat = flag.String(
+	"format", formatBrc,
+	"format of the results, one of "+strings.Join(formats, ", "),
+)
+var outDecimalComma = flag.Bool(
+	"out-decimal-comma", false,
+	"write decimal commas in human-facing output such as -query tables",
+)
+var thousandsSep = flag.String(
+	"thousands-sep", "",
+	"separator between thousands in human-facing output, e.g. ' ' or ','",
+)
+var siCounts = flag.Bool(
+	"si-counts", false,
+	"abbreviate counts in human-facing output to SI units, e.g. 10.2M",
+)
+var perFileFlag = flag.Bool(
+	"per-file", false,
+	"after the results across all inputs, write the results of each input "+
+		"file on a line of its own, after its path and a tab",
+)
+var spillDir = flag.String(
+	"spill-dir", "",
+	"aggregate through partition files in this directory instead of "+
+		"memory, for inputs with more distinct stations than fit in RAM",
+)
+var spillPartitions = flag.Int(
+	"spill-partitions", 64, "number of partitions to spill to",
+)
+var cleanOut = flag.String(
+	"clean-out", "",
+	"also write the parsed lines, normalized, to this file, compressed "+
+		"with zstd if it ends in .zst; results are then those of the copy",
+)
+var sampleLines = flag.Int(
+	"sample-lines", 1000, "number of raw lines -sample-out samples",
+)
+var sampleOut = flag.String(
+	"sample-out", "",
+	"also write a uniform random sample of -sample-lines raw lines of the "+
+		"input to this file",
+)
+var normalizeOut = flag.String(
+	"normalize-out", "",
+	"also write every measurement as station;zscore, standardized by the "+
+		"mean and standard deviation of its station, to this file in a "+
+		"second pass over the input",
+)
+var explodeDir = flag.String(
+	"explode-dir", "",
+	"also write a CSV file per station with its min, mean, max and count to "+
+		"this directory",
+)
+var explodeBinWidth = flag.Float64(
+	"explode-bin-width", 0,
+	"add a histogram of temperatures in bins this many degrees wide to the "+
+		"files of -explode-dir (0 for none)",
+)
+var badLineExamples = flag.Int(
+	"bad-line-examples", 10,
+	"number of malformed lines -report keeps as examples, with their offsets",
+)
+var rejectOut = flag.String(
+	"reject-out", "",
+	"also write every skipped line to this file, after the reason and "+
+		"where it is in the input",
+)
+var dedupeFlag = flag.Bool(
+	"dedupe", false,
+	"drop lines repeating an earlier line exactly, anywhere in the input",
+)
+var extractStations stringList
+var extractOut = flag.String(
+	"extract-out", extractPlaceholder+".txt",
+	"path of the files raw lines of -extract stations are written to",
+)
+
+func init() {
+	flag.Var(
+		&extractStations, "extract",
+		"also write every raw line of this station to -extract-out "+
+			"(may be repeated)",
+	)
+	flag.Var(
+		&excludePatterns, "exclude",
+		"skip files and directories of a directory -input matching this "+
+			"glob, e.g. '*.tmp' or '2023-*' (may be repeated)",
+	)
+	flag.Var(
+		&since, "since",
+		"read only files of a directory -input modified at or after this "+
+			"date, time or age, e.g. 2024-06-01 or 7d",
+	)
+	flag.Var(
+		&until, "until",
+		"read only files of a directory -input modified before this date, "+
+			"time or age",
+	)
+	flag.Var(
+		&retain, "retain",
+		"with -state, age out days of aggregates older than this, e.g. 30d",
+	)
+}
+
+// flagAliases maps short aliases to the flags they stand for. Like every flag,
+// aliases may be given with one or two dashes, e.g. -i or --input=.
+var flagAliases = map[string]string{
+	"i": "input",
+	"o": "output",
+	"j": "jobs",
+}
+
+func init() {
+	registerAliases(flag.CommandLine, flagAliases)
+}
+
+// registerAliases registers each alias as another name for the value of the
+// flag it stands for
+func registerAliases(fs *flag.FlagSet, aliases map[string]string) {
+	for alias, name := range aliases {
+		f := fs.Lookup(name)
+		fs.Var(f.Value, alias, "alias for -"+name)
+	}
+}
+
+// envPrefix prefixes the environment variables flags can be set from
+const envPrefix = "BRC_"
+
+// envName returns the environment variable a flag can be set from, e.g.
+// BRC_EXPECT_STATIONS for -expect-stations
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// applyEnv sets every flag not given on the command line from its environment
+// variable, if set. Flags on the command line take precedence over the
+// environment, which takes precedence over the defaults.
+func applyEnv(fs *flag.FlagSet, aliases map[string]string) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+		if name, ok := aliases[f.Name]; ok {
+			set[name] = true
+		}
+	})
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if _, ok := aliases[f.Name]; ok || set[f.Name] || err != nil {
+			return
+		}
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok {
+			return
+		}
+		if setErr := fs.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf(
+				"invalid value %q for %s: %w", value, envName(f.Name), setErr,
+			)
+		}
+	})
+	return err
+}
+
+// validateFlags checks flag values and combinations up front, returning every
+// problem found rather than failing deep inside the pipeline
+func validateFlags() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	check(
+		slices.Contains(strategies, *strategy),
+		"-strategy must be one of %s, got %q",
+		strings.Join(strategies, ", "), *strategy,
+	)
+	check(
+		!*remoteFS || *strategy != strategyMmap && *strategy != strategyReadAt,
+		"-remote-fs cannot be used with -strategy %s", *strategy,
+	)
+	check(*jobs >= 0, "-jobs must be at least 1, or 0 to derive, got %d", *jobs)
+	check(
+		*chunkSizeFlag >= 0,
+		"-chunk-size must be a positive number of bytes, or 0 to derive, got %d",
+		*chunkSizeFlag,
+	)
+	check(
+		*prefetch >= -1,
+		"-prefetch must be at least 0, or -1 to derive, got %d", *prefetch,
+	)
+	check(
+		*memLimit >= 0,
+		"-memlimit must be a positive number of bytes, or 0 for none, got %d",
+		*memLimit,
+	)
+	check(
+		*expectStations >= 0,
+		"-expect-stations must be positive, or 0 to estimate, got %d",
+		*expectStations,
+	)
+	check(
+		*maxReadMbps >= 0,
+		"-max-read-mbps must be positive, or 0 for no limit, got %v",
+		*maxReadMbps,
+	)
+	check(
+		!*reportDigest || *reportPath != "",
+		"-report-digest can only be used with -report",
+	)
+	check(*timeout >= 0, "-timeout must be positive, got %s", *timeout)
+	_, err := parseSortBy(*sortBy)
+	check(err == nil, "-sort-by: %v", err)
+	if *spillDir != "" {
+		check(
+			*sortBy == colStation && !*noSort,
+			"-sort-by and -no-sort cannot be used with -spill-dir",
+		)
+	}
+	check(
+		!*outDecimalComma || *thousandsSep != ",",
+		"-thousands-sep cannot be a comma with -out-decimal-comma",
+	)
+	check(
+		slices.Contains(compatProfiles, *compat),
+		"-compat must be one of %s, got %q",
+		strings.Join(compatProfiles, ", "), *compat,
+	)
+	check(
+		*outputCompressionFlag == "" ||
+			slices.Contains(compressions, *outputCompressionFlag),
+		"-output-compression must be one of %s, got %q",
+		strings.Join(compressions, ", "), *outputCompressionFlag,
+	)
+	check(
+		slices.Contains(roundings, *rounding),
+		"-rounding must be one of %s, got %q",
+		strings.Join(roundings, ", "), *rounding,
+	)
+	check(
+		*compat == compatCustom || *rounding == roundHalfUp,
+		"-rounding cannot be used with -compat %s", *compat,
+	)
+	check(
+		*compat == compatCustom || *sortBy == colStation && !*noSort,
+		"-sort-by and -no-sort cannot be used with -compat %s", *compat,
+	)
+	check(
+		slices.Contains(formats, *outputFormat),
+		"-format must be one of %s, got %q",
+		strings.Join(formats, ", "), *outputFormat,
+	)
+	check(
+		*outputFormat == formatBrc || !*perFileFlag && *sqlQuery == "" &&
+			!*bucketByInitial && !*estimateCardinalityFlag && *spillDir == "",
+		"-format %s cannot be used with -per-file, -query, -bucket-by-initial, "+
+			"-estimate-cardinality or -spill-dir", *outputFormat,
+	)
+	check(
+		slices.Contains(tables, *tableMode),
+		"-table must be one of %s, got %q", strings.Join(tables, ", "), *tableMode,
+	)
+	check(
+		*flushInterval >= 0,
+		"-flush-interval must be positive, got %s", *flushInterval,
+	)
+	check(*soakRuns >= 0, "-soak must be positive, got %d", *soakRuns)
+	check(
+		*badLineExamples >= 0,
+		"-bad-line-examples must be positive, got %d", *badLineExamples,
+	)
+	check(
+		*sampleLines >= 1,
+		"-sample-lines must be at least 1, got %d", *sampleLines,
+	)
+	if severalInputs() {
+		check(
+			*strategy != strategyMmap && *strategy != strategyReadAt,
+			"-strategy %s cannot be used with several inputs", *strategy,
+		)
+		check(*spillDir == "", "-spill-dir cannot be used with several inputs")
+	}
+	if readsStdin() {
+		// Stdin is streamed once, so it can neither be read again nor at
+		// offsets, and has no size
+		check(!severalInputs(), "stdin cannot be read along with other inputs")
+		check(
+			*strategy != strategyMmap && *strategy != strategyReadAt,
+			"-strategy %s cannot be used with stdin", *strategy,
+		)
+		check(
+			*soakRuns == 0 && *spillDir == "" && !*estimateCardinalityFlag &&
+				*reportPath == "",
+			"stdin cannot be read with -soak, -spill-dir, "+
+				"-estimate-cardinality or -report",
+		)
+	}
+	for _, pattern := range excludePatterns {
+		_, err := filepath.Match(pattern, "")
+		check(err == nil, "-exclude: invalid pattern %q", pattern)
+	}
+	check(
+		since.IsZero() || until.IsZero() || since.Before(until.Time),
+		"-since must be before -until",
+	)
+	check(
+		len(excludePatterns) == 0 && since.IsZero() && until.IsZero() ||
+			directoryInput(),
+		"-exclude, -since and -until can only be used with a directory -input",
+	)
+	if *spillDir != "" {
+		check(
+			*spillPartitions >= 1,
+			"-spill-partitions must be at least 1, got %d", *spillPartitions,
+		)
+		check(*sqlQuery == "", "-query cannot be used with -spill-dir")
+		check(!*perFileFlag, "-per-file cannot be used with -spill-dir")
+		check(len(extractStations) == 0, "-extract cannot be used with -spill-dir")
+		check(*cleanOut == "", "-clean-out cannot be used with -spill-dir")
+		check(*normalizeOut == "", "-normalize-out cannot be used with -spill-dir")
+		check(!*dedupeFlag, "-dedupe cannot be used with -spill-dir")
+		check(*sampleOut == "", "-sample-out cannot be used with -spill-dir")
+		check(*rejectOut == "", "-reject-out cannot be used with -spill-dir")
+		check(*statePath == "", "-state cannot be used with -spill-dir")
+	}
+	if *statePath != "" {
+		check(*soakRuns == 0, "-state cannot be used with -soak")
+	}
+	check(*batchSize >= 1, "-batch-size must be at least 1, got %d", *batchSize)
+	if *twoStage {
+		check(
+			len(extractStations) == 0 && *cleanOut == "" &&
+				*sampleOut == "" && *rejectOut == "" && !*dedupeFlag &&
+				*normalizeOut == "",
+			"-two-stage cannot be used with -extract, -clean-out, "+
+				"-sample-out, -reject-out, -dedupe or -normalize-out",
+		)
+		check(
+			*tableMode == tableMerge,
+			"-two-stage cannot be used with -table %s", *tableMode,
+		)
+		// Readat workers read their own ranges, with no chunks to split
+		// between parsers
+		check(
+			*strategy != strategyReadAt,
+			"-two-stage cannot be used with -strategy readat",
+		)
+	}
+	if *estimateCardinalityFlag {
+		check(
+			*soakRuns == 0 && *spillDir == "" && *statePath == "" &&
+				*sqlQuery == "" && !*perFileFlag,
+			"-estimate-cardinality cannot be used with -soak, -spill-dir, "+
+				"-state, -query or -per-file",
+		)
+	}
+	check(
+		*keyFile == "" || *statePath != "" || *spillDir != "",
+		"-key-file can only be used with -state or -spill-dir",
+	)
+	check(retain >= 0, "-retain must be positive, got %s", &retain)
+	check(
+		retain == 0 || *statePath != "", "-retain can only be used with -state",
+	)
+	if len(extractStations) > 1 {
+		check(
+			strings.Contains(*extractOut, extractPlaceholder),
+			"-extract-out must contain %s to extract several stations",
+			extractPlaceholder,
+		)
+	}
+	if *normalizeOut != "" {
+		// The second pass sees the lines as they are in the input
+		check(
+			*cleanOut == "" && !*dedupeFlag,
+			"-normalize-out cannot be used with -clean-out or -dedupe",
+		)
+		check(!readsStdin(), "-normalize-out cannot be used with stdin")
+	}
+	check(
+		*explodeBinWidth >= 0 && math.Abs(*explodeBinWidth*10-
+			math.Round(*explodeBinWidth*10)) < 1e-9,
+		"-explode-bin-width must be a positive multiple of 0.1, got %g",
+		*explodeBinWidth,
+	)
+	if *explodeBinWidth > 0 {
+		// Histograms are counted as lines are read, so only cover the input
+		check(
+			*explodeDir != "",
+			"-explode-bin-width can only be used with -explode-dir",
+		)
+		check(
+			*statePath == "" && !*twoStage,
+			"-explode-bin-width cannot be used with -state or -two-stage",
+		)
+	}
+	check(
+		*explodeDir == "" || *spillDir == "",
+		"-explode-dir cannot be used with -spill-dir",
+	)
+	if *bucketByInitial {
+		check(
+			*sqlQuery == "" && !*perFileFlag && *spillDir == "" &&
+				!*estimateCardinalityFlag,
+			"-bucket-by-initial cannot be used with -query, -per-file, "+
+				"-spill-dir or -estimate-cardinality",
+		)
+	}
+	if *sqlQuery != "" {
+		_, err := parseQuery(*sqlQuery)
+		check(err == nil, "-query: %v", err)
+		check(!*perFileFlag, "-per-file cannot be used with -query")
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyEnv(t *testing.T) {
+	newFlagSet := func() (*flag.FlagSet, *string, *int, *string) {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		in := fs.String("input", "", "")
+		jobs := fs.Int("jobs", 1, "")
+		stations := fs.String("expect-stations", "", "")
+		registerAliases(fs, map[string]string{"i": "input"})
+		return fs, in, jobs, stations
+	}
+	aliases := map[string]string{"i": "input"}
+	t.Setenv("BRC_INPUT", "env.txt")
+	t.Setenv("BRC_JOBS", "4")
+	t.Setenv("BRC_EXPECT_STATIONS", "413")
+
+	fs, in, jobs, stations := newFlagSet()
+	require.NoError(t, fs.Parse([]string{"-jobs", "2"}))
+	require.NoError(t, applyEnv(fs, aliases))
+	assert.Equal(t, "env.txt", *in)
+	assert.Equal(t, 2, *jobs)
+	assert.Equal(t, "413", *stations)
+
+	fs, in, _, _ = newFlagSet()
+	require.NoError(t, fs.Parse([]string{"-i", "flag.txt"}))
+	require.NoError(t, applyEnv(fs, aliases))
+	assert.Equal(t, "flag.txt", *in)
+
+	t.Setenv("BRC_JOBS", "many")
+	fs, _, _, _ = newFlagSet()
+	require.NoError(t, fs.Parse(nil))
+	assert.ErrorContains(t, applyEnv(fs, aliases), "BRC_JOBS")
+}
+
+func TestValidateFlags(t *testing.T) {
+	require.NoError(t, validateFlags())
+
+	defer func(s string, j int) { *strategy, *jobs = s, j }(*strategy, *jobs)
+	*strategy, *jobs = "fast", -1
+	err := validateFlags()
+	assert.ErrorContains(t, err, "-strategy must be one of auto, stream, mmap")
+	assert.ErrorContains(t, err, "-jobs must be at least 1")
+
+	defer func(b bool) { *twoStage = b }(*twoStage)
+	*strategy, *jobs, *twoStage = strategyReadAt, 0, true
+	assert.ErrorContains(t, validateFlags(),
+		"-two-stage cannot be used with -strategy readat")
+}
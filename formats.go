@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/aeolyus/1brc/brc"
+)
+
+// Formats the results can be written in
+const (
+	// formatBrc is the single line of the challenge output
+	formatBrc = "brc"
+	// formatJSON is an object keyed by station
+	formatJSON = "json"
+	// formatJSONL is a JSON object per line and station
+	formatJSONL = "jsonl"
+	// formatCSV is a header and a row per station
+	formatCSV = "csv"
+)
+
+var formats = []string{formatBrc, formatJSON, formatJSONL, formatCSV}
+
+// writeResults writes the results in the given format, in their order
+func writeResults(rs brc.Results, format string, w io.Writer) error {
+	switch format {
+	case formatJSON:
+		return writeJSON(rs, w)
+	case formatJSONL:
+		return writeJSONL(rs, w)
+	case formatCSV:
+		return writeCSV(rs, w)
+	default:
+		text, _ := rs.MarshalText()
+		_, err := w.Write(append(text, '\n'))
+		return err
+	}
+}
+
+// writeJSON writes the results as a single object keyed by station, e.g.
+// {"Abha":{"min":-23,"mean":18,"max":59.2,"count":3}}, keeping the order of
+// the results, which encoding a map would not
+func writeJSON(rs brc.Results, w io.Writer) error {
+	b := []byte{'{'}
+	for i, r := range rs {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		station, err := json.Marshal(r.Station)
+		if err != nil {
+			return err
+		}
+		stat, err := json.Marshal(r.Stat)
+		if err != nil {
+			return err
+		}
+		b = append(b, station...)
+		b = append(b, ':')
+		b = append(b, stat...)
+	}
+	_, err := w.Write(append(b, "}\n"...))
+	return err
+}
+
+// writeJSONL writes the results as JSON Lines, an object per station such as
+// {"station":"Abha","min":-23,"mean":18,"max":59.2,"count":3}, so that they
+// can be processed a line at a time
+func writeJSONL(rs brc.Results, w io.Writer) error {
+	var b []byte
+	for _, r := range rs {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		b = append(append(b, line...), '\n')
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+// writeCSV writes the results as CSV with a header, temperatures rounded to
+// one decimal as in the challenge output
+func writeCSV(rs brc.Results, w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"station", "min", "mean", "max", "count"})
+	for _, r := range rs {
+		cw.Write([]string{
+			r.Station,
+			strconv.FormatFloat(brc.Round(r.Min), 'f', 1, 64),
+			strconv.FormatFloat(brc.Round(r.Mean), 'f', 1, 64),
+			strconv.FormatFloat(brc.Round(r.Max), 'f', 1, 64),
+			strconv.FormatInt(r.Count, 10),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
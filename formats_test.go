@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aeolyus/1brc/brc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var formatResults = brc.Results{
+	{Station: "Abha", Stat: brc.Stat{Min: -23, Mean: 18, Max: 59.2, Count: 3}},
+	{Station: `Washington, "D.C."`, Stat: brc.Stat{Min: -0.5, Mean: 14.6, Max: 33.3, Count: 1}},
+}
+
+// jsonStat decodes a stat from the JSON object it encodes to, which brc.Stat
+// itself decodes from its text form
+type jsonStat struct {
+	Min   float64 `json:"min"`
+	Mean  float64 `json:"mean"`
+	Max   float64 `json:"max"`
+	Count int64   `json:"count"`
+}
+
+func TestWriteResults(t *testing.T) {
+	var out strings.Builder
+	require.NoError(t, writeResults(formatResults, formatJSON, &out))
+	assert.Equal(
+		t,
+		`{"Abha":{"min":-23,"mean":18,"max":59.2,"count":3},`+
+			`"Washington, \"D.C.\"":{"min":-0.5,"mean":14.6,"max":33.3,"count":1}}`+"\n",
+		out.String(),
+	)
+	var decoded map[string]jsonStat
+	require.NoError(t, json.Unmarshal([]byte(out.String()), &decoded))
+	assert.Equal(t, formatResults[1].Stat, brc.Stat(decoded[formatResults[1].Station]))
+
+	out.Reset()
+	require.NoError(t, writeResults(formatResults, formatJSONL, &out))
+	assert.Equal(
+		t,
+		`{"station":"Abha","min":-23,"mean":18,"max":59.2,"count":3}`+"\n"+
+			`{"station":"Washington, \"D.C.\"","min":-0.5,"mean":14.6,"max":33.3,"count":1}`+"\n",
+		out.String(),
+	)
+
+	out.Reset()
+	require.NoError(t, writeResults(formatResults, formatCSV, &out))
+	assert.Equal(
+		t,
+		"station,min,mean,max,count\n"+
+			"Abha,-23.0,18.0,59.2,3\n"+
+			`"Washington, ""D.C.""",-0.5,14.6,33.3,1`+"\n",
+		out.String(),
+	)
+	rows, err := csv.NewReader(strings.NewReader(out.String())).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, formatResults[1].Station, rows[2][0])
+
+	out.Reset()
+	require.NoError(t, writeResults(formatResults, formatBrc, &out))
+	assert.Equal(
+		t,
+		`{Abha=-23.0/18.0/59.2, Washington, "D.C."=-0.5/14.6/33.3}`+"\n",
+		out.String(),
+	)
+}
+
+func TestEvalFormats(t *testing.T) {
+	defer func(f string) { *outputFormat = f }(*outputFormat)
+	input := filepath.Join(sampleInputDir, "measurements-10000-unique-keys")
+	expected, err := readFile(input + sampleOutputExt)
+	require.NoError(t, err)
+	var want brc.Results
+	require.NoError(t, want.UnmarshalText([]byte(expected)))
+
+	// Every format holds the same results
+	*outputFormat = formatJSON
+	var out strings.Builder
+	require.NoError(t, eval(context.Background(), input+sampleInputExt, &out))
+	var decoded map[string]jsonStat
+	require.NoError(t, json.Unmarshal([]byte(out.String()), &decoded))
+	require.Len(t, decoded, len(want))
+	for _, r := range want {
+		s := decoded[r.Station]
+		assert.Equal(t, r.Stat, brc.Stat{Min: s.Min, Mean: s.Mean, Max: s.Max}, r.Station)
+	}
+
+	*outputFormat = formatJSONL
+	out.Reset()
+	require.NoError(t, eval(context.Background(), input+sampleInputExt, &out))
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	require.Len(t, lines, len(want))
+	for i, r := range want {
+		var line struct {
+			Station string `json:"station"`
+			jsonStat
+		}
+		require.NoError(t, json.Unmarshal([]byte(lines[i]), &line))
+		assert.Equal(t, r.Station, line.Station)
+		assert.Equal(t, r.Stat, brc.Stat{Min: line.Min, Mean: line.Mean, Max: line.Max}, r.Station)
+	}
+
+	*outputFormat = formatCSV
+	out.Reset()
+	require.NoError(t, eval(context.Background(), input+sampleInputExt, &out))
+	rows, err := csv.NewReader(strings.NewReader(out.String())).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, len(want)+1)
+	for i, r := range want {
+		text, _ := r.Stat.MarshalText()
+		assert.Equal(t, string(text), strings.Join(rows[i+1][1:4], "/"), r.Station)
+		assert.Equal(t, r.Station, rows[i+1][0])
+	}
+}
+
+// failingWriter fails every write
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestEvalWriteError(t *testing.T) {
+	defer func(f string) { *outputFormat = f }(*outputFormat)
+	input := filepath.Join(sampleInputDir, "measurements-3.txt")
+	for _, f := range formats {
+		*outputFormat = f
+		err := eval(context.Background(), input, failingWriter{})
+		assert.ErrorContains(t, err, "disk full", f)
+	}
+}
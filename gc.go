@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// gcUsage is the garbage collection work done during a run
+type gcUsage struct {
+	Cycles    uint32  `json:"cycles"`
+	PauseSecs float64 `json:"pause_seconds"`
+	Disabled  bool    `json:"disabled"`
+	FinalSecs float64 `json:"final_collection_seconds,omitempty"`
+}
+
+// gcTracker measures garbage collection over a run, optionally with the
+// collector disabled until a single forced collection at the end
+type gcTracker struct {
+	start    runtime.MemStats
+	disabled bool
+	prev     int
+}
+
+// startGCTracker starts measuring garbage collection, disabling the collector
+// if asked to
+func startGCTracker(disable bool) *gcTracker {
+	t := &gcTracker{disabled: disable}
+	if disable {
+		t.prev = debug.SetGCPercent(-1)
+	}
+	runtime.ReadMemStats(&t.start)
+	return t
+}
+
+// stop ends the measurement, re-enabling and forcing a collection if it was
+// disabled, and returns the garbage collection work done since the start
+func (t *gcTracker) stop() gcUsage {
+	u := gcUsage{Disabled: t.disabled}
+	if t.disabled {
+		start := time.Now()
+		debug.SetGCPercent(t.prev)
+		runtime.GC()
+		u.FinalSecs = time.Since(start).Seconds()
+	}
+	var end runtime.MemStats
+	runtime.ReadMemStats(&end)
+	u.Cycles = end.NumGC - t.start.NumGC
+	u.PauseSecs = time.Duration(end.PauseTotalNs - t.start.PauseTotalNs).Seconds()
+	return u
+}
+
+// write prints the garbage collection work in a human readable form
+func (u gcUsage) write(w io.Writer) {
+	fmt.Fprintf(w, "gc: %d cycles, %.3f s paused", u.Cycles, u.PauseSecs)
+	if u.Disabled {
+		fmt.Fprintf(w, ", disabled, final collection %.3f s", u.FinalSecs)
+	}
+	fmt.Fprintln(w)
+}
@@ -1,8 +1,11 @@
 module github.com/aeolyus/1brc
 
-go 1.22.0
+go 1.23.0
 
-require github.com/stretchr/testify v1.8.4
+require (
+	github.com/klauspost/compress v1.17.11
+	github.com/stretchr/testify v1.8.4
+)
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// sizeChanged returns an error if the size of an input observed while
+// processing it no longer matches the size it had when it was opened
+func sizeChanged(size, observed int64) error {
+	switch {
+	case observed < size:
+		return fmt.Errorf(
+			"input was truncated during processing from %d to %d bytes",
+			size, observed,
+		)
+	case observed > size:
+		return fmt.Errorf(
+			"input grew during processing from %d to %d bytes; "+
+				"use -tolerate-growth to process only the first %d",
+			size, observed, size,
+		)
+	}
+	return nil
+}
+
+// checkInputSize compares the current size of an input with the size that
+// was mapped. Growth only reads past what was mapped when it is not tolerated.
+func checkInputSize(fpath string, mapped int64) error {
+	info, err := os.Stat(fpath)
+	if err != nil {
+		return fmt.Errorf("could not stat file: %w", err)
+	}
+	size := info.Size()
+	if size > mapped && *tolerateGrowth {
+		return nil
+	}
+	return sizeChanged(mapped, size)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readChanging runs the reader over a file, calling change once the first
+// chunk has been read, and returns everything read along with the error
+func readChanging(t *testing.T, change func(path string)) (string, error) {
+	defer func(n int) { chunkSize = n }(chunkSize)
+	chunkSize = 16
+	path := filepath.Join(t.TempDir(), "input.txt")
+	input := strings.Repeat("Hamburg;12.0\n", 8)
+	require.NoError(t, os.WriteFile(path, []byte(input), 0o644))
+
+	chunkChan := make(chan []byte)
+	errChan := make(chan error, 1)
+	go func() { errChan <- reader(context.Background(), path, chunkChan, &chunkCounts{}) }()
+	var read strings.Builder
+	for chunk := range chunkChan {
+		if read.Len() == 0 {
+			change(path)
+		}
+		read.Write(chunk)
+	}
+	return read.String(), <-errChan
+}
+
+func appendLines(t *testing.T) func(string) {
+	return func(path string) {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+		require.NoError(t, err)
+		defer f.Close()
+		_, err = f.WriteString(strings.Repeat("Bulawayo;8.9\n", 8))
+		require.NoError(t, err)
+	}
+}
+
+func TestReaderGrowth(t *testing.T) {
+	_, err := readChanging(t, appendLines(t))
+	assert.ErrorContains(t, err, "input grew during processing")
+}
+
+func TestReaderTolerateGrowth(t *testing.T) {
+	defer func(b bool) { *tolerateGrowth = b }(*tolerateGrowth)
+	*tolerateGrowth = true
+	read, err := readChanging(t, appendLines(t))
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("Hamburg;12.0\n", 8), read)
+}
+
+func TestReaderTruncated(t *testing.T) {
+	_, err := readChanging(t, func(path string) {
+		require.NoError(t, os.Truncate(path, 20))
+	})
+	assert.ErrorContains(t, err, "input was truncated")
+}
+
+func TestWorkerTruncatedMapping(t *testing.T) {
+	if !mmapSupported {
+		t.Skip("mmap is not supported")
+	}
+	path := filepath.Join(t.TempDir(), "input.txt")
+	input := strings.Repeat("Hamburg;12.0\n", 1<<12)
+	require.NoError(t, os.WriteFile(path, []byte(input), 0o644))
+	data, err := mapInput(path)
+	require.NoError(t, err)
+	defer munmap(data)
+	require.NoError(t, os.Truncate(path, 0))
+
+	chunkChan := make(chan []byte, 1)
+	chunkChan <- data
+	close(chunkChan)
+	err = worker(
+		context.Background(), chunkChan, nil, 0, nil, nil, &chunkCounts{},
+		nil,
+	)
+	assert.ErrorContains(t, err, "input was truncated")
+	assert.ErrorContains(t,
+		checkInputSize(path, int64(len(data))), "input was truncated")
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/maphash"
+	"io"
+	"math"
+	"math/bits"
+	"sync"
+
+	"github.com/aeolyus/1brc/brc/fastparse"
+	"github.com/aeolyus/1brc/internal/pipeline"
+)
+
+// hllPrecision is the number of hash bits selecting a register of a
+// HyperLogLog sketch, giving 2^14 registers and a standard error of about
+// 0.8%
+const hllPrecision = 14
+
+// hll is a HyperLogLog sketch estimating the number of distinct stations
+// added to it in a fixed 16 KiB, however many there are
+type hll struct {
+	seed      maphash.Seed
+	registers [1 << hllPrecision]uint8
+}
+
+// newHLL returns an empty sketch. Sketches can only be merged if they hash
+// with the same seed.
+func newHLL(seed maphash.Seed) *hll {
+	return &hll{seed: seed}
+}
+
+// add adds a station to the sketch
+func (h *hll) add(station []byte) {
+	x := maphash.Bytes(h.seed, station)
+	i := x >> (64 - hllPrecision)
+	// The rank is the position of the first set bit after the register
+	// bits, with a sentinel so it is at most 64-hllPrecision+1
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1))) + 1
+	h.registers[i] = max(h.registers[i], rank)
+}
+
+// merge adds the stations of another sketch to this one
+func (h *hll) merge(other *hll) {
+	for i, r := range other.registers {
+		h.registers[i] = max(h.registers[i], r)
+	}
+}
+
+// estimate returns the estimated number of distinct stations added, counting
+// empty registers instead where that is more accurate for few stations
+func (h *hll) estimate() uint64 {
+	m := float64(len(h.registers))
+	sum, zeros := 0.0, 0
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	e := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if e <= 2.5*m && zeros > 0 {
+		e = m * math.Log(m/float64(zeros))
+	}
+	return uint64(math.Round(e))
+}
+
+// writeCardinality estimates the number of distinct stations across the input
+// files and writes it, without aggregating their statistics
+func writeCardinality(ctx context.Context, fpaths []string, w io.Writer) error {
+	files, err := statInputs(fpaths)
+	if err != nil {
+		return err
+	}
+	if report != nil {
+		report.Strategy = strategyStream
+	}
+	workers := *jobs
+	if workers <= 0 {
+		workers = defaultJobs(cgroupLimits())
+	}
+	counts := &chunkCounts{}
+	seed := maphash.MakeSeed()
+	total := newHLL(seed)
+	var mu sync.Mutex
+	err = pipeline.Run(ctx, prefetchDepth, workers,
+		func(ctx context.Context, chunkChan chan<- []byte) error {
+			return scheduleFiles(ctx, files, chunkChan, counts)
+		},
+		func(ctx context.Context, chunkChan <-chan []byte) error {
+			sketch := newHLL(seed)
+			for chunk := range chunkChan {
+				counts.received.Add(int64(len(chunk)))
+				for len(chunk) > 0 {
+					station, _, rest := fastparse.ScanLine(chunk)
+					chunk = rest
+					if station != nil {
+						sketch.add(station)
+					}
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			total.merge(sketch)
+			return nil
+		},
+	)
+	if err == nil {
+		err = counts.check()
+	}
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, total.estimate())
+	return err
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"hash/maphash"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHLLEstimate(t *testing.T) {
+	seed := maphash.MakeSeed()
+	for _, n := range []int{0, 1, 100, 10_000, 1_000_000} {
+		t.Run(strconv.Itoa(n), func(t *testing.T) {
+			// Split the stations over two sketches, each seeing some
+			// of the other's again
+			a, b := newHLL(seed), newHLL(seed)
+			for i := 0; i < n; i++ {
+				station := []byte("station-" + strconv.Itoa(i))
+				if i%2 == 0 {
+					a.add(station)
+				} else {
+					b.add(station)
+				}
+				if i%3 == 0 {
+					b.add(station)
+				}
+			}
+			a.merge(b)
+			assert.InDelta(t, n, a.estimate(), 0.03*float64(n)+1)
+		})
+	}
+}
+
+func TestWriteCardinality(t *testing.T) {
+	input := filepath.Join(sampleInputDir, "measurements-10000-unique-keys")
+	var out strings.Builder
+	require.NoError(t, writeCardinality(
+		context.Background(), []string{input + sampleInputExt}, &out,
+	))
+	n, err := strconv.Atoi(strings.TrimSpace(out.String()))
+	require.NoError(t, err)
+	assert.InDelta(t, 10_000, n, 300)
+}
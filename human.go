@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// numberFormat is how numbers are written in human-facing output such as the
+// query table. The spec format and machine-readable formats always use the
+// plain form.
+type numberFormat struct {
+	decimalComma bool
+	thousandsSep string
+	siCounts     bool
+}
+
+// humanNumbers returns the number format given by the flags
+func humanNumbers() numberFormat {
+	return numberFormat{
+		decimalComma: *outDecimalComma,
+		thousandsSep: *thousandsSep,
+		siCounts:     *siCounts,
+	}
+}
+
+// siPrefixes are the prefixes of abbreviated counts, by power of a thousand
+var siPrefixes = []string{"", "k", "M", "G", "T", "P", "E"}
+
+// count writes a count, abbreviated to SI units such as 10.2M if asked to
+func (f numberFormat) count(v float64) string {
+	if !f.siCounts || v < 1000 {
+		return f.format(v, 0)
+	}
+	i := 0
+	for v >= 999.95 && i < len(siPrefixes)-1 {
+		v /= 1000
+		i++
+	}
+	return f.format(v, 1) + siPrefixes[i]
+}
+
+// format writes a number with the given number of decimals
+func (f numberFormat) format(v float64, decimals int) string {
+	s := strconv.FormatFloat(v, 'f', decimals, 64)
+	if f.thousandsSep == "" && !f.decimalComma {
+		return s
+	}
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	if f.thousandsSep != "" && len(whole) > 3 {
+		var b strings.Builder
+		for i, d := range whole {
+			if i > 0 && (len(whole)-i)%3 == 0 {
+				b.WriteString(f.thousandsSep)
+			}
+			b.WriteRune(d)
+		}
+		whole = b.String()
+	}
+	if !hasFrac {
+		return sign + whole
+	}
+	point := "."
+	if f.decimalComma {
+		point = ","
+	}
+	return sign + whole + point + frac
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNumberFormat(t *testing.T) {
+	tests := []struct {
+		f        numberFormat
+		v        float64
+		decimals int
+		expected string
+	}{
+		{numberFormat{}, 1234567.25, 1, "1234567.2"},
+		{numberFormat{thousandsSep: ","}, 1234567, 0, "1,234,567"},
+		{numberFormat{thousandsSep: ","}, -123, 0, "-123"},
+		{numberFormat{thousandsSep: " "}, -1234.5, 1, "-1 234.5"},
+		{numberFormat{decimalComma: true}, -12.5, 1, "-12,5"},
+		{numberFormat{decimalComma: true, thousandsSep: "."}, 123456.7, 1, "123.456,7"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, tt.f.format(tt.v, tt.decimals))
+	}
+}
+
+func TestNumberFormatCount(t *testing.T) {
+	si := numberFormat{siCounts: true}
+	for v, expected := range map[float64]string{
+		999:           "999",
+		1000:          "1.0k",
+		10_200_000:    "10.2M",
+		999_960:       "1.0M",
+		1_000_000_000: "1.0G",
+	} {
+		assert.Equal(t, expected, si.count(v))
+	}
+	assert.Equal(t, "10200000", numberFormat{}.count(10_200_000))
+	comma := numberFormat{siCounts: true, decimalComma: true}
+	assert.Equal(t, "10,2M", comma.count(10_200_000))
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+	"unicode/utf8"
+)
+
+// initialBucket aggregates the stations starting with the same letter
+type initialBucket struct {
+	initial  string
+	stations int
+	// Only the count and sum of the stat are kept
+	stat stat
+}
+
+// writeInitials writes the number of stations and measurements and the mean
+// temperature of the stations starting with each letter, ignoring case, as an
+// aligned table. Datasets made by the official generator pick stations
+// uniformly, so each initial should hold about its share of the stations of
+// the measurements too.
+func writeInitials(ss *stationStats, w io.Writer) error {
+	buckets := map[string]*initialBucket{}
+	var total int64
+	for station, v := range ss.stats {
+		r, _ := utf8.DecodeRuneInString(station)
+		initial := string(unicode.ToUpper(r))
+		if station == "" {
+			initial = ""
+		}
+		b := buckets[initial]
+		if b == nil {
+			b = &initialBucket{initial: initial}
+			buckets[initial] = b
+		}
+		b.stat.Count += v.Count
+		b.stat.Sum += v.Sum
+		b.stations++
+		total += v.Count
+	}
+	sorted := make([]*initialBucket, 0, len(buckets))
+	for _, b := range buckets {
+		sorted = append(sorted, b)
+	}
+	slices.SortFunc(sorted, func(a, b *initialBucket) int {
+		return compareStations(a.initial, b.initial)
+	})
+
+	nf := humanNumbers()
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.ToUpper(strings.Join([]string{
+		"initial", "stations", "station share", colCount, "count share",
+		colMean,
+	}, "\t")))
+	for _, b := range sorted {
+		fmt.Fprintf(tw, "%s\t%d\t%s%%\t%s\t%s%%\t%s\n",
+			b.initial, b.stations,
+			nf.format(100*float64(b.stations)/float64(len(ss.stats)), 1),
+			nf.count(float64(b.stat.Count)),
+			nf.format(100*float64(b.stat.Count)/float64(total), 1),
+			nf.format(compatMean(&b.stat), 1),
+		)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteInitials(t *testing.T) {
+	ss := &stationStats{stats: map[string]*stat{
+		"Abha":   {Min: 100, Max: 300, Count: 2, Sum: 400},
+		"aden":   {Min: 0, Max: 0, Count: 1, Sum: 1},
+		"Bergen": {Min: -50, Max: 50, Count: 1, Sum: -50},
+		"Åre":    {Min: -10, Max: -10, Count: 4, Sum: -40},
+	}}
+	var out strings.Builder
+	require.NoError(t, writeInitials(ss, &out))
+	assert.Equal(t, ""+
+		"INITIAL  STATIONS  STATION SHARE  COUNT  COUNT SHARE  MEAN\n"+
+		"A        2         50.0%          3      37.5%        13.4\n"+
+		"B        1         25.0%          1      12.5%        -5.0\n"+
+		"Å        1         25.0%          4      50.0%        -1.0\n",
+		out.String(),
+	)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// listedInput is an entry of an -input-list: a file with optionally the size
+// and SHA-256 digest it is expected to have
+type listedInput struct {
+	path   string
+	size   int64 // -1 if not given
+	sha256 string
+}
+
+// loadInputList reads the input files listed in the file at path and checks
+// them against their expected sizes and digests, returning their paths in the
+// order listed
+func loadInputList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open input list: %w", err)
+	}
+	defer f.Close()
+	entries, err := parseInputList(f, filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s: no inputs listed", path)
+	}
+	if err := verifyInputs(entries); err != nil {
+		return nil, err
+	}
+	paths := make([]string, len(entries))
+	for i, e := range entries {
+		paths[i] = e.path
+	}
+	return paths, nil
+}
+
+// parseInputList parses an input list: one file per line, followed by its
+// size in bytes and its SHA-256 digest in hex if they are to be checked, with
+// '-' for a size not given. Blank lines and lines starting with '#' are
+// ignored, and relative paths are relative to dir.
+func parseInputList(r io.Reader, dir string) ([]listedInput, error) {
+	var entries []listedInput
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) > 3 {
+			return nil, fmt.Errorf("line %d: too many fields", n)
+		}
+		e := listedInput{path: fields[0], size: -1}
+		if strings.Contains(e.path, "://") {
+			return nil, fmt.Errorf(
+				"line %d: remote input %s is not supported", n, e.path,
+			)
+		}
+		if !filepath.IsAbs(e.path) {
+			e.path = filepath.Join(dir, e.path)
+		}
+		if len(fields) > 1 && fields[1] != "-" {
+			size, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil || size < 0 {
+				return nil, fmt.Errorf("line %d: invalid size %q", n, fields[1])
+			}
+			e.size = size
+		}
+		if len(fields) > 2 {
+			digest, err := hex.DecodeString(fields[2])
+			if err != nil || len(digest) != sha256.Size {
+				return nil, fmt.Errorf(
+					"line %d: invalid SHA-256 digest %q", n, fields[2],
+				)
+			}
+			e.sha256 = strings.ToLower(fields[2])
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read input list: %w", err)
+	}
+	return entries, nil
+}
+
+// verifyInputs checks that every listed input exists with the size and digest
+// expected, returning every mismatch found rather than only the first
+func verifyInputs(entries []listedInput) error {
+	var errs []error
+	var buf []byte
+	for _, e := range entries {
+		info, err := os.Stat(e.path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not stat file: %w", err))
+			continue
+		}
+		if e.size >= 0 && info.Size() != e.size {
+			errs = append(errs, fmt.Errorf(
+				"%s is %d bytes, expected %d", e.path, info.Size(), e.size,
+			))
+			continue
+		}
+		if e.sha256 == "" {
+			continue
+		}
+		if buf == nil {
+			buf = make([]byte, chunkSize)
+		}
+		h := sha256.New()
+		if _, err := digestFile(h, e.path, buf); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if digest := hex.EncodeToString(h.Sum(nil)); digest != e.sha256 {
+			errs = append(errs, fmt.Errorf(
+				"%s has SHA-256 %s, expected %s", e.path, digest, e.sha256,
+			))
+		}
+	}
+	return errors.Join(errs...)
+}
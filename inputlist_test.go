@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseInputList(t *testing.T) {
+	digest := strings.Repeat("ab", sha256.Size)
+	entries, err := parseInputList(strings.NewReader(strings.Join([]string{
+		"# shards of 2024-06-01",
+		"a.txt",
+		"",
+		"/data/b.txt 1024",
+		"c.txt - " + strings.ToUpper(digest),
+	}, "\n")), "/lists")
+	require.NoError(t, err)
+	assert.Equal(t, []listedInput{
+		{path: "/lists/a.txt", size: -1},
+		{path: "/data/b.txt", size: 1024},
+		{path: "/lists/c.txt", size: -1, sha256: digest},
+	}, entries)
+
+	for list, msg := range map[string]string{
+		"a.txt 1 " + digest + " x": "line 1: too many fields",
+		"\na.txt -1":               `line 2: invalid size "-1"`,
+		"a.txt 1 abc":              `line 1: invalid SHA-256 digest "abc"`,
+		"s3://bucket/a.txt":        "line 1: remote input s3://bucket/a.txt",
+	} {
+		_, err := parseInputList(strings.NewReader(list), "")
+		assert.ErrorContains(t, err, msg)
+	}
+}
+
+func TestLoadInputList(t *testing.T) {
+	dir := t.TempDir()
+	data := []byte("Hamburg;12.0\n")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), data, 0o644))
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+	list := filepath.Join(dir, "inputs.txt")
+	write := func(lines ...string) {
+		content := strings.Join(lines, "\n")
+		require.NoError(t, os.WriteFile(list, []byte(content), 0o644))
+	}
+
+	write(fmt.Sprintf("a.txt %d %s", len(data), digest))
+	paths, err := loadInputList(list)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "a.txt")}, paths)
+
+	// Every mismatch is reported
+	write(
+		"a.txt 99",
+		"a.txt - "+strings.Repeat("00", sha256.Size),
+		"missing.txt",
+	)
+	_, err = loadInputList(list)
+	assert.ErrorContains(t, err, "a.txt is 13 bytes, expected 99")
+	assert.ErrorContains(t, err, "a.txt has SHA-256 "+digest)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	write("# nothing yet")
+	_, err = loadInputList(list)
+	assert.ErrorContains(t, err, "no inputs listed")
+}
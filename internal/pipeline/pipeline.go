@@ -0,0 +1,90 @@
+// Package pipeline runs a producer feeding a pool of workers over a channel,
+// cancelling all of them on the first error any of them runs into.
+package pipeline
+
+import (
+	"context"
+	"sync"
+)
+
+// FirstError records the first error of a group of goroutines and cancels
+// the rest of them
+type FirstError struct {
+	mu     sync.Mutex
+	err    error
+	cancel context.CancelFunc
+}
+
+// NewFirstError returns a FirstError cancelling the group with cancel
+func NewFirstError(cancel context.CancelFunc) *FirstError {
+	return &FirstError{cancel: cancel}
+}
+
+// Set records err if it is the first error, cancelling the group. A nil err
+// is ignored, so results can be passed in unchecked.
+func (e *FirstError) Set(err error) {
+	if err == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.err == nil {
+		e.err = err
+		e.cancel()
+	}
+}
+
+// Err returns the first error recorded, or nil if there was none
+func (e *FirstError) Err() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.err
+}
+
+// Producer feeds items to a channel until it is done or its context is
+// cancelled, and then closes the channel, whether or not it failed
+type Producer[T any] func(ctx context.Context, out chan<- T) error
+
+// Worker consumes items from a channel until it is closed
+type Worker[T any] func(ctx context.Context, in <-chan T) error
+
+// Run runs a producer feeding a channel with room for depth items to the
+// given number of workers, and waits for all of them. The first error of any
+// of them cancels the context of the rest and is returned, or else the error
+// of ctx if it was cancelled. Once cancelled, the producer must stop sending,
+// and workers should keep draining the channel so that it is not left
+// blocked.
+func Run[T any](
+	ctx context.Context,
+	depth int,
+	workers int,
+	produce Producer[T],
+	work Worker[T],
+) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := NewFirstError(cancel)
+	ch := make(chan T, depth)
+
+	// The workers may be done as soon as the channel is closed, before the
+	// producer has returned its error, so it is waited for separately
+	produced := make(chan struct{})
+	go func() {
+		defer close(produced)
+		errs.Set(produce(ctx, ch))
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < max(workers, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs.Set(work(ctx, ch))
+		}()
+	}
+	wg.Wait()
+	<-produced
+	if err := errs.Err(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
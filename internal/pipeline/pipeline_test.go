@@ -0,0 +1,94 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// count produces the numbers up to n, failing with err after them if given
+func count(n int, err error) Producer[int] {
+	return func(ctx context.Context, out chan<- int) error {
+		defer close(out)
+		for i := 1; i <= n; i++ {
+			select {
+			case out <- i:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return err
+	}
+}
+
+// sum adds up the numbers it consumes into total
+func sum(total *atomic.Int64) Worker[int] {
+	return func(ctx context.Context, in <-chan int) error {
+		for i := range in {
+			total.Add(int64(i))
+		}
+		return nil
+	}
+}
+
+func TestRun(t *testing.T) {
+	for _, workers := range []int{0, 1, 8} {
+		var total atomic.Int64
+		err := Run(
+			context.Background(), 2, workers, count(1000, nil), sum(&total),
+		)
+		assert.NoError(t, err)
+		assert.EqualValues(t, 1000*1001/2, total.Load(), workers)
+	}
+}
+
+func TestRunProducerError(t *testing.T) {
+	errRead := errors.New("read failed")
+	var total atomic.Int64
+	err := Run(context.Background(), 0, 4, count(10, errRead), sum(&total))
+	assert.ErrorIs(t, err, errRead)
+}
+
+func TestRunWorkerError(t *testing.T) {
+	// The first worker error cancels the producer, whose own error of
+	// being cancelled comes second
+	errParse := errors.New("parse failed")
+	var seen atomic.Int64
+	err := Run(context.Background(), 0, 4, count(1_000_000, nil),
+		func(ctx context.Context, in <-chan int) error {
+			for range in {
+				if seen.Add(1) == 10 {
+					return errParse
+				}
+			}
+			return nil
+		},
+	)
+	assert.ErrorIs(t, err, errParse)
+	assert.Less(t, seen.Load(), int64(1_000_000))
+}
+
+func TestRunCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var total atomic.Int64
+	err := Run(ctx, 0, 2, count(1000, nil), sum(&total))
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestFirstError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := NewFirstError(cancel)
+	errs.Set(nil)
+	assert.NoError(t, errs.Err())
+	assert.NoError(t, ctx.Err())
+
+	first, second := errors.New("first"), errors.New("second")
+	errs.Set(first)
+	errs.Set(second)
+	assert.Equal(t, first, errs.Err())
+	assert.Error(t, ctx.Err())
+}
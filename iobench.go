@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// touchSink keeps the page touching loop from being optimized away
+var touchSink byte
+
+// benchStage is the measured throughput of a single stage of the pipeline
+type benchStage struct {
+	name    string
+	bytes   int64
+	elapsed time.Duration
+	err     error
+}
+
+func (s benchStage) mibPerSec() float64 {
+	return float64(s.bytes) / s.elapsed.Seconds() / (1024 * 1024)
+}
+
+// iobench measures how fast the input can be read, mapped and parsed on the
+// current machine, to show which stage bounds the overall throughput
+func iobench(args []string) error {
+	fs := flag.NewFlagSet("iobench", flag.ExitOnError)
+	input := fs.String("input", "", "input file path")
+	registerAliases(fs, map[string]string{"i": "input"})
+	fs.Parse(args)
+	if *input == "" {
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+
+	stages := []benchStage{
+		timeStage("read", *input, benchRead),
+		timeStage("mmap", *input, benchMmap),
+		timeStage("parse", *input, benchParse),
+	}
+
+	var slowest *benchStage
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "STAGE\tBYTES\tSECONDS\tMiB/s\t")
+	for i, s := range stages {
+		if s.err != nil {
+			fmt.Fprintf(w, "%s\t-\t-\t-\t(%v)\n", s.name, s.err)
+			continue
+		}
+		fmt.Fprintf(
+			w, "%s\t%d\t%.3f\t%.1f\t\n",
+			s.name, s.bytes, s.elapsed.Seconds(), s.mibPerSec(),
+		)
+		if slowest == nil || s.elapsed > slowest.elapsed {
+			slowest = &stages[i]
+		}
+	}
+	w.Flush()
+	if slowest != nil {
+		fmt.Printf("bottleneck: %s\n", slowest.name)
+	}
+	return nil
+}
+
+// timeStage runs a single benchmark stage and records how long it took
+func timeStage(
+	name string,
+	fpath string,
+	stage func(fpath string) (int64, error),
+) benchStage {
+	start := time.Now()
+	n, err := stage(fpath)
+	return benchStage{name, n, time.Since(start), err}
+}
+
+// benchRead reads the file sequentially, discarding the data
+func benchRead(fpath string) (int64, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return 0, fmt.Errorf("could not open file: %w", err)
+	}
+	defer f.Close()
+	return io.CopyBuffer(io.Discard, f, make([]byte, chunkSize))
+}
+
+// benchMmap maps the file and touches every page of it
+func benchMmap(fpath string) (int64, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return 0, fmt.Errorf("could not open file: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("could not stat file: %w", err)
+	}
+	data, err := mmapFile(f, info.Size())
+	if err != nil {
+		return 0, fmt.Errorf("could not map file: %w", err)
+	}
+	defer munmap(data)
+	var sum byte
+	for i := 0; i < len(data); i += os.Getpagesize() {
+		sum += data[i]
+	}
+	touchSink = sum
+	return int64(len(data)), nil
+}
+
+// benchParse runs the full parsing pipeline and discards the results
+func benchParse(fpath string) (int64, error) {
+	info, err := os.Stat(fpath)
+	if err != nil {
+		return 0, fmt.Errorf("could not stat file: %w", err)
+	}
+	if _, err := readStats(context.Background(), fpath, nil); err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
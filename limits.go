@@ -0,0 +1,204 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Bounds of the chunk size derived from a memory limit
+const (
+	minChunkSize = 1024 * 1024 // 1 MiB
+	chunkAlign   = 4 * 1024    // 4 KiB
+)
+
+// Chunking on network filesystems, where every read is a round trip to the
+// server: fewer, larger reads with more of them in flight keep the link busy
+// instead of waiting on each request in turn
+const (
+	remoteChunkSize = 256 * 1024 * 1024 // 256 MiB
+	remotePrefetch  = 4
+)
+
+// unlimitedMemory is the threshold above which a cgroup v1 memory limit is
+// treated as no limit at all
+const unlimitedMemory = 1 << 60
+
+// cgroupRoot is where the cgroup filesystem is mounted, and procCgroup lists
+// the cgroup of the process in each hierarchy
+var (
+	cgroupRoot = "/sys/fs/cgroup"
+	procCgroup = "/proc/self/cgroup"
+)
+
+// resourceLimits are the CPU and memory available to the process, with zero
+// meaning unlimited
+type resourceLimits struct {
+	CPUs   float64 `json:"cpus,omitempty"`
+	Memory int64   `json:"memory_bytes,omitempty"`
+}
+
+// cgroupLimits reads the CPU quota and memory limit of the process's cgroup,
+// trying cgroup v2 before v1. Limits of its ancestors bound it too, so the
+// tightest one along the way up to the root of the mount wins.
+func cgroupLimits() resourceLimits {
+	paths := readProcCgroup()
+	var l resourceLimits
+	for _, dir := range cgroupDirs(cgroupRoot, paths[""]) {
+		if quota, period, ok := readCgroupV2CPU(dir); ok {
+			l.CPUs = tighter(l.CPUs, quota/period)
+		}
+		if limit, ok := readCgroupInt(dir + "/memory.max"); ok {
+			l.Memory = tighter(l.Memory, limit)
+		}
+	}
+	if l.CPUs == 0 {
+		for _, dir := range cgroupDirs(cgroupRoot+"/cpu", paths["cpu"]) {
+			quota, ok := readCgroupInt(dir + "/cpu.cfs_quota_us")
+			if !ok || quota <= 0 {
+				continue
+			}
+			if period, ok := readCgroupInt(dir + "/cpu.cfs_period_us"); ok && period > 0 {
+				l.CPUs = tighter(l.CPUs, float64(quota)/float64(period))
+			}
+		}
+	}
+	if l.Memory == 0 {
+		for _, dir := range cgroupDirs(cgroupRoot+"/memory", paths["memory"]) {
+			limit, ok := readCgroupInt(dir + "/memory.limit_in_bytes")
+			if ok && limit < unlimitedMemory {
+				l.Memory = tighter(l.Memory, limit)
+			}
+		}
+	}
+	return l
+}
+
+// tighter returns the lower of two limits, where zero is no limit
+func tighter[T int64 | float64](a, b T) T {
+	if a == 0 {
+		return b
+	}
+	return min(a, b)
+}
+
+// readProcCgroup returns the cgroup path of the process by controller, with
+// the unified cgroup v2 hierarchy under the empty name. Lines are
+// "<id>:<controllers>:<path>", with the controllers comma separated.
+func readProcCgroup() map[string]string {
+	paths := make(map[string]string)
+	b, err := os.ReadFile(procCgroup)
+	if err != nil {
+		return paths
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		for _, controller := range strings.Split(fields[1], ",") {
+			paths[controller] = fields[2]
+		}
+	}
+	return paths
+}
+
+// cgroupDirs returns the directory of a cgroup under a mount and those of its
+// ancestors up to the mount. Without a cgroup namespace of its own, a
+// container sees its cgroup mounted at the root while the path names it as on
+// the host, so a path missing from the mount falls back to the mount alone.
+func cgroupDirs(mount, path string) []string {
+	dir := filepath.Join(mount, path)
+	if _, err := os.Stat(dir); err != nil {
+		return []string{mount}
+	}
+	dirs := []string{dir}
+	for dir != mount && len(dir) > len(mount) {
+		dir = filepath.Dir(dir)
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+// readCgroupV2CPU parses the cpu.max of a cgroup directory, which holds
+// "<quota|max> <period>"
+func readCgroupV2CPU(dir string) (quota, period float64, ok bool) {
+	b, err := os.ReadFile(dir + "/cpu.max")
+	if err != nil {
+		return 0, 0, false
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) != 2 || fields[0] == "max" {
+		return 0, 0, false
+	}
+	quota, err = strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	period, err = strconv.ParseFloat(fields[1], 64)
+	if err != nil || period <= 0 {
+		return 0, 0, false
+	}
+	return quota, period, true
+}
+
+// readCgroupInt reads a cgroup file holding a single integer
+func readCgroupInt(fpath string) (int64, bool) {
+	b, err := os.ReadFile(fpath)
+	if err != nil {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// defaultJobs returns the number of workers to run, bounded by the CPU quota
+func defaultJobs(l resourceLimits) int {
+	n := runtime.NumCPU()
+	if l.CPUs > 0 {
+		n = min(n, int(math.Ceil(l.CPUs)))
+	}
+	return max(n, 1)
+}
+
+// defaultChunking returns the chunk size and prefetch depth to use for the
+// given number of workers, keeping the chunks in flight within a quarter of
+// the memory limit. Every worker holds a chunk plus a copy of it, and the
+// reader holds one more besides the prefetched ones.
+func defaultChunking(l resourceLimits, jobs int) (chunk int, prefetch int) {
+	chunk, prefetch = defaultChunkSize, 1
+	if l.Memory <= 0 {
+		return chunk, prefetch
+	}
+	budget := l.Memory / 4
+	if int64(chunk)*int64(2*jobs+prefetch+1) > budget {
+		prefetch = 0
+		chunk = int(budget / int64(2*jobs+1))
+		chunk = max(chunk/chunkAlign*chunkAlign, minChunkSize)
+	}
+	return min(chunk, defaultChunkSize), prefetch
+}
+
+// remoteChunking returns the chunk size and prefetch depth to use for the
+// given number of workers when the input is on a network filesystem. The
+// prefetch is cut first to stay within the memory budget, and the local
+// defaults are used if even that is not enough.
+func remoteChunking(l resourceLimits, jobs int) (chunk int, prefetch int) {
+	chunk, prefetch = remoteChunkSize, remotePrefetch
+	if l.Memory <= 0 {
+		return chunk, prefetch
+	}
+	budget := l.Memory / 4
+	for ; prefetch >= 0; prefetch-- {
+		if int64(chunk)*int64(2*jobs+prefetch+1) <= budget {
+			return chunk, prefetch
+		}
+	}
+	return defaultChunking(l, jobs)
+}
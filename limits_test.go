@@ -0,0 +1,146 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCgroupLimits(t *testing.T) {
+	defer func(root, proc string) {
+		cgroupRoot, procCgroup = root, proc
+	}(cgroupRoot, procCgroup)
+	tests := []struct {
+		name string
+		// cgroup is the process's /proc/self/cgroup
+		cgroup string
+		files  map[string]string
+		want   resourceLimits
+	}{
+		{"none", "", map[string]string{}, resourceLimits{}},
+		{
+			"v2",
+			"0::/\n",
+			map[string]string{
+				"cpu.max":    "200000 100000\n",
+				"memory.max": "1073741824\n",
+			},
+			resourceLimits{CPUs: 2, Memory: 1 << 30},
+		},
+		{
+			"v2 nested",
+			"0::/user.slice/app.scope\n",
+			map[string]string{
+				"cpu.max":                          "max 100000\n",
+				"memory.max":                       "max\n",
+				"user.slice/memory.max":            "1073741824\n",
+				"user.slice/cpu.max":               "400000 100000\n",
+				"user.slice/app.scope/memory.max":  "2147483648\n",
+				"user.slice/app.scope/cpu.max":     "150000 100000\n",
+				"other.slice/app.scope/memory.max": "1048576\n",
+			},
+			resourceLimits{CPUs: 1.5, Memory: 1 << 30},
+		},
+		{
+			// Without a cgroup namespace the path is that on the host, while
+			// the mount is the container's own cgroup
+			"v2 host path",
+			"0::/system.slice/docker-abc.scope\n",
+			map[string]string{
+				"cpu.max":    "200000 100000\n",
+				"memory.max": "1073741824\n",
+			},
+			resourceLimits{CPUs: 2, Memory: 1 << 30},
+		},
+		{
+			"v2 unlimited",
+			"0::/\n",
+			map[string]string{"cpu.max": "max 100000\n", "memory.max": "max\n"},
+			resourceLimits{},
+		},
+		{
+			"v1",
+			"",
+			map[string]string{
+				"cpu/cpu.cfs_quota_us":         "150000\n",
+				"cpu/cpu.cfs_period_us":        "100000\n",
+				"memory/memory.limit_in_bytes": "536870912\n",
+			},
+			resourceLimits{CPUs: 1.5, Memory: 1 << 29},
+		},
+		{
+			"v1 nested",
+			"5:memory:/batch/job\n4:cpu,cpuacct:/batch/job\n",
+			map[string]string{
+				"cpu/batch/cpu.cfs_quota_us":             "300000\n",
+				"cpu/batch/cpu.cfs_period_us":            "100000\n",
+				"cpu/batch/job/cpu.cfs_quota_us":         "-1\n",
+				"cpu/batch/job/cpu.cfs_period_us":        "100000\n",
+				"memory/batch/job/memory.limit_in_bytes": "536870912\n",
+			},
+			resourceLimits{CPUs: 3, Memory: 1 << 29},
+		},
+		{
+			"v1 unlimited",
+			"",
+			map[string]string{
+				"cpu/cpu.cfs_quota_us":         "-1\n",
+				"cpu/cpu.cfs_period_us":        "100000\n",
+				"memory/memory.limit_in_bytes": "9223372036854771712\n",
+			},
+			resourceLimits{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cgroupRoot = t.TempDir()
+			procCgroup = filepath.Join(t.TempDir(), "cgroup")
+			require.NoError(t, os.WriteFile(procCgroup, []byte(tt.cgroup), 0o644))
+			for name, content := range tt.files {
+				fpath := filepath.Join(cgroupRoot, name)
+				require.NoError(t, os.MkdirAll(filepath.Dir(fpath), 0o755))
+				require.NoError(t, os.WriteFile(fpath, []byte(content), 0o644))
+			}
+			assert.Equal(t, tt.want, cgroupLimits())
+		})
+	}
+}
+
+func TestDefaultChunking(t *testing.T) {
+	chunk, prefetch := defaultChunking(resourceLimits{}, 64)
+	assert.Equal(t, defaultChunkSize, chunk)
+	assert.Equal(t, 1, prefetch)
+
+	chunk, prefetch = defaultChunking(resourceLimits{Memory: 2 << 30}, 2)
+	assert.Equal(t, defaultChunkSize, chunk)
+	assert.Equal(t, 1, prefetch)
+
+	chunk, prefetch = defaultChunking(resourceLimits{Memory: 1 << 30}, 8)
+	assert.Equal(t, 0, prefetch)
+	assert.LessOrEqual(t, chunk*(2*8+1), 1<<28)
+	assert.Zero(t, chunk%chunkAlign)
+
+	chunk, _ = defaultChunking(resourceLimits{Memory: 1 << 20}, 8)
+	assert.Equal(t, minChunkSize, chunk)
+}
+
+func TestRemoteChunking(t *testing.T) {
+	chunk, prefetch := remoteChunking(resourceLimits{}, 64)
+	assert.Equal(t, remoteChunkSize, chunk)
+	assert.Equal(t, remotePrefetch, prefetch)
+
+	// A quarter of 20 GiB holds 20 chunks of 256 MiB, so 8 workers leave
+	// room to prefetch 3
+	chunk, prefetch = remoteChunking(resourceLimits{Memory: 20 << 30}, 8)
+	assert.Equal(t, remoteChunkSize, chunk)
+	assert.Equal(t, 3, prefetch)
+
+	limits := resourceLimits{Memory: 1 << 30}
+	chunk, prefetch = remoteChunking(limits, 8)
+	localChunk, localPrefetch := defaultChunking(limits, 8)
+	assert.Equal(t, localChunk, chunk)
+	assert.Equal(t, localPrefetch, prefetch)
+}
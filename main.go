@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
@@ -9,35 +10,89 @@ import (
 	"log"
 	"math"
 	"os"
-	"runtime"
+	"os/signal"
+	"runtime/debug"
 	"runtime/pprof"
-	"sort"
-	"sync"
+	"runtime/trace"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/aeolyus/1brc/brc"
+	"github.com/aeolyus/1brc/brc/fastparse"
+	"github.com/aeolyus/1brc/internal/pipeline"
 )
 
-const chunkSize = 64 * 1024 * 1024 // 64 MiB
+const defaultChunkSize = 64 * 1024 * 1024 // 64 MiB
 
-var input = flag.String("input", "", "input file path")
-var jobs = flag.Int("jobs", runtime.NumCPU(), "number of concurrent jobs")
-var cpuprofile = flag.String("cpuprofile", "", "write cpu profile to file")
+// chunkSize and prefetchDepth are resolved from flags and resource limits
+// before the run starts
+var (
+	chunkSize     = defaultChunkSize
+	prefetchDepth = 1
+)
 
-type stat struct {
-	min   float64
-	max   float64
-	count float64
-	sum   float64
-}
+// stat holds the running statistics of a station in tenths of a degree, as
+// parsed, so that summing billions of them accumulates no rounding error. They
+// only become degrees once formatted. It is the aggregate of the brc engine.
+type stat = brc.Tenths
 
 type stationStats struct {
-	stats    map[string]*stat
-	stations []string
+	stats map[string]*stat
+}
+
+// subcommands are alternative modes of the binary selected by the first
+// argument, each parsing its own flags
+var subcommands = map[string]func(args []string) error{
+	"annotate": annotate,
+	"iobench":  iobench,
+	"reshard":  reshard,
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			if err := cmd(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
 	flag.Parse()
-	if *input == "" {
-		flag.PrintDefaults()
-		os.Exit(1)
+	if err := applyEnv(flag.CommandLine, flagAliases); err != nil {
+		log.Fatal(err)
+	}
+	if *version {
+		readBuildInfo().write(os.Stdout)
+		return
+	}
+	inputs := inputPaths()
+	if len(inputs) == 0 && *inputList == "" {
+		if isTerminal(os.Stdin) {
+			missingInput(flag.CommandLine)
+			os.Exit(2)
+		}
+		// Input piped or redirected in is read without -input -
+		*input = stdinInput
+		inputs = inputPaths()
+	}
+	if err := validateFlags(); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid flags:\n%v\n", err)
+		os.Exit(2)
+	}
+	inputs, err := expandInputs(inputs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *inputList != "" {
+		listed, err := loadInputList(*inputList)
+		if err != nil {
+			log.Fatal(err)
+		}
+		inputs = append(inputs, listed...)
+	}
+	if atRestKey, err = loadAtRestKey(); err != nil {
+		log.Fatal(err)
 	}
 	if *cpuprofile != "" {
 		f, err := os.Create(*cpuprofile)
@@ -48,63 +103,498 @@ func main() {
 		if err := pprof.StartCPUProfile(f); err != nil {
 			log.Fatal("could not start CPU profile: ", err)
 		}
-		defer pprof.StopCPUProfile()
 	}
-	err := eval(*input, os.Stdout)
+	if *traceFile != "" {
+		f, err := os.Create(*traceFile)
+		if err != nil {
+			log.Fatal("could not create execution trace: ", err)
+		}
+		defer f.Close()
+		if err := trace.Start(f); err != nil {
+			log.Fatal("could not start execution trace: ", err)
+		}
+	}
+	var priority *backgroundPriority
+	if *background {
+		p, err := lowerPriority()
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("running in the background: %s", p)
+		priority = &p
+	}
+	limits := applyLimits(inputs[0])
+	// Randomized features all draw from the seed, so resolve it before the
+	// report records the flags of the run
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	if *reportPath != "" {
+		report = newRunReport(inputs)
+		report.Limits = limits
+		report.Priority = priority
+		report.ChunkSize = chunkSize
+		report.Prefetch = prefetchDepth
+	}
+	out := os.Stdout
+	if *output != "" && *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			log.Fatal("could not create output file: ", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	compressed, err := compressWriter(
+		out, outputCompression(*output, *outputCompressionFlag),
+	)
 	if err != nil {
-		log.Fatal(err)
+		log.Fatal("could not compress output: ", err)
+	}
+	// The first interrupt cancels the run, and a second one kills it right
+	// away as usual
+	ctx, stop := signal.NotifyContext(
+		context.Background(), os.Interrupt, syscall.SIGTERM,
+	)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	gc := startGCTracker(*noGC)
+	switch {
+	case *estimateCardinalityFlag:
+		err = writeCardinality(ctx, inputs, compressed)
+	case *soakRuns > 0:
+		err = soak(ctx, inputs, *soakRuns, compressed)
+	default:
+		err = evalFiles(ctx, inputs, compressed)
+	}
+	stopProfiling()
+	if err != nil {
+		code := exitCode(err)
+		switch code {
+		case exitTimeout:
+			log.Printf("processing exceeded -timeout of %s", *timeout)
+		case exitInterrupted:
+			log.Print("interrupted")
+		default:
+			log.Print(err)
+		}
+		os.Exit(code)
+	}
+	if err := compressed.Close(); err != nil {
+		log.Fatal("could not write output: ", err)
+	}
+	gcUsage := gc.stop()
+	if *gcStats {
+		gcUsage.write(os.Stderr)
+	}
+	if report != nil {
+		report.GC = gcUsage
+		if err := report.finish(); err != nil {
+			log.Fatal(err)
+		}
+		if err := report.write(*reportPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// Exit codes of runs that were cut short, following timeout(1) and shells
+const (
+	exitTimeout     = 124
+	exitInterrupted = 130
+)
+
+// exitCode returns the code to exit with after a run failed with err, so that
+// scripts can tell a -timeout or an interrupt apart from a failure
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return exitTimeout
+	case errors.Is(err, context.Canceled):
+		return exitInterrupted
+	default:
+		return 1
+	}
+}
+
+// applyLimits resolves -jobs, -chunk-size and -prefetch, deriving whichever
+// were not given from the CPU and memory limits of the process and from
+// whether the input is on a network filesystem
+func applyLimits(fpath string) resourceLimits {
+	limits := cgroupLimits()
+	if *jobs <= 0 {
+		*jobs = defaultJobs(limits)
+	}
+	if onRemoteFS(fpath) {
+		chunkSize, prefetchDepth = remoteChunking(limits, *jobs)
+	} else {
+		chunkSize, prefetchDepth = defaultChunking(limits, *jobs)
+	}
+	if *chunkSizeFlag > 0 {
+		chunkSize = *chunkSizeFlag
 	}
+	if *prefetch >= 0 {
+		prefetchDepth = *prefetch
+	}
+	return limits
 }
 
 // eval takes a file path, parses the stations statistics, and returns a
 // formatted string of the results
-func eval(fpath string, w io.Writer) error {
-	ss, err := readStats(fpath)
+func eval(ctx context.Context, fpath string, w io.Writer) error {
+	return evalFiles(ctx, []string{fpath}, w)
+}
+
+// evalFiles is eval over the statistics of several input files together
+func evalFiles(ctx context.Context, fpaths []string, w io.Writer) error {
+	var q *query
+	if *sqlQuery != "" {
+		var err error
+		if q, err = parseQuery(*sqlQuery); err != nil {
+			return err
+		}
+	}
+	for _, fpath := range fpaths {
+		// Compressed inputs are binary by nature
+		if dec, err := detectDecoder(fpath); err != nil {
+			return err
+		} else if dec != nil {
+			continue
+		}
+		if err := checkText(fpath); err != nil {
+			return err
+		}
+	}
+	if *spillDir != "" {
+		return evalSpilled(ctx, fpaths[0], *spillDir, *spillPartitions, w)
+	}
+	outputs, err := openSideOutputs(fpaths)
+	if err != nil {
+		return err
+	}
+	rs := &runState{outputs: outputs}
+	if *dedupeFlag {
+		rs.dedupe = newDeduper()
+	}
+	if report != nil {
+		rs.bad = newBadLines(*badLineExamples)
+	}
+	if *stageStats || report != nil {
+		rs.stages = &pipelineStages{capacity: prefetchDepth}
+	}
+	runCtx := ctx
+	if *memLimit > 0 {
+		var cancel context.CancelCauseFunc
+		runCtx, cancel = context.WithCancelCause(ctx)
+		defer cancel(nil)
+		rs.watchdog = startWatchdog(*memLimit, func() {
+			cancel(errMemoryLimit)
+		})
+	}
+	var ss *stationStats
+	var perFile []*stationStats
+	switch {
+	case *perFileFlag:
+		ss, perFile, err = readEachFile(runCtx, fpaths, rs)
+	case len(fpaths) == 1:
+		ss, err = readStats(runCtx, fpaths[0], rs)
+	default:
+		ss, err = readFiles(runCtx, fpaths, rs)
+	}
+	if rs.watchdog != nil {
+		rs.watchdog.close()
+		if cause := context.Cause(runCtx); errors.Is(cause, errMemoryLimit) {
+			err = cause
+		}
+	}
+	if rs.stages != nil {
+		usage := rs.stages.usage()
+		if report != nil {
+			report.Stages = &usage
+		}
+		if *stageStats {
+			usage.write(os.Stderr)
+		}
+	}
+	if rs.bad != nil {
+		report.MalformedLines = rs.bad.count.Load()
+		report.MalformedExamples = rs.bad.sorted()
+	}
+	if rs.dedupe != nil {
+		removed := rs.dedupe.removed.Load()
+		if report != nil {
+			report.Duplicates = removed
+		}
+		log.Printf("removed %d duplicate lines", removed)
+	}
+	if outputs != nil {
+		if closeErr := outputs.close(); err == nil {
+			err = closeErr
+		}
+	}
+	if errors.Is(err, errMemoryLimit) && canSpill(fpaths) {
+		log.Printf("%v, aggregating through spill files instead", err)
+		return evalSpilled(ctx, fpaths[0], os.TempDir(), *spillPartitions, w)
+	}
 	if err != nil {
 		return fmt.Errorf("error parsing statistics: %w", err)
 	}
-	format(ss, w)
+	if *statePath != "" {
+		ss, err = applyState(*statePath, ss, time.Duration(retain))
+		if err != nil {
+			return err
+		}
+	}
+	if *explodeDir != "" {
+		var hists *histograms
+		if outputs != nil {
+			hists = outputs.hg
+		}
+		if err := writeExploded(ss, hists, *explodeDir); err != nil {
+			return err
+		}
+	}
+	if q != nil {
+		return q.run(ss, w)
+	}
+	if *bucketByInitial {
+		return writeInitials(ss, w)
+	}
+	if err := format(ss, w); err != nil {
+		return err
+	}
+	for i, fileStats := range perFile {
+		if _, err := fmt.Fprintf(w, "%s\t", fpaths[i]); err != nil {
+			return fmt.Errorf("could not write output: %w", err)
+		}
+		if err := format(fileStats, w); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-// format will take a map of station statistics and a sorted list of stations
-// and return the properly formatted string output
-func format(ss *stationStats, w io.Writer) {
-	io.WriteString(w, "{")
-	for i, station := range ss.stations {
-		v := ss.stats[station]
-		io.WriteString(w, fmt.Sprintf(
-			"%s=%.1f/%.1f/%.1f",
-			station, v.min, round(v.sum/v.count), v.max,
-		))
-		if i < len(ss.stations)-1 {
-			io.WriteString(w, ", ")
-		}
+// format will take a map of station statistics and return the properly
+// formatted string output, in the order given by -sort-by and the -format
+func format(ss *stationStats, w io.Writer) error {
+	err := writeResults(results(ss, outputOrder()), *outputFormat, w)
+	if err != nil {
+		return fmt.Errorf("could not write output: %w", err)
+	}
+	return nil
+}
+
+// results converts the station statistics into their public form, sorted by
+// the given orderings and then by station. With no orderings the results are
+// left in hash order.
+func results(ss *stationStats, order []ordering) brc.Results {
+	rs := make(brc.Results, 0, len(ss.stats))
+	for station, v := range ss.stats {
+		rs = append(rs, brc.Result{Station: station, Stat: toStat(v)})
+	}
+	if order != nil {
+		slices.SortFunc(rs, func(a, b brc.Result) int {
+			return compareResults(a, b, order)
+		})
+	}
+	return rs
+}
+
+// toStat converts a station's running statistics into its public form
+func toStat(v *stat) brc.Stat {
+	return brc.Stat{
+		Min:   degrees(v.Min),
+		Mean:  compatMean(v),
+		Max:   degrees(v.Max),
+		Count: v.Count,
 	}
-	io.WriteString(w, "}\n")
 }
 
 // readStats reads the input file given the file path and returns a map of
-// station statistics and a sorted list of the stations
-func readStats(fpath string) (*stationStats, error) {
-	chunkChan := make(chan []byte)
-	statsChan := make(chan map[string]*stat)
+// station statistics
+func readStats(
+	ctx context.Context, fpath string, rs *runState,
+) (*stationStats, error) {
+	dec, err := detectDecoder(fpath)
+	if err != nil {
+		return nil, err
+	}
+	if dec != nil {
+		return readCompressed(ctx, fpath, dec, rs)
+	}
+	strategy, err := resolveStrategy(*strategy, fpath)
+	if err != nil {
+		return nil, err
+	}
+	stations, err := estimateStations(fpath)
+	if err != nil {
+		return nil, err
+	}
+	var mapped []byte
+	if strategy == strategyMmap {
+		// Some inputs, such as pipes and certain FUSE mounts, cannot be
+		// mapped but can still be read
+		if mapped, err = mapInput(fpath); err != nil {
+			log.Printf("%v, reading it instead", err)
+			strategy = strategyStream
+		}
+	}
+	if strategy == strategyReadAt {
+		// Pipes have no offsets to read at, but can still be read
+		if info, err := os.Stat(fpath); err == nil && !info.Mode().IsRegular() {
+			log.Printf("cannot read %s at offsets, reading it instead", fpath)
+			strategy = strategyStream
+		}
+	}
+	if report != nil {
+		report.Strategy = strategy
+		report.ExpectedStations = stations
+	}
+
+	switch strategy {
+	case strategyMmap:
+		// Workers only hold on to the chunks until they are done, so
+		// the mapping can go once the results are aggregated
+		defer munmap(mapped)
+		ss, err := process(ctx, rs, stations, func(
+			ctx context.Context, chunkChan chan<- []byte, counts *chunkCounts,
+		) error {
+			return splitter(ctx, mapped, fpath, chunkChan, counts)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return ss, checkInputSize(fpath, int64(len(mapped)))
+	case strategyReadAt:
+		readers := *jobs
+		if readers <= 0 {
+			readers = defaultJobs(cgroupLimits())
+		}
+		return processRanges(ctx, rs, stations, fpath, readers)
+	default:
+		return process(ctx, rs, stations, func(
+			ctx context.Context, chunkChan chan<- []byte, counts *chunkCounts,
+		) error {
+			return reader(ctx, fpath, chunkChan, counts)
+		})
+	}
+}
+
+// producer feeds the input to the workers in chunks ending on line
+// boundaries, closing the channel once done
+type producer func(
+	ctx context.Context, chunkChan chan<- []byte, counts *chunkCounts,
+) error
 
-	go reader(fpath, chunkChan)
+// runState is what a run collects besides the statistics, each part nil
+// unless a flag asks for it
+type runState struct {
+	outputs  *sideOutputs
+	dedupe   *deduper
+	bad      *badLines
+	stages   *pipelineStages
+	watchdog *watchdog
+}
 
-	var wg sync.WaitGroup
-	for i := 0; i < *jobs; i++ {
-		wg.Add(1)
-		go worker(&wg, chunkChan, statsChan)
+// process runs the workers and the aggregator over the chunks of a producer
+// and returns the aggregated station statistics. The run state may be nil for
+// a run that collects nothing else.
+func process(
+	ctx context.Context, rs *runState, stations int, produce producer,
+) (*stationStats, error) {
+	if rs == nil {
+		rs = &runState{}
 	}
+	counts := rs.counts()
 
-	resultChan := make(chan *stationStats)
-	go aggregator(statsChan, resultChan)
+	workers := *jobs
+	if workers <= 0 {
+		workers = defaultJobs(cgroupLimits())
+	}
+	read := func(ctx context.Context, chunkChan chan<- []byte) error {
+		if counts.stages == nil {
+			return produce(ctx, chunkChan, counts)
+		}
+		// The reader is busy whenever it is not waiting on the workers to
+		// take a chunk
+		start, waited := time.Now(), counts.stages.reader.wait.Load()
+		err := produce(ctx, chunkChan, counts)
+		waited = counts.stages.reader.wait.Load() - waited
+		counts.stages.reader.busy.Add(int64(time.Since(start)) - waited)
+		return err
+	}
+	if *twoStage {
+		return processTwoStage(ctx, stations, read, counts, workers)
+	}
+
+	c := startCollector(rs, stations)
+	err := pipeline.Run(ctx, prefetchDepth, workers, read,
+		func(ctx context.Context, chunkChan <-chan []byte) error {
+			return worker(
+				ctx, chunkChan, c.statsChan, stations, rs.outputs, rs.dedupe,
+				counts, c.table,
+			)
+		},
+	)
+	result := c.result()
+	if err == nil {
+		err = counts.check()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// counts returns the accounting of the chunks of a run, set up to report
+// what the run collects
+func (rs *runState) counts() *chunkCounts {
+	counts := &chunkCounts{bad: rs.bad}
+	// Workers only need to know where lines are to report those they skip
+	counts.trackOrigins = rs.bad != nil ||
+		rs.outputs != nil && rs.outputs.rj != nil
+	counts.watchdog = rs.watchdog
+	counts.stages = rs.stages
+	return counts
+}
 
-	wg.Wait()
-	close(statsChan)
+// collector gathers the stats the workers hand over, into a shared table if
+// -table shared is given and through the aggregator otherwise
+type collector struct {
+	table      *sharedTable
+	statsChan  chan map[string]*stat
+	resultChan chan *stationStats
+}
+
+func startCollector(rs *runState, stations int) *collector {
+	c := &collector{
+		statsChan:  make(chan map[string]*stat),
+		resultChan: make(chan *stationStats),
+	}
+	if *tableMode == tableShared {
+		c.table = newSharedTable()
+	}
+	var aggregate *stageMetrics
+	if rs.stages != nil {
+		aggregate = &rs.stages.aggregate
+	}
+	go aggregator(c.statsChan, c.resultChan, stations, aggregate)
+	return c
+}
 
-	return <-resultChan, nil
+// result returns the stats gathered once every worker is done
+func (c *collector) result() *stationStats {
+	close(c.statsChan)
+	result := <-c.resultChan
+	if c.table != nil {
+		result = c.table.snapshot()
+	}
+	return result
 }
 
 // aggregator reads a stream of maps of stats and aggregates them all before
@@ -112,123 +602,489 @@ func readStats(fpath string) (*stationStats, error) {
 func aggregator(
 	statsChan <-chan map[string]*stat,
 	resultChan chan<- *stationStats,
+	expected int,
+	metrics *stageMetrics,
 ) {
-	stations := []string{}
-	stats := make(map[string]*stat)
-	for partialStats := range statsChan {
+	expected = min(expected, maxPreallocStations)
+	stats := make(map[string]*stat, expected)
+	clock := metrics.clock()
+	for {
+		clock.waiting()
+		partialStats, ok := <-statsChan
+		if !ok {
+			clock.done()
+			break
+		}
+		clock.working()
 		for k, v := range partialStats {
 			if val, ok := stats[k]; ok {
-				val.count += v.count
-				val.sum += v.sum
-				val.min = min(val.min, v.min)
-				val.max = max(val.max, v.max)
+				val.Merge(v)
 			} else {
 				stats[k] = v
-				stations = append(stations, k)
 			}
 		}
 	}
 
-	sort.Strings(stations)
-
-	resultChan <- &stationStats{stats, stations}
+	resultChan <- &stationStats{stats}
 	close(resultChan)
 }
 
-// reader reads a file chunk by chunk and forwards the chunks to a channel
-func reader(fpath string, chunkChan chan<- []byte) error {
-	f, err := os.Open(fpath)
+// reader reads a file chunk by chunk and forwards the chunks to a channel.
+// Chunks always end on a line boundary; the partial line at the end of a read
+// is carried over into the next chunk.
+func reader(
+	ctx context.Context, fpath string, chunkChan chan<- []byte, counts *chunkCounts,
+) error {
+	defer close(chunkChan)
+	var throttle *tokenBucket
+	if *maxReadMbps > 0 {
+		throttle = newTokenBucket(*maxReadMbps, chunkSize)
+	}
+	return readChunks(ctx, fpath, chunkChan, counts, throttle)
+}
+
+// readChunks reads a file chunk by chunk into a channel like reader, leaving
+// the channel open for more input. Reads wait on the throttle if given.
+func readChunks(
+	ctx context.Context,
+	fpath string,
+	chunkChan chan<- []byte,
+	counts *chunkCounts,
+	throttle *tokenBucket,
+) error {
+	// Only regular files have a size to hold the reads to
+	size := int64(-1)
+	var src io.Reader = stdin()
+	if fpath != stdinInput {
+		f, err := os.Open(fpath)
+		if err != nil {
+			return fmt.Errorf("could not open file: %w", err)
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return fmt.Errorf("could not stat file: %w", err)
+		}
+		src = f
+		if info.Mode().IsRegular() {
+			size = info.Size()
+			if *tolerateGrowth {
+				src = io.LimitReader(f, size)
+			}
+		}
+	}
+
+	leftOver, total, err := readLines(
+		ctx, src, fpath, chunkChan, counts, throttle,
+	)
 	if err != nil {
-		return fmt.Errorf("could not open file: %w", err)
+		return err
 	}
-	defer f.Close()
+	if size >= 0 {
+		if err := sizeChanged(size, total); err != nil {
+			return err
+		}
+	}
+	if len(leftOver) > 0 {
+		return counts.sendFrom(
+			ctx, chunkChan, leftOver,
+			chunkOrigin{fpath, total - int64(len(leftOver))},
+		)
+	}
+	return nil
+}
 
+// readLines reads chunks ending on line boundaries from src, the input of the
+// given name, into a channel until it is exhausted, returning the partial line
+// left at the end and the number of bytes read
+func readLines(
+	ctx context.Context,
+	src io.Reader,
+	input string,
+	chunkChan chan<- []byte,
+	counts *chunkCounts,
+	throttle *tokenBucket,
+) (leftOver []byte, total int64, err error) {
 	readBuf := make([]byte, chunkSize)
-	leftOver := make([]byte, 0, chunkSize)
 	for {
-		numBytesRead, err := f.Read(readBuf)
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				break
+		if throttle != nil {
+			if err := throttle.wait(ctx, len(readBuf)); err != nil {
+				return nil, total, err
 			}
-			return fmt.Errorf("error reading file: %w", err)
 		}
+		numBytesRead, err := io.ReadFull(src, readBuf)
+		offset := total - int64(len(leftOver))
+		total += int64(numBytesRead)
+		data := readBuf[:numBytesRead]
+		if lastLineIdx := bytes.LastIndexByte(data, '\n'); lastLineIdx >= 0 {
+			sendBuf := make([]byte, len(leftOver)+lastLineIdx+1)
+			copy(sendBuf, leftOver)
+			copy(sendBuf[len(leftOver):], data[:lastLineIdx+1])
+			err := counts.sendFrom(
+				ctx, chunkChan, sendBuf, chunkOrigin{input, offset},
+			)
+			if err != nil {
+				return nil, total, err
+			}
+			data = data[lastLineIdx+1:]
+			leftOver = leftOver[:0]
+		}
+		leftOver = append(leftOver, data...)
+
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return leftOver, total, nil
+		}
+		if err != nil {
+			return nil, total, fmt.Errorf("error reading file: %w", err)
+		}
+	}
+}
 
-		readBuf = readBuf[:numBytesRead]
-		lastLineIdx := bytes.LastIndex(readBuf, []byte{'\n'})
-		sendBuf := append(leftOver, readBuf[:lastLineIdx+1]...)
-		leftOver = make([]byte, len(readBuf[lastLineIdx+1:]))
-		copy(leftOver, readBuf[lastLineIdx+1:])
-		chunkChan <- sendBuf
+// mapInput memory maps the whole input file
+func mapInput(fpath string) ([]byte, error) {
+	// Pipes cannot be mapped, and opening one here would lose its input
+	info, err := os.Stat(fpath)
+	if err != nil {
+		return nil, fmt.Errorf("could not stat file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("could not map file: %s is not a regular file", fpath)
+	}
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, fmt.Errorf("could not open file: %w", err)
+	}
+	defer f.Close()
+	data, err := mmapFile(f, info.Size())
+	if err != nil {
+		return nil, fmt.Errorf("could not map file: %w", err)
+	}
+	return data, nil
+}
+
+// splitter cuts a mapped file into chunks ending on line boundaries and
+// forwards them to a channel without copying, closing it once done
+func splitter(
+	ctx context.Context,
+	data []byte,
+	fpath string,
+	chunkChan chan<- []byte,
+	counts *chunkCounts,
+) error {
+	defer close(chunkChan)
+	var throttle *tokenBucket
+	if *maxReadMbps > 0 {
+		throttle = newTokenBucket(*maxReadMbps, chunkSize)
+	}
+	offset := int64(0)
+	for len(data) > 0 {
+		end := min(chunkSize, len(data))
+		if i := bytes.IndexByte(data[end:], '\n'); i >= 0 {
+			end += i + 1
+		} else {
+			end = len(data)
+		}
+		// Pages of the mapping are read in as workers touch them, so
+		// throttling the hand out of chunks throttles the reads
+		if throttle != nil {
+			if err := throttle.wait(ctx, end); err != nil {
+				return err
+			}
+		}
+		err := counts.sendFrom(
+			ctx, chunkChan, data[:end], chunkOrigin{fpath, offset},
+		)
+		if err != nil {
+			return err
+		}
+		data = data[end:]
+		offset += int64(end)
 	}
-	close(chunkChan)
 	return nil
 }
 
-// worker processes strings fed to it by the lines channel input and writes its
-// stats map results into the stats channel
+// worker processes chunks of lines fed to it by the chunk channel and writes
+// its stats map results into the stats channel
 func worker(
-	wg *sync.WaitGroup,
+	ctx context.Context,
 	chunkChan <-chan []byte,
 	statsChan chan<- map[string]*stat,
-) error {
-	defer wg.Done()
-	stats := make(map[string]*stat)
-	for chunk := range chunkChan {
-		strChunk := string(chunk)
-		start := 0
-		var station string
-		for i, ch := range strChunk {
-			if ch == ';' {
-				station = strChunk[start:i]
-				start = i + 1
-			} else if ch == '\n' {
-				temp := parseFloat(strChunk[start:i])
-				if val, ok := stats[station]; ok {
-					val.count++
-					val.sum += temp
-					val.min = min(val.min, temp)
-					val.max = max(val.max, temp)
-				} else {
-					stats[station] = &stat{
-						count: 1,
-						min:   temp,
-						max:   temp,
-						sum:   temp,
-					}
-				}
-				start = i + 1
-			}
+	expected int,
+	out *sideOutputs,
+	dedupe *deduper,
+	counts *chunkCounts,
+	table *sharedTable,
+) (err error) {
+	// A mapped input truncated underneath us faults on access instead of
+	// failing a read, so turn the fault into an error
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer recoverWorker(&err)
+	w := newChunkWorker(statsChan, expected, out, dedupe, counts, table)
+	var clock *stageClock
+	if counts.stages != nil {
+		clock = counts.stages.parse.clock()
+	}
+	for {
+		clock.waiting()
+		chunk, ok := <-chunkChan
+		if !ok {
+			clock.done()
+			break
 		}
+		clock.working()
+		origin := counts.origin(chunk)
+		w.receive(chunk)
+		if ctx.Err() != nil {
+			// Drain the remaining chunks without processing them
+			continue
+		}
+		w.aggregate(chunk, origin)
 	}
-	statsChan <- stats
+	w.done()
 	return nil
 }
 
-// parseFloat is a custom float parser optimized for the given contraint that
-// the input is within the range [-99.9, 99.9]
-func parseFloat(s string) float64 {
-	var neg bool
-	if s[0] == '-' {
-		neg = true
-		s = s[1:]
+// chunkWorker is what a worker aggregates: the statistics of the chunks it
+// was handed and whatever it collects for the side outputs
+type chunkWorker struct {
+	statsChan chan<- map[string]*stat
+	out       *sideOutputs
+	dedupe    *deduper
+	counts    *chunkCounts
+	table     *sharedTable
+
+	small     *smallMap
+	stats     *byteMap
+	lastFlush time.Time
+	chunks    int
+
+	extracted         map[string][]byte
+	cleaned, rejected []byte
+	sampled           *reservoir
+	normals           workerMoments
+	hists             *workerHistograms
+}
+
+func newChunkWorker(
+	statsChan chan<- map[string]*stat,
+	expected int,
+	out *sideOutputs,
+	dedupe *deduper,
+	counts *chunkCounts,
+	table *sharedTable,
+) *chunkWorker {
+	w := &chunkWorker{
+		statsChan: statsChan, out: out, dedupe: dedupe, counts: counts,
+		table: table, lastFlush: time.Now(),
+	}
+	w.small = newWorkerSmallMap(expected)
+	w.stats = newByteMap(0)
+	if w.small == nil {
+		w.stats = newByteMap(min(expected, maxPreallocStations))
+	}
+	if out == nil {
+		return w
+	}
+	if out.ex != nil {
+		w.extracted = make(map[string][]byte)
+	}
+	if out.sm != nil {
+		w.sampled = out.sm.newReservoir()
+	}
+	if out.nm != nil {
+		w.normals = workerMoments{}
+	}
+	if out.hg != nil {
+		w.hists = out.hg.newWorker()
+	}
+	return w
+}
+
+// receive accounts for a chunk taken from the reader
+func (w *chunkWorker) receive(chunk []byte) {
+	w.counts.received.Add(int64(len(chunk)))
+	w.chunks++
+	if w.chunks == *chaosWorkerPanic {
+		panic("chaos: worker panic")
+	}
+}
+
+// aggregate adds the lines of a chunk to the statistics and side outputs of
+// the worker. Origin is where the chunk comes from, nil if it is not known.
+func (w *chunkWorker) aggregate(chunk []byte, origin *chunkOrigin) {
+	var ex *extractor
+	var cl *cleaner
+	var rj *rejecter
+	if w.out != nil {
+		ex, cl, rj = w.out.ex, w.out.cl, w.out.rj
+	}
+	start := len(chunk)
+	for len(chunk) > 0 {
+		pos := start - len(chunk)
+		station, value, rest := fastparse.ScanLine(chunk)
+		line := chunk[:len(chunk)-len(rest)]
+		chunk = rest
+		if w.sampled != nil {
+			w.sampled.add(bytes.TrimSuffix(line, []byte{'\n'}))
+		}
+		if cl != nil && station != nil {
+			station, value = cleanFields(station, value)
+		}
+		tenths, n := fastparse.ParseTempTenths(value)
+		reason := ""
+		switch {
+		case station == nil:
+			reason = rejectNoSeparator
+		case n != len(value):
+			reason = rejectBadValue
+		case cl != nil && len(station) == 0:
+			reason = rejectNoStation
+		}
+		if reason != "" {
+			// Malformed lines are skipped, but counted for -report
+			raw := bytes.TrimSuffix(line, []byte{'\n'})
+			if w.counts.bad != nil {
+				w.counts.bad.add(origin, pos, raw)
+			}
+			if rj != nil {
+				w.rejected = appendRejectLine(
+					w.rejected, reason, origin, pos, raw,
+				)
+			}
+			continue
+		}
+		if w.dedupe != nil && w.dedupe.duplicate(line) {
+			if rj != nil {
+				w.rejected = appendRejectLine(
+					w.rejected, rejectDuplicate, origin, pos,
+					bytes.TrimSuffix(line, []byte{'\n'}),
+				)
+			}
+			continue
+		}
+		if cl != nil {
+			w.cleaned = appendCleanLine(w.cleaned, station, tenths)
+		}
+		if ex != nil {
+			if _, ok := ex.files[string(station)]; ok {
+				w.extracted[string(station)] = append(
+					w.extracted[string(station)], line...,
+				)
+			}
+		}
+		if w.normals != nil {
+			w.normals.add(station, int64(tenths))
+		}
+		if w.hists != nil {
+			w.hists.add(station, int64(tenths))
+		}
+		if w.small == nil || !w.small.add(station, int64(tenths)) {
+			w.stats.add(station, int64(tenths))
+		}
+	}
+	if ex != nil {
+		ex.flush(w.extracted)
+	}
+	if len(w.cleaned) > 0 {
+		cl.write(w.cleaned)
+		w.cleaned = w.cleaned[:0]
+	}
+	if len(w.rejected) > 0 {
+		rj.write(w.rejected)
+		w.rejected = w.rejected[:0]
+	}
+	if w.small != nil && w.stats.len() > smallMapMaxOverflow {
+		w.small.mergeInto(w.stats)
+		w.small = nil
+	}
+	// Hand the stats so far over as a delta, so long runs neither hold
+	// everything in the worker nor hide it until the end. A shared table
+	// is updated after every chunk.
+	if w.table != nil ||
+		*flushInterval > 0 && time.Since(w.lastFlush) >= *flushInterval {
+		w.flush()
+	}
+}
+
+// flush hands the stats so far over as a delta and starts afresh
+func (w *chunkWorker) flush() {
+	if w.small != nil {
+		w.small.mergeInto(w.stats)
+		w.small.reset()
 	}
-	num := 0.0
-	if len(s) == 3 {
-		num = float64(int(s[0])-int('0')) +
-			float64(int(s[2])-int('0'))/10
+	if w.table != nil {
+		w.table.add(w.stats.toMap())
 	} else {
-		num = float64(int(s[0])-int('0'))*10 +
-			float64(int(s[1])-int('0')) +
-			float64(int(s[3])-int('0'))/10
+		w.statsChan <- w.stats.toMap()
+	}
+	w.stats.reset()
+	w.lastFlush = time.Now()
+}
+
+// done hands over everything the worker has left once it runs out of chunks
+func (w *chunkWorker) done() {
+	w.flush()
+	if w.sampled != nil {
+		w.out.sm.done(w.sampled)
+	}
+	if w.normals != nil {
+		w.out.nm.done(w.normals)
+	}
+	if w.hists != nil {
+		w.out.hg.done(w.hists)
+	}
+}
+
+// recoverWorker turns a panic of a worker into its error, deferred by workers
+// reading chunks that may be mapped
+func recoverWorker(err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	if fault, ok := r.(interface{ Addr() uintptr }); ok {
+		*err = fmt.Errorf(
+			"input was truncated during processing (fault at %#x)",
+			fault.Addr(),
+		)
+		return
 	}
-	if neg {
-		num = -num
+	*err = fmt.Errorf("worker panicked: %v\n%s", r, debug.Stack())
+}
+
+// newWorkerSmallMap returns the small map a worker should start with given
+// the expected cardinality, or nil if it is too high for it to help
+func newWorkerSmallMap(expected int) *smallMap {
+	switch {
+	case expected <= 0:
+		return newSmallMap(smallMapDefaultStations)
+	case expected <= smallMapMaxStations:
+		return newSmallMap(expected)
+	default:
+		return nil
 	}
-	return num
 }
 
-// round rounds a float with IEEE 754 roundTowardPositive to one decimal place
-func round(f float64) float64 {
-	return math.Ceil(f*10) / 10
+// degrees converts tenths of a degree to degrees
+func degrees(tenths int64) float64 {
+	return float64(tenths) / 10
+}
+
+// tenthsOf converts degrees to the nearest tenths of a degree
+func tenthsOf(degrees float64) int64 {
+	return int64(math.Round(degrees * 10))
+}
+
+// mean returns the mean temperature of a station in degrees, rounded to one
+// decimal place as -rounding has it. The division is exact, so a mean right on
+// a tenth or half of one is never rounded past it.
+func mean(v *stat) float64 {
+	if *rounding == roundCeil {
+		q := v.Sum / v.Count
+		if v.Sum%v.Count > 0 {
+			q++
+		}
+		return degrees(q)
+	}
+	return degrees(v.Mean())
 }
@@ -1,13 +1,19 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const (
@@ -17,6 +23,99 @@ const (
 )
 
 func TestEval(t *testing.T) {
+	testSamples(t)
+}
+
+// BenchmarkEval evaluates 10,000 stations repeated to about 64 MiB, large
+// enough for the reader, workers and merge all to show up in a profile
+func BenchmarkEval(b *testing.B) {
+	sample, err := os.ReadFile(filepath.Join(
+		sampleInputDir, "measurements-10000-unique-keys"+sampleInputExt,
+	))
+	require.NoError(b, err)
+	fpath := filepath.Join(b.TempDir(), "measurements.txt")
+	input := bytes.Repeat(sample, 64<<20/len(sample))
+	require.NoError(b, os.WriteFile(fpath, input, 0o644))
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+	for range b.N {
+		require.NoError(b, eval(context.Background(), fpath, io.Discard))
+	}
+}
+
+func TestEvalExpectStations(t *testing.T) {
+	defer func(n int) { *expectStations = n }(*expectStations)
+	for _, hint := range []int{1, 413, smallMapMaxStations + 1} {
+		*expectStations = hint
+		t.Run(fmt.Sprint(hint), testSamples)
+	}
+}
+
+func TestEvalStrategies(t *testing.T) {
+	defer func(s string) { *strategy = s }(*strategy)
+	for _, s := range []string{strategyStream, strategyMmap, strategyReadAt} {
+		*strategy = s
+		t.Run(s, testSamples)
+	}
+}
+
+func TestEvalSpill(t *testing.T) {
+	defer func(dir string, n int) {
+		*spillDir, *spillPartitions = dir, n
+	}(*spillDir, *spillPartitions)
+	*spillDir, *spillPartitions = t.TempDir(), 4
+	testSamples(t)
+}
+
+func TestEvalSpillEncrypted(t *testing.T) {
+	defer func(dir string, n int, key []byte) {
+		*spillDir, *spillPartitions, atRestKey = dir, n, key
+	}(*spillDir, *spillPartitions, atRestKey)
+	*spillDir, *spillPartitions = t.TempDir(), 4
+	atRestKey = testKey(1)
+	testSamples(t)
+}
+
+func TestEvalTables(t *testing.T) {
+	defer func(s string, n int) {
+		*tableMode, chunkSize = s, n
+	}(*tableMode, chunkSize)
+	chunkSize = 4096
+	for _, s := range tables {
+		*tableMode = s
+		t.Run(s, testSamples)
+	}
+}
+
+func TestEvalNoSort(t *testing.T) {
+	defer func(b bool) { *noSort = b }(*noSort)
+	input := filepath.Join(sampleInputDir, "measurements-10000-unique-keys")
+	expected, err := readFile(input + sampleOutputExt)
+	require.NoError(t, err)
+	*noSort = true
+	var out strings.Builder
+	require.NoError(t, eval(context.Background(), input+sampleInputExt, &out))
+	// Stations come in hash order, so only the set of them can be compared
+	entries := func(s string) []string {
+		s = strings.TrimSuffix(strings.TrimPrefix(s, "{"), "}\n")
+		e := strings.Split(s, ", ")
+		sort.Strings(e)
+		return e
+	}
+	assert.Equal(t, entries(expected), entries(out.String()))
+}
+
+func TestEvalFlushInterval(t *testing.T) {
+	defer func(d time.Duration, n int) {
+		*flushInterval, chunkSize = d, n
+	}(*flushInterval, chunkSize)
+	// Flush a delta after every small chunk
+	*flushInterval, chunkSize = time.Nanosecond, 4096
+	testSamples(t)
+}
+
+// testSamples evaluates every sample input and compares it to its output
+func testSamples(t *testing.T) {
 	inputFiles, err := findFiles(sampleInputDir, sampleInputExt)
 	if err != nil {
 		t.Errorf("could not get input files: %v", err)
@@ -24,7 +123,7 @@ func TestEval(t *testing.T) {
 	for _, file := range inputFiles {
 		t.Run(filepath.Base(file), func(t *testing.T) {
 			var actual strings.Builder
-			err := eval(file+sampleInputExt, &actual)
+			err := eval(context.Background(), file+sampleInputExt, &actual)
 			if err != nil {
 				t.Errorf("could not evaluate input: %v", err)
 			}
@@ -59,3 +158,66 @@ func findFiles(dir string, ext string) ([]string, error) {
 	}
 	return filePaths, nil
 }
+
+func TestSoak(t *testing.T) {
+	defer func(s string) { *strategy = s }(*strategy)
+	input := filepath.Join(sampleInputDir, "measurements-10000-unique-keys")
+	expected, err := readFile(input + sampleOutputExt)
+	if err != nil {
+		t.Fatalf("could not read output file: %v", err)
+	}
+	for _, s := range []string{strategyStream, strategyMmap, strategyReadAt} {
+		*strategy = s
+		t.Run(s, func(t *testing.T) {
+			var actual strings.Builder
+			if err := soak(
+				context.Background(), []string{input + sampleInputExt}, 5,
+				&actual,
+			); err != nil {
+				t.Fatalf("soak failed: %v", err)
+			}
+			assert.Equal(t, expected, actual.String())
+		})
+	}
+}
+
+func TestEvalCanceled(t *testing.T) {
+	defer func(s string) { *strategy = s }(*strategy)
+	input := filepath.Join(sampleInputDir, "measurements-rounding.txt")
+	for _, s := range []string{strategyStream, strategyMmap, strategyReadAt} {
+		*strategy = s
+		t.Run(s, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			var actual strings.Builder
+			err := eval(ctx, input, &actual)
+			assert.ErrorIs(t, err, context.Canceled)
+			assert.Empty(t, actual.String())
+		})
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	<-ctx.Done()
+	assert.Equal(t, exitTimeout, exitCode(ctx.Err()))
+	assert.Equal(t, exitInterrupted, exitCode(
+		fmt.Errorf("could not read: %w", context.Canceled),
+	))
+	assert.Equal(t, 1, exitCode(os.ErrNotExist))
+}
+
+func TestEvalMissing(t *testing.T) {
+	defer func(s string) { *strategy = s }(*strategy)
+	input := filepath.Join(t.TempDir(), "missing.txt")
+	for _, s := range []string{strategyStream, strategyMmap, strategyReadAt} {
+		*strategy = s
+		t.Run(s, func(t *testing.T) {
+			var actual strings.Builder
+			err := eval(context.Background(), input, &actual)
+			assert.ErrorIs(t, err, os.ErrNotExist)
+			assert.Empty(t, actual.String())
+		})
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// mmapSupported reports whether files can be memory mapped
+const mmapSupported = false
+
+var errMmapUnsupported = errors.New("mmap is not supported on this platform")
+
+// mmapFile is not supported outside of unix platforms
+func mmapFile(f *os.File, size int64) ([]byte, error) {
+	return nil, errMmapUnsupported
+}
+
+// munmap is not supported outside of unix platforms
+func munmap(b []byte) error {
+	return errMmapUnsupported
+}
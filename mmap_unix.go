@@ -0,0 +1,29 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmapSupported reports whether files can be memory mapped
+const mmapSupported = true
+
+// mmapFile maps the first size bytes of a file read-only into memory
+func mmapFile(f *os.File, size int64) ([]byte, error) {
+	if size == 0 {
+		return []byte{}, nil
+	}
+	return syscall.Mmap(
+		int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED,
+	)
+}
+
+// munmap releases a mapping returned by mmapFile
+func munmap(b []byte) error {
+	if len(b) == 0 {
+		return nil
+	}
+	return syscall.Munmap(b)
+}
@@ -0,0 +1,39 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvalMmapFallback(t *testing.T) {
+	defer func(s string, n int) {
+		*strategy, *expectStations = s, n
+	}(*strategy, *expectStations)
+	// A hint keeps the cardinality sample from consuming the pipe
+	*expectStations = 1
+	for _, s := range []string{strategyMmap, strategyReadAt} {
+		*strategy = s
+		fifo := filepath.Join(t.TempDir(), "input.fifo")
+		require.NoError(t, syscall.Mkfifo(fifo, 0o600))
+		go func() {
+			f, err := os.OpenFile(fifo, os.O_WRONLY, 0)
+			if err != nil {
+				return
+			}
+			defer f.Close()
+			f.WriteString("Oslo;-3.0\nOslo;1.0\n")
+		}()
+		var out strings.Builder
+		require.NoError(t, eval(context.Background(), fifo, &out), s)
+		assert.Equal(t, "{Oslo=-3.0/-1.0/1.0}\n", out.String(), s)
+	}
+}
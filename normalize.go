@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/aeolyus/1brc/brc/fastparse"
+)
+
+// normalizer writes the measurements of a run as station;zscore lines, each
+// temperature standardized by the mean and standard deviation of its station.
+// Those are only known once every line has been seen, so workers sum the
+// temperatures and their squares as they go, and once the run is done a
+// second pass over the inputs writes the scores in the order of the lines.
+type normalizer struct {
+	mu      sync.Mutex
+	fpath   string
+	inputs  []string
+	moments map[string]*moments
+}
+
+// moments are the sums of a station's temperatures and of their squares, in
+// tenths and hundredths of a degree
+type moments struct {
+	count, sum, squares int64
+}
+
+// newNormalizer starts the moments of a run over the inputs, whose scores are
+// to be written to fpath
+func newNormalizer(fpath string, inputs []string) *normalizer {
+	return &normalizer{
+		fpath: fpath, inputs: inputs, moments: make(map[string]*moments),
+	}
+}
+
+// workerMoments are the moments of the stations seen by one worker
+type workerMoments map[string]*moments
+
+// add records a temperature in tenths for a station
+func (wm workerMoments) add(station []byte, tenths int64) {
+	m, ok := wm[string(station)]
+	if !ok {
+		m = &moments{}
+		wm[string(station)] = m
+	}
+	m.count++
+	m.sum += tenths
+	m.squares += tenths * tenths
+}
+
+// done hands a worker's moments over to be merged
+func (n *normalizer) done(wm workerMoments) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for station, m := range wm {
+		if total, ok := n.moments[station]; ok {
+			total.count += m.count
+			total.sum += m.sum
+			total.squares += m.squares
+		} else {
+			n.moments[station] = m
+		}
+	}
+}
+
+// scaling returns the mean and population standard deviation of a station in
+// tenths of a degree
+func (m *moments) scaling() (mean, stddev float64) {
+	count := float64(m.count)
+	mean = float64(m.sum) / count
+	variance := float64(m.squares)/count - mean*mean
+	return mean, math.Sqrt(max(variance, 0))
+}
+
+// write streams the inputs again, writing the score of every well-formed line
+// to the file. Stations whose temperatures never vary score 0.
+func (n *normalizer) write() error {
+	f, err := os.Create(n.fpath)
+	if err != nil {
+		return fmt.Errorf("could not create normalize file: %w", err)
+	}
+	w := bufio.NewWriterSize(f, chunkSize)
+	for _, fpath := range n.inputs {
+		if err := n.writeInput(w, fpath); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("could not write normalize file: %w", err)
+	}
+	return f.Close()
+}
+
+// writeInput writes the scores of the lines of one input
+func (n *normalizer) writeInput(w *bufio.Writer, fpath string) error {
+	r, err := openDecoded(fpath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	br := bufio.NewReaderSize(r, chunkSize)
+	var scored []byte
+	for {
+		line, err := br.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			return errors.New("line longer than the chunk size")
+		}
+		station, value, _ := fastparse.ScanLine(line)
+		tenths, size := fastparse.ParseTempTenths(value)
+		// The first pass skipped malformed lines, and so does this one
+		m, ok := n.moments[string(station)]
+		if ok && station != nil && size == len(value) {
+			mean, stddev := m.scaling()
+			z := 0.0
+			if stddev > 0 {
+				z = (float64(tenths) - mean) / stddev
+			}
+			scored = append(scored[:0], station...)
+			scored = append(scored, ';')
+			scored = strconv.AppendFloat(scored, z, 'f', 4, 64)
+			scored = append(scored, '\n')
+			if _, err := w.Write(scored); err != nil {
+				return fmt.Errorf("could not write normalize file: %w", err)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading file: %w", err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvalNormalizeOut(t *testing.T) {
+	defer func(s string, n int, j int) {
+		*normalizeOut, chunkSize, *jobs = s, n, j
+	}(*normalizeOut, chunkSize, *jobs)
+	// Several workers each see part of the stations' lines
+	chunkSize, *jobs = 64, 4
+	input := filepath.Join(t.TempDir(), "input.txt")
+	require.NoError(t, os.WriteFile(input, []byte(
+		"Oslo;-3.0\nRome;5.0\nOslo;1.0\nno separator\nRome;5.0\nOslo;2.0\n",
+	), 0o644))
+	*normalizeOut = filepath.Join(t.TempDir(), "normalized.txt")
+	var out strings.Builder
+	require.NoError(t, eval(context.Background(), input, &out))
+	assert.Equal(t, "{Oslo=-3.0/0.0/2.0, Rome=5.0/5.0/5.0}\n", out.String())
+	normalized, err := os.ReadFile(*normalizeOut)
+	require.NoError(t, err)
+	assert.Equal(
+		t,
+		"Oslo;-1.3887\nRome;0.0000\nOslo;0.4629\nRome;0.0000\nOslo;0.9258\n",
+		string(normalized),
+	)
+}
+
+func TestEvalNormalizeOutSample(t *testing.T) {
+	defer func(s string) { *normalizeOut = s }(*normalizeOut)
+	input := filepath.Join(sampleInputDir, "measurements-10000-unique-keys")
+	*normalizeOut = filepath.Join(t.TempDir(), "normalized.txt")
+	var out strings.Builder
+	require.NoError(t, eval(context.Background(), input+sampleInputExt, &out))
+	normalized, err := os.ReadFile(*normalizeOut)
+	require.NoError(t, err)
+
+	// The scores of every station have a mean of 0 and, unless they are all
+	// 0, a standard deviation of 1
+	type sums struct{ n, sum, squares float64 }
+	stations := map[string]*sums{}
+	for _, line := range strings.Split(strings.TrimSuffix(string(normalized), "\n"), "\n") {
+		station, score, ok := strings.Cut(line, ";")
+		require.True(t, ok, line)
+		z, err := strconv.ParseFloat(score, 64)
+		require.NoError(t, err, line)
+		s := stations[station]
+		if s == nil {
+			s = &sums{}
+			stations[station] = s
+		}
+		s.n++
+		s.sum += z
+		s.squares += z * z
+	}
+	assert.Len(t, stations, 10000)
+	for station, s := range stations {
+		assert.InDelta(t, 0, s.sum/s.n, 1e-3, station)
+		if s.squares > 0 {
+			assert.InDelta(t, 1, math.Sqrt(s.squares/s.n), 1e-3, station)
+		}
+	}
+}
+
+func TestNormalizeOutFlags(t *testing.T) {
+	defer func(s string, d bool) {
+		*normalizeOut, *dedupeFlag = s, d
+	}(*normalizeOut, *dedupeFlag)
+	*normalizeOut, *dedupeFlag = "normalized.txt", true
+	assert.ErrorContains(t, validateFlags(), "-normalize-out cannot be used with")
+}
@@ -0,0 +1,86 @@
+package main
+
+import "fmt"
+
+// sideOutputs are the files a run writes besides its results. They stay open
+// for the whole run, however many times the pipeline runs in it, e.g. once per
+// file with -per-file.
+type sideOutputs struct {
+	ex *extractor
+	cl *cleaner
+	sm *sampler
+	rj *rejecter
+	nm *normalizer
+	hg *histograms
+}
+
+// openSideOutputs creates the files asked for by -extract, -clean-out and
+// -reject-out, and starts the sample asked for by -sample-out, the moments of
+// the inputs asked for by -normalize-out and the histograms asked for by
+// -explode-bin-width, or returns nil if there are none
+func openSideOutputs(inputs []string) (*sideOutputs, error) {
+	if len(extractStations) == 0 && *cleanOut == "" && *sampleOut == "" &&
+		*rejectOut == "" && *normalizeOut == "" && *explodeBinWidth == 0 {
+		return nil, nil
+	}
+	o := &sideOutputs{}
+	var err error
+	if len(extractStations) > 0 {
+		if o.ex, err = newExtractor(extractStations, *extractOut); err != nil {
+			return nil, err
+		}
+	}
+	if *cleanOut != "" {
+		if o.cl, err = newCleaner(*cleanOut); err != nil {
+			o.close()
+			return nil, err
+		}
+	}
+	if *rejectOut != "" {
+		if o.rj, err = newRejecter(*rejectOut); err != nil {
+			o.close()
+			return nil, err
+		}
+	}
+	if *sampleOut != "" {
+		o.sm = newSampler(*sampleOut, *sampleLines)
+	}
+	if *normalizeOut != "" {
+		o.nm = newNormalizer(*normalizeOut, inputs)
+	}
+	if *explodeBinWidth > 0 {
+		o.hg = newHistograms(binWidth(*explodeBinWidth))
+	}
+	return o, nil
+}
+
+// close flushes and closes every side output, returning the first error
+func (o *sideOutputs) close() error {
+	var firstErr error
+	if o.ex != nil {
+		if err := o.ex.close(); err != nil {
+			firstErr = fmt.Errorf("could not close extract files: %w", err)
+		}
+	}
+	if o.cl != nil {
+		if err := o.cl.close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("could not close clean file: %w", err)
+		}
+	}
+	if o.rj != nil {
+		if err := o.rj.close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("could not close reject file: %w", err)
+		}
+	}
+	if o.sm != nil {
+		if err := o.sm.write(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if o.nm != nil {
+		if err := o.nm.write(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,21 @@
+package main
+
+import "fmt"
+
+// Priorities applied by -background: the lowest best-effort I/O level and a
+// nice value leaving room for other background work below it
+const (
+	backgroundNice    = 10
+	backgroundIOLevel = 7
+)
+
+// backgroundPriority is the CPU and I/O priority applied to a background run
+type backgroundPriority struct {
+	Nice    int    `json:"nice"`
+	IOClass string `json:"io_class"`
+	IOLevel int    `json:"io_level"`
+}
+
+func (p backgroundPriority) String() string {
+	return fmt.Sprintf("nice %d, io %s/%d", p.Nice, p.IOClass, p.IOLevel)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// I/O scheduling classes and priorities from ioprio_set(2)
+const (
+	ioprioClassShift = 13
+	ioprioClassBE    = 2
+	ioprioWhoProcess = 1
+)
+
+// lowerPriority lowers the CPU and I/O priority of every thread of the
+// process. Both are per thread on Linux, so threads are set one by one;
+// threads created later inherit the priority of the thread creating them.
+func lowerPriority() (backgroundPriority, error) {
+	p := backgroundPriority{
+		Nice:    backgroundNice,
+		IOClass: "best-effort",
+		IOLevel: backgroundIOLevel,
+	}
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return p, fmt.Errorf("could not list threads: %w", err)
+	}
+	ioprio := ioprioClassBE<<ioprioClassShift | backgroundIOLevel
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+		err = syscall.Setpriority(syscall.PRIO_PROCESS, tid, backgroundNice)
+		if err != nil {
+			return p, fmt.Errorf("could not set CPU priority: %w", err)
+		}
+		_, _, errno := syscall.Syscall(
+			syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), uintptr(ioprio),
+		)
+		if errno != 0 {
+			return p, fmt.Errorf("could not set I/O priority: %w", errno)
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// lowerPriority is only implemented on Linux
+func lowerPriority() (backgroundPriority, error) {
+	return backgroundPriority{}, errors.New(
+		"-background is only supported on linux",
+	)
+}
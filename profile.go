@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+// stopProfiling completes the CPU profile and execution trace if they were
+// started, and writes the heap profile asked for by -memprofile. It is called
+// once the run is done, whether or not it failed, since exiting on a failure
+// skips deferred calls.
+func stopProfiling() {
+	pprof.StopCPUProfile()
+	trace.Stop()
+	if *memprofile != "" {
+		if err := writeHeapProfile(*memprofile); err != nil {
+			log.Print(err)
+		}
+	}
+}
+
+// writeHeapProfile writes a heap profile to a file, after a garbage
+// collection so that it reflects the live heap. The profile also samples
+// every allocation of the run, viewed with -sample_index=alloc_space.
+func writeHeapProfile(fpath string) error {
+	f, err := os.Create(fpath)
+	if err != nil {
+		return fmt.Errorf("could not create memory profile: %w", err)
+	}
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return fmt.Errorf("could not write memory profile: %w", err)
+	}
+	return f.Close()
+}
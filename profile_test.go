@@ -0,0 +1,22 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteHeapProfile(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "mem.prof")
+	require.NoError(t, writeHeapProfile(fpath))
+	profile, err := os.ReadFile(fpath)
+	require.NoError(t, err)
+	// Profiles are gzipped protocol buffers
+	assert.Equal(t, []byte{0x1f, 0x8b}, profile[:2])
+
+	missing := filepath.Join(t.TempDir(), "missing", "mem.prof")
+	assert.ErrorContains(t, writeHeapProfile(missing), "could not create")
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+)
+
+// Columns of the stats table that can be queried
+const (
+	colStation = "station"
+	colMin     = "min"
+	colMean    = "mean"
+	colMax     = "max"
+	colCount   = "count"
+)
+
+var queryColumns = []string{colStation, colMin, colMean, colMax, colCount}
+
+// query is a parsed SQL query over the stats table, supporting
+//
+//	SELECT <* | col, ...> FROM stats
+//	[WHERE col op literal [AND|OR col op literal ...]]
+//	[ORDER BY col [ASC|DESC], ...]
+//	[LIMIT n]
+//
+// where AND binds tighter than OR
+type query struct {
+	columns []string
+	where   [][]condition // OR of ANDs
+	orderBy []ordering
+	limit   int // negative if no limit
+}
+
+// condition compares a column against a literal
+type condition struct {
+	column string
+	op     string
+	str    string
+	num    float64
+}
+
+// ordering sorts rows by a column
+type ordering struct {
+	column string
+	desc   bool
+}
+
+// row is a single station in the stats table
+type row struct {
+	station string
+	min     float64
+	mean    float64
+	max     float64
+	count   float64
+}
+
+func (r row) num(column string) float64 {
+	switch column {
+	case colMin:
+		return r.min
+	case colMean:
+		return r.mean
+	case colMax:
+		return r.max
+	default:
+		return r.count
+	}
+}
+
+func (r row) text(column string, nf numberFormat) string {
+	switch column {
+	case colStation:
+		return r.station
+	case colCount:
+		return nf.count(r.count)
+	default:
+		return nf.format(r.num(column), 1)
+	}
+}
+
+// parseQuery parses a query, returning an error pointing at the offending
+// token if it is not supported
+func parseQuery(s string) (*query, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens}
+	q, err := p.parse()
+	if err != nil {
+		return nil, fmt.Errorf("invalid query: %w", err)
+	}
+	return q, nil
+}
+
+// tokenize splits a query into identifiers, keywords, literals and symbols
+func tokenize(s string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(s); {
+		ch := rune(s[i])
+		switch {
+		case unicode.IsSpace(ch):
+			i++
+		case ch == ',' || ch == '*':
+			tokens = append(tokens, s[i:i+1])
+			i++
+		case strings.ContainsRune("<>=!", ch):
+			j := i + 1
+			if j < len(s) && strings.ContainsRune("=>", rune(s[j])) {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		case ch == '\'':
+			j := strings.IndexByte(s[i+1:], '\'')
+			if j < 0 {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			tokens = append(tokens, s[i:i+j+2])
+			i += j + 2
+		default:
+			j := i
+			for j < len(s) && !unicode.IsSpace(rune(s[j])) &&
+				!strings.ContainsRune(",*<>=!'", rune(s[j])) {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+// queryParser is a recursive descent parser over query tokens
+type queryParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *queryParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *queryParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+// accept consumes the next token if it is the given keyword
+func (p *queryParser) accept(keyword string) bool {
+	if strings.EqualFold(p.peek(), keyword) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) expect(keyword string) error {
+	if !p.accept(keyword) {
+		return fmt.Errorf("expected %s, got %q", keyword, p.peek())
+	}
+	return nil
+}
+
+func (p *queryParser) column() (string, error) {
+	t := strings.ToLower(p.next())
+	for _, c := range queryColumns {
+		if t == c {
+			return c, nil
+		}
+	}
+	return "", fmt.Errorf(
+		"unknown column %q, expected one of %s",
+		t, strings.Join(queryColumns, ", "),
+	)
+}
+
+func (p *queryParser) parse() (*query, error) {
+	q := &query{limit: -1}
+	if err := p.expect("SELECT"); err != nil {
+		return nil, err
+	}
+	if p.accept("*") {
+		q.columns = queryColumns
+	} else {
+		for {
+			c, err := p.column()
+			if err != nil {
+				return nil, err
+			}
+			q.columns = append(q.columns, c)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if err := p.expect("FROM"); err != nil {
+		return nil, err
+	}
+	if err := p.expect("stats"); err != nil {
+		return nil, err
+	}
+	if p.accept("WHERE") {
+		and := []condition{}
+		for {
+			c, err := p.condition()
+			if err != nil {
+				return nil, err
+			}
+			and = append(and, c)
+			if p.accept("OR") {
+				q.where = append(q.where, and)
+				and = []condition{}
+			} else if !p.accept("AND") {
+				break
+			}
+		}
+		q.where = append(q.where, and)
+	}
+	if p.accept("ORDER") {
+		if err := p.expect("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			c, err := p.column()
+			if err != nil {
+				return nil, err
+			}
+			o := ordering{column: c}
+			if p.accept("DESC") {
+				o.desc = true
+			} else {
+				p.accept("ASC")
+			}
+			q.orderBy = append(q.orderBy, o)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if p.accept("LIMIT") {
+		t := p.next()
+		n, err := strconv.Atoi(t)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid limit %q", t)
+		}
+		q.limit = n
+	}
+	if p.peek() != "" {
+		return nil, fmt.Errorf("unexpected %q", p.peek())
+	}
+	return q, nil
+}
+
+func (p *queryParser) condition() (condition, error) {
+	c, err := p.column()
+	if err != nil {
+		return condition{}, err
+	}
+	cond := condition{column: c, op: p.next()}
+	switch cond.op {
+	case "=", "!=", "<>", "<", "<=", ">", ">=":
+	default:
+		return condition{}, fmt.Errorf("unknown operator %q", cond.op)
+	}
+	lit := p.next()
+	if c == colStation {
+		if len(lit) < 2 || lit[0] != '\'' {
+			return condition{}, fmt.Errorf("expected string, got %q", lit)
+		}
+		cond.str = lit[1 : len(lit)-1]
+		return cond, nil
+	}
+	cond.num, err = strconv.ParseFloat(lit, 64)
+	if err != nil {
+		return condition{}, fmt.Errorf("expected number, got %q", lit)
+	}
+	return cond, nil
+}
+
+// match reports whether a row satisfies the condition
+func (c condition) match(r row) bool {
+	var cmp int
+	if c.column == colStation {
+		cmp = strings.Compare(r.station, c.str)
+	} else {
+		v := r.num(c.column)
+		switch {
+		case v < c.num:
+			cmp = -1
+		case v > c.num:
+			cmp = 1
+		}
+	}
+	switch c.op {
+	case "=":
+		return cmp == 0
+	case "!=", "<>":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+// match reports whether a row satisfies the WHERE clause
+func (q *query) match(r row) bool {
+	if len(q.where) == 0 {
+		return true
+	}
+	for _, and := range q.where {
+		ok := true
+		for _, c := range and {
+			if !c.match(r) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// less orders two rows by the ORDER BY clause, falling back to station order
+func (q *query) less(a, b row) bool {
+	for _, o := range q.orderBy {
+		var cmp int
+		if o.column == colStation {
+			cmp = strings.Compare(a.station, b.station)
+		} else if a.num(o.column) < b.num(o.column) {
+			cmp = -1
+		} else if a.num(o.column) > b.num(o.column) {
+			cmp = 1
+		}
+		if o.desc {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp < 0
+		}
+	}
+	return a.station < b.station
+}
+
+// run executes the query over the station statistics and writes the
+// resulting rows as an aligned table
+func (q *query) run(ss *stationStats, w io.Writer) error {
+	rows := []row{}
+	for station, v := range ss.stats {
+		r := row{
+			station: station,
+			min:     degrees(v.Min),
+			mean:    compatMean(v),
+			max:     degrees(v.Max),
+			count:   float64(v.Count),
+		}
+		if q.match(r) {
+			rows = append(rows, r)
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return q.less(rows[i], rows[j]) })
+	if q.limit >= 0 && len(rows) > q.limit {
+		rows = rows[:q.limit]
+	}
+
+	nf := humanNumbers()
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.ToUpper(strings.Join(q.columns, "\t")))
+	for _, r := range rows {
+		for i, c := range q.columns {
+			if i > 0 {
+				io.WriteString(tw, "\t")
+			}
+			io.WriteString(tw, r.text(c, nf))
+		}
+		io.WriteString(tw, "\n")
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuery(t *testing.T) {
+	ss := &stationStats{
+		stats: map[string]*stat{
+			"Abha":    {Min: -10, Max: 415, Count: 2, Sum: 405},
+			"Bergen":  {Min: -50, Max: 200, Count: 3, Sum: 210},
+			"Cairo":   {Min: 100, Max: 450, Count: 1, Sum: 450},
+			"Dunedin": {Min: 10, Max: 300, Count: 4, Sum: 460},
+		},
+	}
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{
+			"SELECT station, mean FROM stats WHERE max > 40 " +
+				"ORDER BY mean DESC LIMIT 10",
+			"STATION  MEAN\nCairo    45.0\nAbha     20.3\n",
+		},
+		{
+			"select station from stats where station = 'Bergen' " +
+				"or count >= 4 and min >= 1",
+			"STATION\nBergen\nDunedin\n",
+		},
+		{
+			"SELECT * FROM stats ORDER BY count LIMIT 1",
+			"STATION  MIN   MEAN  MAX   COUNT\nCairo    10.0  45.0  45.0  1\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := parseQuery(tt.query)
+			require.NoError(t, err)
+			var actual strings.Builder
+			require.NoError(t, q.run(ss, &actual))
+			assert.Equal(t, tt.want, actual.String())
+		})
+	}
+}
+
+func TestQueryNumberFormat(t *testing.T) {
+	defer func(c bool, sep string) {
+		*outDecimalComma, *thousandsSep = c, sep
+	}(*outDecimalComma, *thousandsSep)
+	*outDecimalComma, *thousandsSep = true, "."
+	ss := &stationStats{
+		stats: map[string]*stat{
+			"Abha": {Min: -15, Max: 415, Count: 12345, Sum: 123450},
+		},
+	}
+	q, err := parseQuery("SELECT * FROM stats")
+	require.NoError(t, err)
+	var actual strings.Builder
+	require.NoError(t, q.run(ss, &actual))
+	assert.Equal(t,
+		"STATION  MIN   MEAN  MAX   COUNT\nAbha     -1,5  1,0   41,5  12.345\n",
+		actual.String(),
+	)
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"SELECT FROM stats",
+		"SELECT foo FROM stats",
+		"SELECT station FROM other",
+		"SELECT station FROM stats WHERE station > 1",
+		"SELECT station FROM stats WHERE max ~ 1",
+		"SELECT station FROM stats LIMIT -1",
+		"SELECT station FROM stats WHERE station = 'open",
+		"SELECT station FROM stats extra",
+	} {
+		_, err := parseQuery(s)
+		assert.Error(t, err, s)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/aeolyus/1brc/brc"
+)
+
+// processRanges has the brc engine split a file into as many ranges of whole
+// lines as there are readers and read each with ReadAt chunk by chunk, with a
+// worker per range aggregating every chunk as soon as it is read. Unlike
+// process, no single goroutine reads the whole input and no channel stands
+// between the reads and the workers.
+func processRanges(
+	ctx context.Context,
+	rs *runState,
+	stations int,
+	fpath string,
+	readers int,
+) (*stationStats, error) {
+	if rs == nil {
+		rs = &runState{}
+	}
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, fmt.Errorf("could not open file: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("could not stat file: %w", err)
+	}
+	size := info.Size()
+	counts := rs.counts()
+	var throttle *lockedBucket
+	if *maxReadMbps > 0 {
+		throttle = &lockedBucket{b: newTokenBucket(*maxReadMbps, chunkSize)}
+	}
+
+	c := startCollector(rs, stations)
+	opts := brc.Options{Workers: max(readers, 1), ChunkSize: chunkSize, Size: size}
+	err = brc.ReadRanges(f, opts, func() brc.Worker {
+		w := &rangeWorker{
+			chunkWorker: newChunkWorker(
+				c.statsChan, stations, rs.outputs, rs.dedupe, counts,
+				c.table,
+			),
+			ctx: ctx, fpath: fpath, throttle: throttle,
+		}
+		if counts.stages != nil {
+			w.reading = counts.stages.reader.clock()
+			w.parsing = counts.stages.parse.clock()
+		}
+		return w
+	})
+	result := c.result()
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		// A range was cut short, so the file shrank under the readers
+		if sizeErr := checkInputSize(fpath, size); sizeErr != nil {
+			err = sizeErr
+		}
+	}
+	if err == nil {
+		err = counts.check()
+	}
+	if err == nil {
+		err = checkInputSize(fpath, size)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// lockedBucket is a token bucket shared by the workers of the ranges
+type lockedBucket struct {
+	mu sync.Mutex
+	b  *tokenBucket
+}
+
+func (l *lockedBucket) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.b.wait(ctx, n)
+}
+
+// rangeWorker is the brc.Worker of a range: a chunkWorker fed the chunks the
+// engine reads, with reads throttled by -max-read-mbps and timed for -stats
+type rangeWorker struct {
+	*chunkWorker
+	ctx      context.Context
+	fpath    string
+	throttle *lockedBucket
+	// The reader and the worker take turns, so each waits while the other
+	// works
+	reading, parsing *stageClock
+	inRead           bool
+}
+
+func (w *rangeWorker) BeforeRead(n int) error {
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+	if !w.inRead {
+		// A line longer than the chunk is read again, as part of the
+		// same chunk
+		w.reading.working()
+		w.parsing.waiting()
+		w.inRead = true
+	}
+	if w.throttle != nil {
+		return w.throttle.wait(w.ctx, n)
+	}
+	return nil
+}
+
+func (w *rangeWorker) Chunk(chunk []byte, off int64) (err error) {
+	defer recoverWorker(&err)
+	w.reading.waiting()
+	w.parsing.working()
+	w.inRead = false
+	keep, err := w.counts.handOut(w.ctx, chunk)
+	if !keep || err != nil {
+		return err
+	}
+	w.receive(chunk)
+	w.aggregate(chunk, &chunkOrigin{w.fpath, off})
+	return nil
+}
+
+func (w *rangeWorker) Done() error {
+	w.parsing.waiting()
+	w.parsing.done()
+	w.reading.done()
+	w.done()
+	return nil
+}
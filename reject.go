@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// Reasons a line is rejected
+const (
+	rejectNoSeparator = "no-separator"
+	rejectBadValue    = "bad-value"
+	rejectNoStation   = "empty-station"
+	rejectDuplicate   = "duplicate"
+)
+
+// rejecter writes every line a run skips to a file, each as
+//
+//	reason	input:offset	line
+//
+// so that the raw line can be cut out again with cut -f3- once fixed. The
+// location is - where the offset of the line is not known.
+type rejecter struct {
+	mu  sync.Mutex
+	f   *os.File
+	w   *bufio.Writer
+	err error
+}
+
+// newRejecter creates the file rejected lines are written to
+func newRejecter(fpath string) (*rejecter, error) {
+	f, err := os.Create(fpath)
+	if err != nil {
+		return nil, fmt.Errorf("could not create reject file: %w", err)
+	}
+	return &rejecter{f: f, w: bufio.NewWriter(f)}, nil
+}
+
+// write appends lines that a worker rejected
+func (r *rejecter) write(lines []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err == nil {
+		_, r.err = r.w.Write(lines)
+	}
+}
+
+// close flushes and closes the reject file, returning the first error any
+// write ran into
+func (r *rejecter) close() error {
+	firstErr := r.err
+	if err := r.w.Flush(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	if err := r.f.Close(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+// appendRejectLine appends a rejected line, found at pos in a chunk from the
+// given origin, with its annotations
+func appendRejectLine(
+	buf []byte, reason string, origin *chunkOrigin, pos int, line []byte,
+) []byte {
+	buf = append(buf, reason...)
+	buf = append(buf, '\t')
+	if origin != nil && origin.offset >= 0 {
+		buf = append(buf, origin.input...)
+		buf = append(buf, ':')
+		buf = strconv.AppendInt(buf, origin.offset+int64(pos), 10)
+	} else {
+		buf = append(buf, '-')
+	}
+	buf = append(buf, '\t')
+	buf = append(buf, line...)
+	return append(buf, '\n')
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvalRejectOut(t *testing.T) {
+	defer func(s string, b bool) {
+		*rejectOut, *dedupeFlag = s, b
+	}(*rejectOut, *dedupeFlag)
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.txt")
+	require.NoError(t, os.WriteFile(input, []byte(
+		"Oslo;1.0\n"+
+			"no separator\n"+
+			"Abha;hot\n"+
+			"Oslo;1.0\n"+
+			"Abha;30.0\n",
+	), 0o644))
+
+	*rejectOut = filepath.Join(dir, "rejects.txt")
+	*dedupeFlag = true
+	var out strings.Builder
+	require.NoError(t, eval(context.Background(), input, &out))
+	assert.Equal(t, "{Abha=30.0/30.0/30.0, Oslo=1.0/1.0/1.0}\n", out.String())
+
+	rejects, err := os.ReadFile(*rejectOut)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		rejectNoSeparator + "\t" + input + ":9\tno separator",
+		rejectBadValue + "\t" + input + ":22\tAbha;hot",
+		rejectDuplicate + "\t" + input + ":31\tOslo;1.0",
+	}, strings.Split(strings.TrimSuffix(string(rejects), "\n"), "\n"))
+}
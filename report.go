@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// runReport is a manifest of everything needed to reproduce a run
+type runReport struct {
+	Strategy          string              `json:"strategy"`
+	ExpectedStations  int                 `json:"expected_stations"`
+	Flags             map[string]string   `json:"flags"`
+	CPUModel          string              `json:"cpu_model"`
+	NumCPU            int                 `json:"num_cpu"`
+	GOMAXPROCS        int                 `json:"gomaxprocs"`
+	GoVersion         string              `json:"go_version"`
+	Build             buildInfo           `json:"build"`
+	OS                string              `json:"os"`
+	Arch              string              `json:"arch"`
+	Input             string              `json:"input,omitempty"`
+	Inputs            []string            `json:"inputs,omitempty"`
+	InputSize         int64               `json:"input_size"`
+	InputSHA256       string              `json:"input_sha256,omitempty"`
+	Start             time.Time           `json:"start"`
+	Elapsed           float64             `json:"elapsed_seconds"`
+	GC                gcUsage             `json:"gc"`
+	Limits            resourceLimits      `json:"limits"`
+	Priority          *backgroundPriority `json:"priority,omitempty"`
+	ChunkSize         int                 `json:"chunk_size"`
+	Prefetch          int                 `json:"prefetch"`
+	Duplicates        int64               `json:"duplicates_removed,omitempty"`
+	MalformedLines    int64               `json:"malformed_lines"`
+	MalformedExamples []badLine           `json:"malformed_examples,omitempty"`
+	Stages            *stagesUsage        `json:"stages,omitempty"`
+}
+
+// report collects details about the current run if -report is given
+var report *runReport
+
+// newRunReport starts a report of a run over the given input files. A single
+// input is recorded as such, several as a list in the order given.
+func newRunReport(fpaths []string) *runReport {
+	flags := make(map[string]string)
+	flag.VisitAll(func(f *flag.Flag) {
+		flags[f.Name] = f.Value.String()
+	})
+	r := &runReport{
+		Flags:      flags,
+		CPUModel:   cpuModel(),
+		NumCPU:     runtime.NumCPU(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		GoVersion:  runtime.Version(),
+		Build:      readBuildInfo(),
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		Start:      time.Now(),
+	}
+	if len(fpaths) == 1 {
+		r.Input = fpaths[0]
+	} else {
+		r.Inputs = fpaths
+	}
+	return r
+}
+
+// finish completes the report once the run is done, recording the size of
+// the input and, with -report-digest, its digest. That reads the whole input
+// again, so it is only done when asked for. Several inputs are digested one
+// after the other in the order given.
+func (r *runReport) finish() error {
+	r.Elapsed = time.Since(r.Start).Seconds()
+	fpaths := r.Inputs
+	if r.Input != "" {
+		fpaths = []string{r.Input}
+	}
+	if !*reportDigest {
+		for _, fpath := range fpaths {
+			info, err := os.Stat(fpath)
+			if err != nil {
+				return fmt.Errorf("could not stat file: %w", err)
+			}
+			r.InputSize += info.Size()
+		}
+		return nil
+	}
+	h := sha256.New()
+	buf := make([]byte, chunkSize)
+	for _, fpath := range fpaths {
+		n, err := digestFile(h, fpath, buf)
+		if err != nil {
+			return err
+		}
+		r.InputSize += n
+	}
+	r.InputSHA256 = hex.EncodeToString(h.Sum(nil))
+	return nil
+}
+
+// digestFile writes a file to a hash, returning its size
+func digestFile(h io.Writer, fpath string, buf []byte) (int64, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return 0, fmt.Errorf("could not open file: %w", err)
+	}
+	defer f.Close()
+	n, err := io.CopyBuffer(h, f, buf)
+	if err != nil {
+		return 0, fmt.Errorf("could not digest input: %w", err)
+	}
+	return n, nil
+}
+
+// write writes the report as JSON to the given path
+func (r *runReport) write(fpath string) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode report: %w", err)
+	}
+	if err := os.WriteFile(fpath, append(b, '\n'), 0o644); err != nil {
+		return fmt.Errorf("could not write report: %w", err)
+	}
+	return nil
+}
+
+// cpuModel returns the CPU model name where it can be found
+func cpuModel() string {
+	f, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return runtime.GOARCH
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if ok && strings.TrimSpace(key) == "model name" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return runtime.GOARCH
+}
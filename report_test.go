@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportFinish(t *testing.T) {
+	defer func(d bool) { *reportDigest = d }(*reportDigest)
+	dir := t.TempDir()
+	inputs := []string{filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")}
+	require.NoError(t, os.WriteFile(inputs[0], []byte("Oslo;1.0\n"), 0o644))
+	require.NoError(t, os.WriteFile(inputs[1], []byte("Rome;2.0\n"), 0o644))
+
+	// The size is recorded without reading the inputs
+	*reportDigest = false
+	r := newRunReport(inputs)
+	require.NoError(t, r.finish())
+	assert.Equal(t, int64(18), r.InputSize)
+	assert.Empty(t, r.InputSHA256)
+
+	// The digest is that of the inputs one after the other
+	*reportDigest = true
+	r = newRunReport(inputs)
+	require.NoError(t, r.finish())
+	assert.Equal(t, int64(18), r.InputSize)
+	assert.Equal(
+		t,
+		"553a27add0d3d701556f435fa26a2753966ba9ee6068a4f373ffff4226f5d121",
+		r.InputSHA256,
+	)
+}
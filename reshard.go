@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/aeolyus/1brc/brc/fastparse"
+)
+
+// shardBufferSize is the write buffer size of each shard file
+const shardBufferSize = 1024 * 1024
+
+// reshard redistributes an input file into several output files partitioned
+// by station, so each output file holds every line of its stations
+func reshard(args []string) error {
+	fs := flag.NewFlagSet("reshard", flag.ExitOnError)
+	input := fs.String("input", "", "input file path")
+	shards := fs.Int("shards", 16, "number of output files")
+	outDir := fs.String("out", ".", "directory to write the shards to")
+	registerAliases(fs, map[string]string{"i": "input", "n": "shards", "o": "out"})
+	fs.Parse(args)
+	if *input == "" || *shards < 1 {
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+
+	f, err := os.Open(*input)
+	if err != nil {
+		return fmt.Errorf("could not open file: %w", err)
+	}
+	defer f.Close()
+
+	sw, err := newShardWriter(*outDir, "shard", *shards, nil)
+	if err != nil {
+		return err
+	}
+	if err := sw.partition(f); err != nil {
+		sw.close()
+		return err
+	}
+	return sw.close()
+}
+
+// shardWriter writes lines to one of several files depending on the station
+type shardWriter struct {
+	paths   []string
+	files   []*os.File
+	sealers []*sealWriter
+	writers []*bufio.Writer
+	// bad, if set, counts malformed lines, which are then left out instead
+	// of failing the partitioning
+	bad *badLines
+	// input is the name malformed lines are reported under
+	input string
+}
+
+// newShardWriter creates n shard files named <prefix>-NNNN.txt in a directory,
+// encrypted with the key if one is given
+func newShardWriter(
+	dir string, prefix string, n int, key []byte,
+) (*shardWriter, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("could not create shard directory: %w", err)
+	}
+	sw := &shardWriter{}
+	for i := 0; i < n; i++ {
+		fpath := filepath.Join(dir, fmt.Sprintf("%s-%04d.txt", prefix, i))
+		f, err := os.Create(fpath)
+		if err != nil {
+			sw.close()
+			return nil, fmt.Errorf("could not create shard file: %w", err)
+		}
+		sw.paths = append(sw.paths, fpath)
+		sw.files = append(sw.files, f)
+		var w io.Writer = f
+		var sealer *sealWriter
+		if key != nil {
+			if sealer, err = newSealWriter(f, key); err != nil {
+				sw.close()
+				return nil, fmt.Errorf("could not write shard: %w", err)
+			}
+			w = sealer
+		}
+		sw.sealers = append(sw.sealers, sealer)
+		sw.writers = append(sw.writers, bufio.NewWriterSize(w, shardBufferSize))
+	}
+	return sw, nil
+}
+
+// shardOf returns which of n shards a station belongs to
+func shardOf(station []byte, n int) int {
+	h := fnv.New32a()
+	h.Write(station)
+	return int(h.Sum32() % uint32(n))
+}
+
+// partition reads lines and writes each to the shard of its station
+func (sw *shardWriter) partition(r io.Reader) error {
+	br := bufio.NewReaderSize(r, chunkSize)
+	var offset int64
+	for {
+		line, err := br.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			return errors.New("line longer than the chunk size")
+		}
+		pos := offset
+		offset += int64(len(line))
+		if len(line) > 0 {
+			if line[len(line)-1] != '\n' {
+				line = append(line, '\n')
+			}
+			if err := sw.write(line, pos); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading file: %w", err)
+		}
+	}
+}
+
+// write writes a line found at offset pos to the shard of its station
+func (sw *shardWriter) write(line []byte, pos int64) error {
+	if sw.bad != nil && malformed(line) {
+		origin := chunkOrigin{input: sw.input, offset: pos}
+		sw.bad.add(&origin, 0, bytes.TrimSuffix(line, []byte{'\n'}))
+		return nil
+	}
+	i := bytes.IndexByte(line, ';')
+	if i < 0 {
+		return fmt.Errorf("malformed line %q", line)
+	}
+	w := sw.writers[shardOf(line[:i], len(sw.writers))]
+	if _, err := w.Write(line); err != nil {
+		return fmt.Errorf("could not write shard: %w", err)
+	}
+	return nil
+}
+
+// malformed reports whether the workers would skip a line as malformed
+func malformed(line []byte) bool {
+	station, value, _ := fastparse.ScanLine(line)
+	_, n := fastparse.ParseTempTenths(value)
+	return station == nil || n != len(value)
+}
+
+// close flushes and closes every shard file
+func (sw *shardWriter) close() error {
+	var firstErr error
+	for i, f := range sw.files {
+		if i < len(sw.writers) {
+			if err := sw.writers[i].Flush(); err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("could not write shard: %w", err)
+			}
+			if sw.sealers[i] != nil {
+				err := sw.sealers[i].Close()
+				if err != nil && firstErr == nil {
+					firstErr = fmt.Errorf("could not write shard: %w", err)
+				}
+			}
+		}
+		if err := f.Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("could not close shard: %w", err)
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardWriter(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(sampleInputDir, "measurements-10000-unique-keys.txt")
+	f, err := os.Open(input)
+	require.NoError(t, err)
+	defer f.Close()
+
+	sw, err := newShardWriter(dir, "shard", 3, nil)
+	require.NoError(t, err)
+	require.NoError(t, sw.partition(f))
+	require.NoError(t, sw.close())
+
+	content, err := readFile(input)
+	require.NoError(t, err)
+	expected := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+
+	actual := []string{}
+	shardOfStation := map[string]string{}
+	for _, fpath := range sw.paths {
+		shard, err := readFile(fpath)
+		require.NoError(t, err)
+		for _, line := range strings.Split(strings.TrimSuffix(shard, "\n"), "\n") {
+			station, _, _ := strings.Cut(line, ";")
+			if prev, ok := shardOfStation[station]; ok {
+				assert.Equal(t, prev, fpath, "station %q split", station)
+			}
+			shardOfStation[station] = fpath
+			actual = append(actual, line)
+		}
+	}
+	sort.Strings(expected)
+	sort.Strings(actual)
+	assert.Equal(t, expected, actual)
+}
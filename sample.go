@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"slices"
+	"sync"
+)
+
+// sampler keeps a uniform random sample of the raw lines of a run, malformed
+// ones included, and writes it once the run is done. Each worker samples the
+// lines it sees into a reservoir of its own, and the reservoirs are merged in
+// proportion to the lines each saw.
+type sampler struct {
+	mu         sync.Mutex
+	fpath      string
+	size       int
+	workers    int64
+	reservoirs []*reservoir
+}
+
+// reservoir is a uniform random sample of the lines seen by one worker
+type reservoir struct {
+	rng   *rand.Rand
+	lines [][]byte
+	seen  int64
+	size  int
+}
+
+// newSampler starts a sample of size lines to be written to fpath
+func newSampler(fpath string, size int) *sampler {
+	return &sampler{fpath: fpath, size: size}
+}
+
+// newReservoir returns a reservoir for a worker. Workers draw from -seed in
+// the order they start, so a sample is only reproducible with -jobs 1.
+func (s *sampler) newReservoir() *reservoir {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.workers++
+	return &reservoir{
+		rng:  rand.New(rand.NewSource(*seed + s.workers)),
+		size: s.size,
+	}
+}
+
+// add offers a line to the reservoir, copying it if it is kept
+func (r *reservoir) add(line []byte) {
+	r.seen++
+	if len(r.lines) < r.size {
+		r.lines = append(r.lines, bytes.Clone(line))
+		return
+	}
+	if i := r.rng.Int63n(r.seen); i < int64(r.size) {
+		r.lines[i] = append(r.lines[i][:0], line...)
+	}
+}
+
+// done hands a worker's reservoir over to be merged
+func (s *sampler) done(r *reservoir) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reservoirs = append(s.reservoirs, r)
+}
+
+// sample merges the reservoirs into a single sample of the lines they saw.
+// Each line drawn comes from a reservoir chosen in proportion to the lines it
+// stands for that are still undrawn, which keeps every line of the input
+// equally likely to be in the sample.
+func (s *sampler) sample() [][]byte {
+	rng := rand.New(rand.NewSource(*seed))
+	var undrawn int64
+	pools := make([]*reservoir, len(s.reservoirs))
+	for i, r := range s.reservoirs {
+		pools[i] = &reservoir{lines: slices.Clone(r.lines), seen: r.seen}
+		undrawn += r.seen
+	}
+	var lines [][]byte
+	for len(lines) < s.size && undrawn > 0 {
+		n := rng.Int63n(undrawn)
+		for _, p := range pools {
+			if n >= p.seen {
+				n -= p.seen
+				continue
+			}
+			i := rng.Intn(len(p.lines))
+			lines = append(lines, p.lines[i])
+			p.lines[i] = p.lines[len(p.lines)-1]
+			p.lines = p.lines[:len(p.lines)-1]
+			p.seen--
+			undrawn--
+			break
+		}
+	}
+	return lines
+}
+
+// write writes the sample to its file, one line each
+func (s *sampler) write() error {
+	f, err := os.Create(s.fpath)
+	if err != nil {
+		return fmt.Errorf("could not create sample file: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	for _, line := range s.sample() {
+		w.Write(line)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("could not write sample file: %w", err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvalSampleOut(t *testing.T) {
+	defer func(s string, n int) {
+		*sampleOut, *sampleLines = s, n
+	}(*sampleOut, *sampleLines)
+	input := filepath.Join(sampleInputDir, "measurements-10000-unique-keys")
+	data, err := os.ReadFile(input + sampleInputExt)
+	require.NoError(t, err)
+	expected, err := readFile(input + sampleOutputExt)
+	require.NoError(t, err)
+	lines := make(map[string]bool)
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		lines[line] = true
+	}
+
+	*sampleOut = filepath.Join(t.TempDir(), "sample.txt")
+	*sampleLines = 100
+	var out strings.Builder
+	require.NoError(t, eval(context.Background(), input+sampleInputExt, &out))
+	assert.Equal(t, expected, out.String())
+	sample, err := os.ReadFile(*sampleOut)
+	require.NoError(t, err)
+	sampled := strings.Split(strings.TrimSuffix(string(sample), "\n"), "\n")
+	assert.Len(t, sampled, 100)
+	for _, line := range sampled {
+		assert.True(t, lines[line], "%q is not a line of the input", line)
+	}
+}
+
+func TestSamplerUniform(t *testing.T) {
+	defer func(n int64) { *seed = n }(*seed)
+	// One worker sees three times as many lines as the other, so it should
+	// supply about three quarters of the merged sample
+	s := newSampler("", 100)
+	a, b := s.newReservoir(), s.newReservoir()
+	for i := 0; i < 30_000; i++ {
+		a.add([]byte("a" + strconv.Itoa(i)))
+	}
+	for i := 0; i < 10_000; i++ {
+		b.add([]byte("b" + strconv.Itoa(i)))
+	}
+	s.done(a)
+	s.done(b)
+	fromA := 0
+	for i := range 100 {
+		*seed = int64(i) + 1
+		sample := s.sample()
+		require.Len(t, sample, 100)
+		for _, line := range sample {
+			if bytes.HasPrefix(line, []byte("a")) {
+				fromA++
+			}
+		}
+	}
+	assert.InDelta(t, 7500, fromA, 300)
+
+	// A sample larger than the input holds all of it
+	s = newSampler("", 10)
+	r := s.newReservoir()
+	r.add([]byte("only"))
+	s.done(r)
+	assert.Equal(t, [][]byte{[]byte("only")}, s.sample())
+}
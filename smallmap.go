@@ -0,0 +1,88 @@
+package main
+
+import "encoding/binary"
+
+// smallMapMaxStations is the largest cardinality for which the small map is
+// used; beyond it the direct-mapped table would be too sparse to pay off
+const smallMapMaxStations = 4096
+
+// smallMapDefaultStations is the cardinality assumed when no hint is given,
+// sized for the classic 413 station dataset
+const smallMapDefaultStations = 512
+
+// smallMapMaxOverflow is the number of stations a worker may overflow out of
+// the small map before it concludes the input is not low cardinality and
+// stops using it
+const smallMapMaxOverflow = 64
+
+// smallMapMaxProbe bounds the linear probing done on a slot collision before
+// the station is handed off to the overflow map
+const smallMapMaxProbe = 8
+
+// smallMap is a direct-mapped table for low cardinality inputs. Slots are
+// indexed by folding the first bytes and length of the station name together,
+// which is much cheaper than hashing the full name. Stations that cannot be
+// placed within a few probes are reported back to the caller.
+type smallMap struct {
+	keys  []string
+	stats []stat
+	used  []bool
+	mask  uint64
+}
+
+func newSmallMap(stations int) *smallMap {
+	size := 1
+	for size < stations*4 {
+		size <<= 1
+	}
+	return &smallMap{
+		keys:  make([]string, size),
+		stats: make([]stat, size),
+		used:  make([]bool, size),
+		mask:  uint64(size - 1),
+	}
+}
+
+// slot returns the starting slot of a station from its short-name encoding
+func (m *smallMap) slot(station []byte) uint64 {
+	var buf [8]byte
+	copy(buf[:], station)
+	w := binary.LittleEndian.Uint64(buf[:])
+	return (w ^ w>>13 ^ w>>29 ^ w>>43 ^ uint64(len(station))<<5) & m.mask
+}
+
+// add records a temperature in tenths for a station, returning false if the
+// station could not be placed in the table
+func (m *smallMap) add(station []byte, tenths int64) bool {
+	i := m.slot(station)
+	for probe := 0; probe < smallMapMaxProbe; probe++ {
+		if !m.used[i] {
+			m.used[i] = true
+			m.keys[i] = string(station)
+			m.stats[i].Add(tenths)
+			return true
+		}
+		if m.keys[i] == string(station) {
+			m.stats[i].Add(tenths)
+			return true
+		}
+		i = (i + 1) & m.mask
+	}
+	return false
+}
+
+// mergeInto moves the contents of the table into the byte map it overflows to
+func (m *smallMap) mergeInto(stats *byteMap) {
+	for i, ok := range m.used {
+		if ok {
+			stats.merge([]byte(m.keys[i]), m.stats[i])
+		}
+	}
+}
+
+// reset empties the table for reuse
+func (m *smallMap) reset() {
+	clear(m.keys)
+	clear(m.stats)
+	clear(m.used)
+}
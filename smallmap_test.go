@@ -0,0 +1,73 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// randomStation returns a station name of n bytes, without the separator or
+// new lines
+func randomStation(rng *rand.Rand, n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(rng.Intn(256))
+		for b[i] == ';' || b[i] == '\n' {
+			b[i] = byte(rng.Intn(256))
+		}
+	}
+	return b
+}
+
+// addStat is the plain aggregation the small map stands in for
+func addStat(stats map[string]*stat, station []byte, tenths int64) {
+	if val, ok := stats[string(station)]; ok {
+		val.Count++
+		val.Sum += tenths
+		val.Min = min(val.Min, tenths)
+		val.Max = max(val.Max, tenths)
+	} else {
+		stats[string(station)] = &stat{
+			Count: 1, Min: tenths, Max: tenths, Sum: tenths,
+		}
+	}
+}
+
+// TestSmallMapDifferential checks the small map, along with the byte map the
+// workers overflow to, against a plain map, for names of every length
+// and names folding to the same slot
+func TestSmallMapDifferential(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var stations [][]byte
+	for n := 1; n <= 100; n++ {
+		stations = append(stations, randomStation(rng, n))
+	}
+	// Names only differing past their first 8 bytes, with the same length,
+	// all start at the same slot and exhaust the probes
+	prefix := randomStation(rng, 8)
+	for range 2 * smallMapMaxProbe {
+		stations = append(stations, append(prefix[:8:8], randomStation(rng, 4)...))
+	}
+
+	for _, size := range []int{1, 64, smallMapDefaultStations} {
+		small := newSmallMap(size)
+		overflow := newByteMap(0)
+		want := map[string]*stat{}
+		for range 100_000 {
+			station := stations[rng.Intn(len(stations))]
+			tenths := int64(rng.Intn(1999) - 999)
+			addStat(want, station, tenths)
+			if !small.add(station, tenths) {
+				overflow.add(station, tenths)
+			}
+		}
+		// Some of the colliding names must have overflowed to be tested
+		assert.NotZero(t, overflow.len(), size)
+		small.mergeInto(overflow)
+		assert.Equal(t, want, overflow.toMap(), size)
+
+		small.reset()
+		assert.Equal(t, newSmallMap(size), small, size)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// soakMaxRSSGrowth is how much the resident set may grow past the one after
+// the first run before a soak run is considered leaking
+const soakMaxRSSGrowth = 64 * 1024 * 1024 // 64 MiB
+
+// soak evaluates the input n times in-process, checking that every run gives
+// the same results, that no goroutines are left behind and that the resident
+// set stays bounded, before writing the results once
+func soak(ctx context.Context, fpaths []string, n int, w io.Writer) error {
+	baseGoroutines := runtime.NumGoroutine()
+	var first bytes.Buffer
+	var baseRSS int64
+	for i := 1; i <= n; i++ {
+		start := time.Now()
+		var out bytes.Buffer
+		if err := evalFiles(ctx, fpaths, &out); err != nil {
+			return fmt.Errorf("soak run %d: %w", i, err)
+		}
+		elapsed := time.Since(start)
+		goroutines := settledGoroutines(baseGoroutines)
+		// Return freed memory to the OS, so that the resident set only
+		// counts what the runs still hold on to
+		debug.FreeOSMemory()
+		rss := residentSetSize()
+		log.Printf(
+			"soak run %d/%d: %.3f s, rss %d MiB, %d goroutines",
+			i, n, elapsed.Seconds(), rss/(1024*1024), goroutines,
+		)
+
+		if i == 1 {
+			first = out
+			baseRSS = rss
+		} else if !bytes.Equal(out.Bytes(), first.Bytes()) {
+			return fmt.Errorf("soak run %d: results differ from the first run", i)
+		}
+		if goroutines > baseGoroutines {
+			return fmt.Errorf(
+				"soak run %d: %d goroutines left behind",
+				i, goroutines-baseGoroutines,
+			)
+		}
+		if rss > baseRSS+soakMaxRSSGrowth {
+			return fmt.Errorf(
+				"soak run %d: resident set grew from %d to %d bytes",
+				i, baseRSS, rss,
+			)
+		}
+	}
+	_, err := w.Write(first.Bytes())
+	return err
+}
+
+// settledGoroutines returns the number of goroutines once they are back down
+// to the base count, or after a grace period for goroutines of the last run
+// to finish exiting
+func settledGoroutines(base int) int {
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > base && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	return runtime.NumGoroutine()
+}
+
+// residentSetSize returns the resident set size of the process in bytes,
+// falling back to the memory obtained from the OS by the Go runtime where it
+// cannot be read
+func residentSetSize() int64 {
+	if b, err := os.ReadFile("/proc/self/statm"); err == nil {
+		fields := strings.Fields(string(b))
+		if len(fields) > 1 {
+			pages, err := strconv.ParseInt(fields[1], 10, 64)
+			if err == nil {
+				return pages * int64(os.Getpagesize())
+			}
+		}
+	}
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return int64(m.Sys - m.HeapReleased)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aeolyus/1brc/brc"
+)
+
+// byStation is the order of the spec output
+var byStation = []ordering{{column: colStation}}
+
+// parseSortBy parses a -sort-by list of columns, each optionally followed by
+// :asc or :desc, e.g. mean:desc,station
+func parseSortBy(s string) ([]ordering, error) {
+	var order []ordering
+	for _, key := range strings.Split(s, ",") {
+		column, dir, _ := strings.Cut(strings.TrimSpace(key), ":")
+		if !slices.Contains(queryColumns, column) {
+			return nil, fmt.Errorf(
+				"unknown sort column %q, expected one of %s",
+				column, strings.Join(queryColumns, ", "),
+			)
+		}
+		o := ordering{column: column}
+		switch dir {
+		case "", "asc":
+		case "desc":
+			o.desc = true
+		default:
+			return nil, fmt.Errorf(
+				"unknown sort direction %q of %s, expected asc or desc",
+				dir, column,
+			)
+		}
+		order = append(order, o)
+	}
+	return order, nil
+}
+
+// outputOrder returns the order of the output given by the flags, or nil if
+// it is not to be sorted
+func outputOrder() []ordering {
+	if *noSort {
+		return nil
+	}
+	// The flag is checked by validateFlags
+	order, _ := parseSortBy(*sortBy)
+	return order
+}
+
+// compareResults compares results by the given orderings in turn, and then
+// by station
+func compareResults(a, b brc.Result, order []ordering) int {
+	for _, o := range order {
+		var c int
+		switch o.column {
+		case colStation:
+			c = compareStations(a.Station, b.Station)
+		case colMin:
+			c = cmp.Compare(a.Min, b.Min)
+		case colMean:
+			c = cmp.Compare(a.Mean, b.Mean)
+		case colMax:
+			c = cmp.Compare(a.Max, b.Max)
+		case colCount:
+			c = cmp.Compare(a.Count, b.Count)
+		}
+		if o.desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return compareStations(a.Station, b.Station)
+}
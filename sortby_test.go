@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSortBy(t *testing.T) {
+	order, err := parseSortBy("mean:desc, count,station:asc")
+	require.NoError(t, err)
+	assert.Equal(t, []ordering{
+		{column: colMean, desc: true},
+		{column: colCount},
+		{column: colStation},
+	}, order)
+
+	_, err = parseSortBy("median")
+	assert.ErrorContains(t, err, `unknown sort column "median"`)
+	_, err = parseSortBy("mean:up")
+	assert.ErrorContains(t, err, `unknown sort direction "up"`)
+}
+
+func TestEvalSortBy(t *testing.T) {
+	defer func(s string) { *sortBy = s }(*sortBy)
+	input := filepath.Join(t.TempDir(), "input.txt")
+	require.NoError(t, os.WriteFile(input, []byte(
+		"Oslo;-3.0\nAbha;30.1\nOslo;1.0\nCairo;20.0\nBergen;20.0\nBergen;20.0\n",
+	), 0o644))
+	for sort, expected := range map[string]string{
+		"station": "{Abha=30.1/30.1/30.1, Bergen=20.0/20.0/20.0, " +
+			"Cairo=20.0/20.0/20.0, Oslo=-3.0/-1.0/1.0}\n",
+		"mean:desc": "{Abha=30.1/30.1/30.1, Bergen=20.0/20.0/20.0, " +
+			"Cairo=20.0/20.0/20.0, Oslo=-3.0/-1.0/1.0}\n",
+		"count:desc,mean": "{Oslo=-3.0/-1.0/1.0, Bergen=20.0/20.0/20.0, " +
+			"Cairo=20.0/20.0/20.0, Abha=30.1/30.1/30.1}\n",
+	} {
+		*sortBy = sort
+		var out strings.Builder
+		require.NoError(t, eval(context.Background(), input, &out))
+		assert.Equal(t, expected, out.String(), sort)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// evalSpilled evaluates an input whose distinct stations may not fit in
+// memory. The input is first partitioned by station into files in the spill
+// directory, each partition is then aggregated on its own and its sorted
+// results written back to disk, and finally the sorted results of every
+// partition are merged into the output.
+func evalSpilled(
+	ctx context.Context,
+	fpath string,
+	dir string,
+	partitions int,
+	w io.Writer,
+) error {
+	tmp, err := os.MkdirTemp(dir, "1brc-spill-")
+	if err != nil {
+		return fmt.Errorf("could not create spill directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	f, err := os.Open(fpath)
+	if err != nil {
+		return fmt.Errorf("could not open file: %w", err)
+	}
+	defer f.Close()
+	var src io.Reader = f
+	dec, err := detectDecoder(fpath)
+	if err != nil {
+		return err
+	}
+	if dec != nil {
+		r, err := dec.newReader(bufio.NewReader(f))
+		if err != nil {
+			return fmt.Errorf("could not decompress %s: %w", dec.name(), err)
+		}
+		defer r.Close()
+		src = r
+	}
+	sw, err := newShardWriter(tmp, "part", partitions, atRestKey)
+	if err != nil {
+		return err
+	}
+	// Malformed lines are left out as the workers skip them, and counted
+	// for -report
+	bad := newBadLines(*badLineExamples)
+	sw.bad, sw.input = bad, fpath
+	if err := sw.partition(src); err != nil {
+		sw.close()
+		return err
+	}
+	if err := sw.close(); err != nil {
+		return err
+	}
+	if report != nil {
+		report.MalformedLines = bad.count.Load()
+		report.MalformedExamples = bad.sorted()
+	}
+
+	results := make([]string, len(sw.paths))
+	for i, part := range sw.paths {
+		results[i] = part + ".out"
+		if err := aggregatePartition(ctx, part, results[i]); err != nil {
+			return err
+		}
+		os.Remove(part)
+	}
+	return mergePartitions(results, w)
+}
+
+// aggregatePartition aggregates a partition file and writes its results as
+// sorted station;min/mean/max lines. With an at rest key, both files are
+// encrypted.
+func aggregatePartition(ctx context.Context, part string, out string) error {
+	var ss *stationStats
+	var err error
+	if atRestKey != nil {
+		ss, err = readSealedStats(ctx, part)
+	} else {
+		ss, err = readStats(ctx, part, nil)
+	}
+	if err != nil {
+		return fmt.Errorf("error parsing statistics: %w", err)
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return fmt.Errorf("could not create spill file: %w", err)
+	}
+	defer f.Close()
+	var w io.Writer = f
+	var sealer *sealWriter
+	if atRestKey != nil {
+		if sealer, err = newSealWriter(f, atRestKey); err != nil {
+			return fmt.Errorf("could not write spill file: %w", err)
+		}
+		w = sealer
+	}
+	bw := bufio.NewWriter(w)
+	for _, r := range results(ss, byStation) {
+		text, _ := r.Stat.MarshalText()
+		bw.WriteString(r.Station + ";" + string(text) + "\n")
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("could not write spill file: %w", err)
+	}
+	if sealer != nil {
+		if err := sealer.Close(); err != nil {
+			return fmt.Errorf("could not write spill file: %w", err)
+		}
+	}
+	return nil
+}
+
+// readSealedStats reads an encrypted partition file and returns a map of
+// station statistics
+func readSealedStats(ctx context.Context, part string) (*stationStats, error) {
+	f, err := os.Open(part)
+	if err != nil {
+		return nil, fmt.Errorf("could not open file: %w", err)
+	}
+	defer f.Close()
+	src, err := newUnsealReader(bufio.NewReader(f), atRestKey)
+	if err != nil {
+		return nil, err
+	}
+	return process(ctx, nil, *expectStations, func(
+		ctx context.Context, chunkChan chan<- []byte, counts *chunkCounts,
+	) error {
+		defer close(chunkChan)
+		leftOver, _, err := readLines(
+			ctx, src, part, chunkChan, counts, nil,
+		)
+		if err != nil || len(leftOver) == 0 {
+			return err
+		}
+		return counts.send(ctx, chunkChan, leftOver)
+	})
+}
+
+// partitionResult is the next unmerged line of a partition's results
+type partitionResult struct {
+	station   string
+	formatted string
+	scanner   *bufio.Scanner
+}
+
+// resultHeap orders partition results by station
+type resultHeap []*partitionResult
+
+func (h resultHeap) Len() int { return len(h) }
+func (h resultHeap) Less(i, j int) bool {
+	return compareStations(h[i].station, h[j].station) < 0
+}
+func (h resultHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *resultHeap) Push(x any)   { *h = append(*h, x.(*partitionResult)) }
+func (h *resultHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// next advances a partition result to its next line, returning false once
+// the partition is exhausted
+func (r *partitionResult) next() bool {
+	if !r.scanner.Scan() {
+		return false
+	}
+	r.station, r.formatted, _ = strings.Cut(r.scanner.Text(), ";")
+	return true
+}
+
+// mergePartitions merges the sorted results of every partition into the
+// standard output format. Stations never appear in more than one partition.
+func mergePartitions(results []string, w io.Writer) error {
+	h := &resultHeap{}
+	for _, fpath := range results {
+		f, err := os.Open(fpath)
+		if err != nil {
+			return fmt.Errorf("could not open spill file: %w", err)
+		}
+		defer f.Close()
+		var src io.Reader = f
+		if atRestKey != nil {
+			if src, err = newUnsealReader(bufio.NewReader(f), atRestKey); err != nil {
+				return fmt.Errorf("could not read spill file: %w", err)
+			}
+		}
+		r := &partitionResult{scanner: bufio.NewScanner(src)}
+		if r.next() {
+			heap.Push(h, r)
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString("{")
+	for first := true; h.Len() > 0; first = false {
+		r := (*h)[0]
+		if !first {
+			bw.WriteString(", ")
+		}
+		bw.WriteString(r.station + "=" + r.formatted)
+		if r.next() {
+			heap.Fix(h, 0)
+		} else if err := r.scanner.Err(); err != nil {
+			return fmt.Errorf("could not read spill file: %w", err)
+		} else {
+			heap.Pop(h)
+		}
+	}
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
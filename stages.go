@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// stageMetrics accounts for the goroutines of one stage of the pipeline: the
+// items they handled, the time they spent waiting on their queue, and the
+// time they spent working
+type stageMetrics struct {
+	items atomic.Int64
+	wait  atomic.Int64
+	busy  atomic.Int64
+}
+
+// pipelineStages are the metrics of every stage of the pipeline over a run,
+// along with how full the queue of chunks between the reader and the workers
+// was each time a chunk was handed out
+type pipelineStages struct {
+	reader, parse, aggregate stageMetrics
+	depthSum, depthSamples   atomic.Int64
+	depthMax                 atomic.Int64
+	capacity                 int
+}
+
+// stageClock times a single goroutine of a stage. Its methods do nothing on a
+// nil clock, so that stages are only timed when metrics are collected.
+type stageClock struct {
+	m    *stageMetrics
+	mark time.Time
+}
+
+// clock starts timing a goroutine of the stage, or returns nil if m is nil
+func (m *stageMetrics) clock() *stageClock {
+	if m == nil {
+		return nil
+	}
+	return &stageClock{m: m, mark: time.Now()}
+}
+
+// waiting marks the goroutine as done working, and waiting on its queue
+func (c *stageClock) waiting() {
+	if c == nil {
+		return
+	}
+	now := time.Now()
+	c.m.busy.Add(int64(now.Sub(c.mark)))
+	c.mark = now
+}
+
+// working marks the goroutine as done waiting, and working on a new item
+func (c *stageClock) working() {
+	if c == nil {
+		return
+	}
+	now := time.Now()
+	c.m.wait.Add(int64(now.Sub(c.mark)))
+	c.m.items.Add(1)
+	c.mark = now
+}
+
+// done marks the goroutine as done, its queue closed after it waited on it
+func (c *stageClock) done() {
+	if c == nil {
+		return
+	}
+	c.m.wait.Add(int64(time.Since(c.mark)))
+}
+
+// sampleDepth records how many chunks are queued as another is handed out
+func (s *pipelineStages) sampleDepth(depth int) {
+	s.depthSum.Add(int64(depth))
+	s.depthSamples.Add(1)
+	for {
+		m := s.depthMax.Load()
+		if int64(depth) <= m || s.depthMax.CompareAndSwap(m, int64(depth)) {
+			return
+		}
+	}
+}
+
+// stageUsage is the summary of a stage in -report
+type stageUsage struct {
+	Items       int64   `json:"items"`
+	WaitSeconds float64 `json:"wait_seconds"`
+	BusySeconds float64 `json:"busy_seconds"`
+}
+
+// stagesUsage is the summary of the pipeline stages in -report
+type stagesUsage struct {
+	Reader    stageUsage `json:"reader"`
+	Parse     stageUsage `json:"parse"`
+	Aggregate stageUsage `json:"aggregate"`
+	// QueueMean and QueueMax are how many chunks were queued for the
+	// workers as each was handed out, out of QueueCapacity
+	QueueMean     float64 `json:"queue_mean"`
+	QueueMax      int64   `json:"queue_max"`
+	QueueCapacity int     `json:"queue_capacity"`
+}
+
+func (m *stageMetrics) usage() stageUsage {
+	return stageUsage{
+		Items:       m.items.Load(),
+		WaitSeconds: time.Duration(m.wait.Load()).Seconds(),
+		BusySeconds: time.Duration(m.busy.Load()).Seconds(),
+	}
+}
+
+// usage summarizes the metrics of the pipeline stages
+func (s *pipelineStages) usage() stagesUsage {
+	u := stagesUsage{
+		Reader:        s.reader.usage(),
+		Parse:         s.parse.usage(),
+		Aggregate:     s.aggregate.usage(),
+		QueueMax:      s.depthMax.Load(),
+		QueueCapacity: s.capacity,
+	}
+	if n := s.depthSamples.Load(); n > 0 {
+		u.QueueMean = float64(s.depthSum.Load()) / float64(n)
+	}
+	return u
+}
+
+// write prints the metrics of the pipeline stages in a human readable form.
+// Times are summed over the goroutines of a stage, so the stage whose
+// goroutines spend the least time waiting is the bottleneck.
+func (u stagesUsage) write(w io.Writer) {
+	fmt.Fprintf(w, "%-9s %10s %10s %10s\n", "stage", "items", "wait", "busy")
+	for _, s := range []struct {
+		name string
+		u    stageUsage
+	}{
+		{"reader", u.Reader}, {"parse", u.Parse}, {"aggregate", u.Aggregate},
+	} {
+		fmt.Fprintf(
+			w, "%-9s %10d %9.3fs %9.3fs\n",
+			s.name, s.u.Items, s.u.WaitSeconds, s.u.BusySeconds,
+		)
+	}
+	fmt.Fprintf(
+		w, "queue: %.1f chunks on average, at most %d, of %d\n",
+		u.QueueMean, u.QueueMax, u.QueueCapacity,
+	)
+}
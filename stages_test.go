@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvalStages(t *testing.T) {
+	defer func(s string, n int, r *runReport) {
+		*strategy, chunkSize, report = s, n, r
+	}(*strategy, chunkSize, report)
+	chunkSize = 4096
+	input := filepath.Join(sampleInputDir, "measurements-10000-unique-keys")
+	for _, s := range []string{strategyStream, strategyMmap, strategyReadAt} {
+		t.Run(s, func(t *testing.T) {
+			*strategy = s
+			report = &runReport{}
+			var out strings.Builder
+			require.NoError(t, eval(
+				context.Background(), input+sampleInputExt, &out,
+			))
+			require.NotNil(t, report.Stages)
+			u := *report.Stages
+			// Every chunk handed out is parsed, and every worker hands
+			// its stats to the aggregator at least once
+			assert.Greater(t, u.Reader.Items, int64(10))
+			assert.Equal(t, u.Reader.Items, u.Parse.Items)
+			assert.NotZero(t, u.Aggregate.Items)
+			assert.Positive(t, u.Parse.BusySeconds)
+			assert.LessOrEqual(t, float64(u.QueueMax), float64(u.QueueCapacity))
+			assert.LessOrEqual(t, u.QueueMean, float64(u.QueueMax))
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dayLayout is the format of the days the persisted aggregates are bucketed
+// by. Days in this format sort chronologically as strings.
+const dayLayout = "2006-01-02"
+
+// now returns the current time, and may be replaced by tests
+var now = time.Now
+
+// persistedState is the gob form state files had before the state format.
+// Each run adds its input to the bucket of the day it ran on.
+type persistedState struct {
+	// Stats holds the undated aggregates of states written before they
+	// were bucketed by day
+	Stats map[string]persistedStat
+	Days  map[string]map[string]persistedStat
+}
+
+type persistedStat struct {
+	Min, Max, Sum, Count float64
+}
+
+// retention is a flag for how long persisted aggregates are kept. On top of
+// the units of time.ParseDuration it accepts days, e.g. 30d.
+type retention time.Duration
+
+func (r *retention) String() string {
+	d := time.Duration(*r)
+	if d > 0 && d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+	return d.String()
+}
+
+func (r *retention) Set(s string) error {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return fmt.Errorf("invalid number of days %q", days)
+		}
+		*r = retention(time.Duration(n) * 24 * time.Hour)
+		return nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*r = retention(d)
+	return nil
+}
+
+// applyState adds the stats of this run to the state at path, ages out the
+// days older than the retention if one is given and returns the aggregates
+// over all days kept
+func applyState(
+	path string, ss *stationStats, retain time.Duration,
+) (*stationStats, error) {
+	days, err := loadState(path)
+	if err != nil {
+		return nil, err
+	}
+	today := now().Format(dayLayout)
+	if days[today] == nil {
+		days[today] = make(map[string]*stat, len(ss.stats))
+	}
+	mergeStats(days[today], ss.stats)
+	if retain > 0 {
+		cutoff := now().Add(-retain).Format(dayLayout)
+		for day := range days {
+			// Undated aggregates cannot be aged out
+			if day != "" && day <= cutoff {
+				delete(days, day)
+			}
+		}
+	}
+	if err := saveState(path, days); err != nil {
+		return nil, err
+	}
+
+	total := make(map[string]*stat, len(ss.stats))
+	for _, stats := range days {
+		mergeStats(total, stats)
+	}
+	return &stationStats{total}, nil
+}
+
+// loadState reads the per-day aggregates of previous runs. A missing state
+// file is the empty state of a first run.
+func loadState(path string) (map[string]map[string]*stat, error) {
+	days := make(map[string]map[string]*stat)
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return days, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not open state: %w", err)
+	}
+	defer f.Close()
+	days, err = decodeState(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode state %s: %w", path, err)
+	}
+	return days, nil
+}
+
+// saveState writes the per-day aggregates for the next run. The state is
+// written to a temporary file first, so an interrupted run leaves the previous
+// state whole.
+func saveState(path string, days map[string]map[string]*stat) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("could not create state: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if err := encodeState(f, days); err != nil {
+		f.Close()
+		return fmt.Errorf("could not encode state: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("could not write state: %w", err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("could not replace state: %w", err)
+	}
+	return nil
+}
+
+func fromPersisted(p map[string]persistedStat) map[string]*stat {
+	stats := make(map[string]*stat, len(p))
+	for k, v := range p {
+		stats[k] = &stat{
+			Min:   tenthsOf(v.Min),
+			Max:   tenthsOf(v.Max),
+			Sum:   tenthsOf(v.Sum),
+			Count: int64(v.Count),
+		}
+	}
+	return stats
+}
+
+// mergeStats adds the stats of src to dst without sharing any of them
+func mergeStats(dst, src map[string]*stat) {
+	for k, v := range src {
+		if val, ok := dst[k]; ok {
+			val.Merge(v)
+		} else {
+			c := *v
+			dst[k] = &c
+		}
+	}
+}
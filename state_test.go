@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvalState(t *testing.T) {
+	defer func(s string) { *statePath = s }(*statePath)
+	dir := t.TempDir()
+	*statePath = filepath.Join(dir, "state.bin")
+	day1 := filepath.Join(dir, "day1.txt")
+	day2 := filepath.Join(dir, "day2.txt")
+	require.NoError(t, os.WriteFile(day1, []byte("Hamburg;12.0\nOslo;-3.0\n"), 0o644))
+	require.NoError(t, os.WriteFile(day2, []byte("Hamburg;8.0\nAbha;30.1\n"), 0o644))
+
+	var out strings.Builder
+	require.NoError(t, eval(context.Background(), day1, &out))
+	assert.Equal(t, "{Hamburg=12.0/12.0/12.0, Oslo=-3.0/-3.0/-3.0}\n", out.String())
+
+	out.Reset()
+	require.NoError(t, eval(context.Background(), day2, &out))
+	assert.Equal(t,
+		"{Abha=30.1/30.1/30.1, Hamburg=8.0/10.0/12.0, Oslo=-3.0/-3.0/-3.0}\n",
+		out.String(),
+	)
+
+	days, err := loadState(*statePath)
+	require.NoError(t, err)
+	today := days[now().Format(dayLayout)]
+	assert.Equal(t, &stat{Min: 80, Max: 120, Sum: 200, Count: 2}, today["Hamburg"])
+}
+
+func TestLoadStateMissing(t *testing.T) {
+	days, err := loadState(filepath.Join(t.TempDir(), "state.bin"))
+	require.NoError(t, err)
+	assert.Empty(t, days)
+}
+
+func TestEvalStateRetain(t *testing.T) {
+	defer func(s string, r retention, n func() time.Time) {
+		*statePath, retain, now = s, r, n
+	}(*statePath, retain, now)
+	dir := t.TempDir()
+	*statePath = filepath.Join(dir, "state.bin")
+	require.NoError(t, retain.Set("2d"))
+	input := filepath.Join(dir, "input.txt")
+
+	day := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	for i, line := range []string{"Oslo;-3.0\n", "Oslo;1.0\n", "Oslo;5.0\n"} {
+		now = func() time.Time { return day.AddDate(0, 0, i) }
+		require.NoError(t, os.WriteFile(input, []byte(line), 0o644))
+		var out strings.Builder
+		require.NoError(t, eval(context.Background(), input, &out))
+		if i == 2 {
+			// The first day has aged out
+			assert.Equal(t, "{Oslo=1.0/3.0/5.0}\n", out.String())
+		}
+	}
+
+	days, err := loadState(*statePath)
+	require.NoError(t, err)
+	assert.Len(t, days, 2)
+	assert.Contains(t, days, "2024-06-03")
+}
+
+func TestRetentionSet(t *testing.T) {
+	var r retention
+	require.NoError(t, r.Set("30d"))
+	assert.Equal(t, 30*24*time.Hour, time.Duration(r))
+	assert.Equal(t, "30d", r.String())
+	require.NoError(t, r.Set("36h"))
+	assert.Equal(t, 36*time.Hour, time.Duration(r))
+	assert.Error(t, r.Set("xd"))
+}
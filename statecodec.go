@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// stateMagic starts every state file
+var stateMagic = [4]byte{'B', 'R', 'C', 'S'}
+
+// stateVersion is the version of the state format written
+const stateVersion = 3
+
+// Capabilities a state may need from its reader. Readers reject states with
+// capabilities they do not know, rather than misreading them.
+const (
+	// stateCapDays marks aggregates bucketed by day
+	stateCapDays uint32 = 1 << iota
+	// stateCapZstd marks a body compressed with zstd
+	stateCapZstd
+	// stateCapChecksum marks a CRC-32C of the body as stored in the header
+	stateCapChecksum
+	// stateCapEncrypted marks a body sealed with the at rest key
+	stateCapEncrypted
+)
+
+// stateKnownCaps are the capabilities this build can read
+const stateKnownCaps = stateCapDays | stateCapZstd | stateCapChecksum |
+	stateCapEncrypted
+
+// stateChecksumTable is the CRC-32C table state checksums are computed with
+var stateChecksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Encoders and decoders without concurrency for the state body, which is
+// compressed in one go
+var (
+	stateEncoder, _     = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+	stateDecoderZstd, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+)
+
+// The state format is little-endian on every architecture, so state files
+// move freely between machines:
+//
+//	magic   [4]byte "BRCS"
+//	version uint16
+//	caps    uint32 (since version 2)
+//	crc     uint32 CRC-32C of the rest of the file (with stateCapChecksum)
+//
+// The rest of the file is the body, compressed with zstd as a whole with
+// stateCapZstd, and then sealed with AES-256-GCM with stateCapEncrypted, the
+// magic, version and caps being authenticated along with it:
+//
+//	days    uint32, followed by each day as
+//	  day      uint16 length, bytes ("" for undated aggregates)
+//	  stations uint32, followed by each station as
+//	    name   uint16 length, bytes
+//	    min, max, sum, count int64, in tenths of a degree (since
+//	                         version 3, float64 degrees before)
+//
+// Days and stations are written in sorted order, so equal states encode to
+// equal bytes.
+
+// encodeState writes per-day aggregates in the state format
+func encodeState(w io.Writer, days map[string]map[string]*stat) error {
+	var body []byte
+	body = binary.LittleEndian.AppendUint32(body, uint32(len(days)))
+	for _, day := range sortedKeys(days) {
+		stats := days[day]
+		var err error
+		if body, err = appendString(body, day); err != nil {
+			return err
+		}
+		body = binary.LittleEndian.AppendUint32(body, uint32(len(stats)))
+		for _, station := range sortedKeys(stats) {
+			v := stats[station]
+			if body, err = appendString(body, station); err != nil {
+				return err
+			}
+			for _, n := range [...]int64{v.Min, v.Max, v.Sum, v.Count} {
+				body = binary.LittleEndian.AppendUint64(body, uint64(n))
+			}
+		}
+	}
+	body = stateEncoder.EncodeAll(body, nil)
+
+	caps := stateCapDays | stateCapZstd | stateCapChecksum
+	if atRestKey != nil {
+		caps |= stateCapEncrypted
+	}
+	head := stateHead(stateVersion, caps)
+	if atRestKey != nil {
+		var err error
+		if body, err = seal(atRestKey, body, head); err != nil {
+			return fmt.Errorf("could not encrypt state: %w", err)
+		}
+	}
+	head = binary.LittleEndian.AppendUint32(
+		head, crc32.Checksum(body, stateChecksumTable),
+	)
+	if _, err := w.Write(head); err != nil {
+		return err
+	}
+	_, err := w.Write(body)
+	return err
+}
+
+// stateHead returns the magic, version and caps starting a state
+func stateHead(version uint16, caps uint32) []byte {
+	head := append([]byte(nil), stateMagic[:]...)
+	head = binary.LittleEndian.AppendUint16(head, version)
+	return binary.LittleEndian.AppendUint32(head, caps)
+}
+
+// decodeState reads per-day aggregates in the state format. States of older
+// versions, down to those written with gob before the format existed, are
+// migrated as they are read.
+func decodeState(r io.Reader) (map[string]map[string]*stat, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(len(stateMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if !bytes.Equal(head, stateMagic[:]) {
+		return decodeGobState(br)
+	}
+	br.Discard(len(stateMagic))
+
+	d := stateDecoder{r: br}
+	var caps uint32
+	version := d.uint16()
+	switch {
+	case d.err != nil:
+		return nil, d.err
+	case version == 1:
+		// Version 1 had no capabilities but was always bucketed by day
+		caps = stateCapDays
+	case version >= 2 && version <= stateVersion:
+		caps = d.uint32()
+	default:
+		return nil, fmt.Errorf(
+			"unsupported state version %d, this build reads up to %d",
+			version, stateVersion,
+		)
+	}
+	if unknown := caps &^ stateKnownCaps; d.err == nil && unknown != 0 {
+		return nil, fmt.Errorf(
+			"state needs capabilities %#x this build does not support",
+			unknown,
+		)
+	}
+	if caps&(stateCapZstd|stateCapChecksum|stateCapEncrypted) != 0 {
+		var sum uint32
+		if caps&stateCapChecksum != 0 {
+			sum = d.uint32()
+		}
+		if d.err != nil {
+			return nil, d.err
+		}
+		body, err := io.ReadAll(br)
+		if err != nil {
+			return nil, err
+		}
+		if caps&stateCapChecksum != 0 &&
+			crc32.Checksum(body, stateChecksumTable) != sum {
+			return nil, errors.New("state is corrupt: checksum mismatch")
+		}
+		if caps&stateCapEncrypted != 0 {
+			if atRestKey == nil {
+				return nil, fmt.Errorf(
+					"state is encrypted, give its key with -key-file or %s",
+					atRestKeyEnv,
+				)
+			}
+			body, err = unseal(atRestKey, body, stateHead(version, caps))
+			if err != nil {
+				return nil, err
+			}
+		}
+		if caps&stateCapZstd != 0 {
+			if body, err = stateDecoderZstd.DecodeAll(body, nil); err != nil {
+				return nil, fmt.Errorf("could not decompress state: %w", err)
+			}
+		}
+		d.r = bytes.NewReader(body)
+	}
+
+	days := make(map[string]map[string]*stat)
+	for n := d.uint32(); n > 0 && d.err == nil; n-- {
+		day := d.string()
+		count := d.uint32()
+		stats := make(map[string]*stat, min(count, maxPreallocStations))
+		for ; count > 0 && d.err == nil; count-- {
+			station := d.string()
+			if version < 3 {
+				// Older versions held degrees, which are converted
+				stats[station] = &stat{
+					Min:   tenthsOf(d.float64()),
+					Max:   tenthsOf(d.float64()),
+					Sum:   tenthsOf(d.float64()),
+					Count: int64(d.float64()),
+				}
+				continue
+			}
+			stats[station] = &stat{
+				Min:   d.int64(),
+				Max:   d.int64(),
+				Sum:   d.int64(),
+				Count: d.int64(),
+			}
+		}
+		days[day] = stats
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return days, nil
+}
+
+// decodeGobState reads a state written with gob
+func decodeGobState(r io.Reader) (map[string]map[string]*stat, error) {
+	var st persistedState
+	if err := gob.NewDecoder(r).Decode(&st); err != nil {
+		return nil, fmt.Errorf("not a state file: %w", err)
+	}
+	days := make(map[string]map[string]*stat)
+	if len(st.Stats) > 0 {
+		days[""] = fromPersisted(st.Stats)
+	}
+	for day, stats := range st.Days {
+		days[day] = fromPersisted(stats)
+	}
+	return days, nil
+}
+
+// stateDecoder reads the fields of the state format, keeping the first error
+type stateDecoder struct {
+	r   io.Reader
+	buf [8]byte
+	err error
+}
+
+func (d *stateDecoder) read(n int) []byte {
+	if d.err != nil {
+		return d.buf[:n]
+	}
+	if _, err := io.ReadFull(d.r, d.buf[:n]); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		d.err = fmt.Errorf("truncated state: %w", err)
+	}
+	return d.buf[:n]
+}
+
+func (d *stateDecoder) uint16() uint16 {
+	return binary.LittleEndian.Uint16(d.read(2))
+}
+
+func (d *stateDecoder) uint32() uint32 {
+	return binary.LittleEndian.Uint32(d.read(4))
+}
+
+func (d *stateDecoder) int64() int64 {
+	return int64(binary.LittleEndian.Uint64(d.read(8)))
+}
+
+func (d *stateDecoder) float64() float64 {
+	return math.Float64frombits(binary.LittleEndian.Uint64(d.read(8)))
+}
+
+func (d *stateDecoder) string() string {
+	n := d.uint16()
+	if d.err != nil {
+		return ""
+	}
+	s := make([]byte, n)
+	if _, err := io.ReadFull(d.r, s); err != nil {
+		d.err = fmt.Errorf("truncated state: %w", io.ErrUnexpectedEOF)
+	}
+	return string(s)
+}
+
+// appendString appends a string with its uint16 length, failing for strings
+// too long for it rather than writing a state that cannot be read back
+func appendString(buf []byte, s string) ([]byte, error) {
+	if len(s) > math.MaxUint16 {
+		return nil, fmt.Errorf(
+			"cannot save a name of %d bytes to the state, at most %d",
+			len(s), math.MaxUint16,
+		)
+	}
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(s)))
+	return append(buf, s...), nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// State fixtures were encoded on amd64 and must decode identically everywhere
+const (
+	stateFixture     = "test/state/state-v2.bin"
+	stateFixtureZstd = "test/state/state-v2-zstd.bin"
+	stateFixtureV1   = "test/state/state-v1.bin"
+	stateFixtureV3   = "test/state/state-v3.bin"
+)
+
+func fixtureDays() map[string]map[string]*stat {
+	return map[string]map[string]*stat{
+		"": {
+			"Abha": {Min: -15, Max: 301, Sum: 12345, Count: 100},
+		},
+		"2024-06-01": {
+			"Hamburg": {Min: 80, Max: 120, Sum: 200, Count: 2},
+			"Oslo":    {Min: -30, Max: -30, Sum: -30, Count: 1},
+		},
+	}
+}
+
+func TestEncodeState(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, encodeState(&buf, fixtureDays()))
+	// The header is fixed, the compressed body may vary between versions
+	// of the compressor
+	assert.Equal(t,
+		[]byte{'B', 'R', 'C', 'S', 3, 0, 7, 0, 0, 0},
+		buf.Bytes()[:10],
+	)
+	days, err := decodeState(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, fixtureDays(), days)
+}
+
+func TestEncodeStateLongName(t *testing.T) {
+	days := fixtureDays()
+	days[""][strings.Repeat("x", 70*1024)] = &stat{Min: 1, Max: 1, Sum: 1, Count: 1}
+	var buf bytes.Buffer
+	err := encodeState(&buf, days)
+	assert.ErrorContains(t, err, "name of 71680 bytes")
+	assert.Zero(t, buf.Len())
+}
+
+func TestDecodeStateFixture(t *testing.T) {
+	// Version 2 held degrees as float64, version 3 tenths as int64
+	for _, fixture := range []string{
+		stateFixture, stateFixtureZstd, stateFixtureV3,
+	} {
+		f, err := os.Open(fixture)
+		require.NoError(t, err)
+		defer f.Close()
+		days, err := decodeState(f)
+		require.NoError(t, err, fixture)
+		assert.Equal(t, fixtureDays(), days, fixture)
+	}
+}
+
+func TestDecodeStateCorrupt(t *testing.T) {
+	data, err := os.ReadFile(stateFixtureZstd)
+	require.NoError(t, err)
+	data[len(data)-5] ^= 0xff
+	_, err = decodeState(bytes.NewReader(data))
+	assert.ErrorContains(t, err, "checksum mismatch")
+}
+
+func TestDecodeStateTruncated(t *testing.T) {
+	data, err := os.ReadFile(stateFixture)
+	require.NoError(t, err)
+	_, err = decodeState(bytes.NewReader(data[:len(data)-3]))
+	assert.ErrorContains(t, err, "truncated state")
+
+	data = append([]byte(nil), data...)
+	data[len(stateMagic)] = 99
+	_, err = decodeState(bytes.NewReader(data))
+	assert.ErrorContains(t, err, "unsupported state version 99")
+}
+
+func TestDecodeStateUnknownCaps(t *testing.T) {
+	data, err := os.ReadFile(stateFixture)
+	require.NoError(t, err)
+	data[len(stateMagic)+2+3] = 0x80
+	_, err = decodeState(bytes.NewReader(data))
+	assert.ErrorContains(t, err, "capabilities 0x80000000")
+}
+
+func TestDecodeStateV1(t *testing.T) {
+	f, err := os.Open(stateFixtureV1)
+	require.NoError(t, err)
+	defer f.Close()
+	days, err := decodeState(f)
+	require.NoError(t, err)
+	assert.Equal(t, fixtureDays(), days)
+}
+
+func TestDecodeGobState(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, gob.NewEncoder(&buf).Encode(persistedState{
+		Stats: map[string]persistedStat{
+			"Abha": {Min: -1.5, Max: 30.1, Sum: 1234.5, Count: 100},
+		},
+		Days: map[string]map[string]persistedStat{
+			"2024-06-01": {
+				"Hamburg": {Min: 8, Max: 12, Sum: 20, Count: 2},
+				"Oslo":    {Min: -3, Max: -3, Sum: -3, Count: 1},
+			},
+		},
+	}))
+	days, err := decodeState(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, fixtureDays(), days)
+}
+
+func TestEncodeStateEncrypted(t *testing.T) {
+	defer func(key []byte) { atRestKey = key }(atRestKey)
+	atRestKey = bytes.Repeat([]byte{7}, atRestKeySize)
+	var buf bytes.Buffer
+	require.NoError(t, encodeState(&buf, fixtureDays()))
+	assert.Equal(t,
+		[]byte{'B', 'R', 'C', 'S', 3, 0, 15, 0, 0, 0},
+		buf.Bytes()[:10],
+	)
+	days, err := decodeState(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, fixtureDays(), days)
+
+	atRestKey = bytes.Repeat([]byte{8}, atRestKeySize)
+	_, err = decodeState(bytes.NewReader(buf.Bytes()))
+	assert.ErrorContains(t, err, "wrong key")
+
+	atRestKey = nil
+	_, err = decodeState(bytes.NewReader(buf.Bytes()))
+	assert.ErrorContains(t, err, "state is encrypted")
+}
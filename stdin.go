@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// stdinInput is the input path standing for stdin. Stdin may be a pipe, so it
+// is always streamed, and read only once.
+const stdinInput = "-"
+
+// stdin buffers stdin so that its first bytes can be peeked at, to detect
+// compression and sample the input, without consuming them
+var stdin = sync.OnceValue(func() *bufio.Reader {
+	return bufio.NewReaderSize(os.Stdin, cardinalitySampleSize)
+})
+
+// peekStdin returns up to the first n bytes of stdin, leaving them to be read
+func peekStdin(n int) ([]byte, error) {
+	head, err := stdin().Peek(n)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("error reading stdin: %w", err)
+	}
+	return head, nil
+}
+
+// readsStdin reports whether stdin is among the inputs
+func readsStdin() bool {
+	for _, fpath := range inputPaths() {
+		if fpath == stdinInput {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvalStdin(t *testing.T) {
+	defer func(s func() *bufio.Reader) { stdin = s }(stdin)
+	inputFiles, err := findFiles(sampleInputDir, sampleInputExt)
+	require.NoError(t, err)
+	for _, file := range inputFiles {
+		data, err := os.ReadFile(file + sampleInputExt)
+		require.NoError(t, err)
+		expected, err := readFile(file + sampleOutputExt)
+		require.NoError(t, err)
+		for name, input := range map[string][]byte{
+			"plain": data, "gzip": compressGzip(t, data),
+		} {
+			// Stdin is only ever read through its buffer, so the test
+			// stands in for it there
+			r := bufio.NewReaderSize(bytes.NewReader(input), cardinalitySampleSize)
+			stdin = func() *bufio.Reader { return r }
+			var actual strings.Builder
+			require.NoError(
+				t, eval(context.Background(), stdinInput, &actual),
+				filepath.Base(file), name,
+			)
+			assert.Equal(t, expected, actual.String(), filepath.Base(file), name)
+		}
+	}
+}
+
+func TestStdinFlags(t *testing.T) {
+	defer func(in, s string) { *input, *strategy = in, s }(*input, *strategy)
+	*input = stdinInput
+	assert.True(t, readsStdin())
+	require.NoError(t, validateFlags())
+	*strategy = strategyReadAt
+	assert.ErrorContains(t, validateFlags(), "cannot be used with stdin")
+}
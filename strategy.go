@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// Strategies for getting the input into the workers
+const (
+	strategyAuto   = "auto"
+	strategyStream = "stream"
+	strategyMmap   = "mmap"
+	strategyReadAt = "readat"
+)
+
+var strategies = []string{
+	strategyAuto, strategyStream, strategyMmap, strategyReadAt,
+}
+
+// mmapMinSize is the smallest file worth mapping or reading in ranges; below
+// it the cost of setting up the mapping or the readers outweighs what they save
+const mmapMinSize = 256 * 1024 * 1024 // 256 MiB
+
+// Kinds of filesystem the input may live on
+const (
+	fsUnknown = "unknown"
+	fsMemory  = "memory"
+	fsLocal   = "local"
+	fsNetwork = "network"
+)
+
+// resolveStrategy returns the strategy requested, picking one based on the
+// input file and the machine if it is auto. Stdin is always streamed.
+func resolveStrategy(strategy string, fpath string) (string, error) {
+	if fpath == stdinInput {
+		return strategyStream, nil
+	}
+	if strategy != strategyAuto {
+		return strategy, nil
+	}
+	info, err := os.Stat(fpath)
+	if err != nil {
+		return "", fmt.Errorf("could not stat file: %w", err)
+	}
+	fs := filesystemKind(fpath)
+	if *remoteFS {
+		fs = fsNetwork
+	}
+	chosen := chooseStrategy(info.Size(), fs, totalMemory())
+	if chosen == strategyReadAt && *twoStage {
+		// Readat workers read their own ranges, with no chunks to split
+		// between parsers
+		chosen = strategyStream
+	}
+	return chosen, nil
+}
+
+// onRemoteFS reports whether the input is to be read as from a network
+// filesystem, either because -remote-fs is given or because it was detected
+func onRemoteFS(fpath string) bool {
+	return *remoteFS || filesystemKind(fpath) == fsNetwork
+}
+
+// chooseStrategy picks the fastest strategy given the input size, the kind of
+// filesystem it lives on and the total memory of the machine (0 if unknown)
+func chooseStrategy(size int64, fs string, memory int64) string {
+	switch {
+	case fs == fsNetwork:
+		// Page faults on network filesystems turn into tiny synchronous
+		// reads, so large sequential reads win
+		return strategyStream
+	case size < mmapMinSize:
+		if fs == fsMemory && mmapSupported {
+			// The file is already in memory, mapping it avoids any copy
+			return strategyMmap
+		}
+		return strategyStream
+	case !mmapSupported:
+		// Reading ranges in parallel is the next best thing to a mapping
+		return strategyReadAt
+	case fs == fsMemory:
+		return strategyMmap
+	case memory > 0 && size > memory:
+		// The mapping would thrash the page cache, while ranges read with
+		// ReadAt only hold a chunk per worker
+		if fs == fsLocal {
+			return strategyReadAt
+		}
+		return strategyStream
+	default:
+		return strategyMmap
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import "syscall"
+
+// Filesystem magic numbers from statfs(2)
+const (
+	tmpfsMagic  = 0x01021994
+	ramfsMagic  = 0x858458f6
+	nfsMagic    = 0x6969
+	smbMagic    = 0x517b
+	smb2Magic   = 0xfe534d42
+	cifsMagic   = 0xff534d42
+	fuseMagic   = 0x65735546
+	v9fsMagic   = 0x01021997
+	cephMagic   = 0x00c36400
+	afsMagic    = 0x5346414f
+	lustreMagic = 0x0bd00bd0
+	gpfsMagic   = 0x47504653
+)
+
+// filesystemKind reports what kind of filesystem a path lives on
+func filesystemKind(fpath string) string {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(fpath, &st); err != nil {
+		return fsUnknown
+	}
+	switch uint32(st.Type) {
+	case tmpfsMagic, ramfsMagic:
+		return fsMemory
+	case nfsMagic, smbMagic, smb2Magic, cifsMagic, v9fsMagic, cephMagic,
+		afsMagic, lustreMagic, gpfsMagic:
+		return fsNetwork
+	case fuseMagic:
+		// FUSE serves local filesystems such as ntfs-3g and gocryptfs as
+		// well as network ones such as sshfs, which -remote-fs is for
+		return fsUnknown
+	default:
+		return fsLocal
+	}
+}
+
+// totalMemory returns the total physical memory of the machine in bytes
+func totalMemory() int64 {
+	var info syscall.Sysinfo_t
+	if err := syscall.Sysinfo(&info); err != nil {
+		return 0
+	}
+	return int64(info.Totalram) * int64(info.Unit)
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+// filesystemKind is only detected on linux
+func filesystemKind(fpath string) string {
+	return fsUnknown
+}
+
+// totalMemory is only detected on linux
+func totalMemory() int64 {
+	return 0
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChooseStrategy(t *testing.T) {
+	if !mmapSupported {
+		t.Skip("mmap is not supported on this platform")
+	}
+	const gib = 1024 * 1024 * 1024
+	tests := []struct {
+		name   string
+		size   int64
+		fs     string
+		memory int64
+		want   string
+	}{
+		{"small local file", 1024, fsLocal, 16 * gib, strategyStream},
+		{"large local file", 13 * gib, fsLocal, 16 * gib, strategyMmap},
+		{"small file in memory", 1024, fsMemory, 16 * gib, strategyMmap},
+		{"network file", 13 * gib, fsNetwork, 16 * gib, strategyStream},
+		{"larger than memory", 13 * gib, fsLocal, 8 * gib, strategyReadAt},
+		{
+			"larger than memory on unknown fs", 13 * gib, fsUnknown, 8 * gib,
+			strategyStream,
+		},
+		{"unknown memory", 13 * gib, fsUnknown, 0, strategyMmap},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := chooseStrategy(tt.size, tt.fs, tt.memory)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
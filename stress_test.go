@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The stress tests run the pipeline with tiny chunks and many workers, so
+// that every hand over between goroutines happens thousands of times. They
+// are meant to be run with the race detector, see make test-race.
+
+func TestStressPipeline(t *testing.T) {
+	defer func(s, tm string, j, n int, d time.Duration) {
+		*strategy, *tableMode, *jobs = s, tm, j
+		chunkSize, *flushInterval = n, d
+	}(*strategy, *tableMode, *jobs, chunkSize, *flushInterval)
+	*jobs, chunkSize, *flushInterval = 16, 64, time.Nanosecond
+	for _, s := range []string{strategyStream, strategyMmap, strategyReadAt} {
+		for _, tm := range tables {
+			*strategy, *tableMode = s, tm
+			t.Run(s+"/"+tm, testSamples)
+		}
+	}
+}
+
+func TestStressCancel(t *testing.T) {
+	defer func(s string, j, n int) {
+		*strategy, *jobs, chunkSize = s, j, n
+	}(*strategy, *jobs, chunkSize)
+	*jobs, chunkSize = 16, 64
+	input := filepath.Join(sampleInputDir, "measurements-10000-unique-keys.txt")
+	for _, s := range []string{strategyStream, strategyMmap, strategyReadAt} {
+		*strategy = s
+		for _, after := range []time.Duration{0, time.Millisecond, 5 * time.Millisecond} {
+			t.Run(fmt.Sprintf("%s/%s", s, after), func(t *testing.T) {
+				ctx, cancel := context.WithTimeout(context.Background(), after)
+				defer cancel()
+				var out strings.Builder
+				// Either the run is done in time or it is canceled
+				// cleanly, without hanging or leaking goroutines
+				if err := eval(ctx, input, &out); err != nil {
+					assert.ErrorIs(t, err, context.DeadlineExceeded)
+					assert.Empty(t, out.String())
+				}
+			})
+		}
+	}
+}
+
+func TestStressSnapshotReads(t *testing.T) {
+	defer func(n int) { chunkSize = n }(chunkSize)
+	chunkSize = 64
+	input := filepath.Join(sampleInputDir, "measurements-10000-unique-keys")
+	expected, err := readFile(input + sampleOutputExt)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	chunkChan := make(chan []byte)
+	counts := &chunkCounts{}
+	table := newSharedTable()
+	go reader(ctx, input+sampleInputExt, chunkChan, counts)
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, worker(
+				ctx, chunkChan, nil, 0, nil, nil, counts, table,
+			))
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	// Snapshots taken while workers update the table only ever grow
+	seen := 0
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		ss := table.snapshot()
+		assert.GreaterOrEqual(t, len(ss.stats), seen)
+		seen = len(ss.stats)
+		for _, v := range ss.stats {
+			assert.LessOrEqual(t, v.Min, v.Max)
+			assert.Positive(t, v.Count)
+		}
+	}
+	require.NoError(t, counts.check())
+	var actual strings.Builder
+	format(table.snapshot(), &actual)
+	assert.Equal(t, expected, actual.String())
+}
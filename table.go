@@ -0,0 +1,146 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// Aggregation modes
+const (
+	// tableMerge has workers gather stats on their own and merges them
+	// once they are handed over
+	tableMerge = "merge"
+	// tableShared has workers update one shared table after every chunk,
+	// so results are visible while the run is going
+	tableShared = "shared"
+)
+
+var tables = []string{tableMerge, tableShared}
+
+// sharedTableShards is the number of independently locked shards of a shared
+// table, enough that workers rarely contend on the same one
+const sharedTableShards = 64
+
+// sharedTable is a station table that workers update concurrently. Stations
+// are spread over shards by hash, each with its own lock for adding new
+// stations. The stats of a station can be read at any time without blocking
+// the workers.
+type sharedTable struct {
+	shards [sharedTableShards]tableShard
+}
+
+type tableShard struct {
+	mu    sync.RWMutex
+	stats map[string]*seqStat
+	// Keep shards on separate cache lines
+	_ [32]byte
+}
+
+// seqStat is the stat of a station in a shared table. Writers take turns
+// through the mutex, while readers never lock: a sequence number is odd while
+// an update is in progress, so a reader that sees it change or odd retries
+// instead of returning a torn stat.
+type seqStat struct {
+	mu  sync.Mutex
+	seq atomic.Uint64
+	// The fields of the stat, with temperatures in tenths of a degree
+	min, max, sum, count atomic.Int64
+}
+
+// add merges a stat into the record
+func (s *seqStat) add(v *stat) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq.Add(1)
+	if s.count.Load() == 0 {
+		s.min.Store(v.Min)
+		s.max.Store(v.Max)
+	} else {
+		s.min.Store(min(s.min.Load(), v.Min))
+		s.max.Store(max(s.max.Load(), v.Max))
+	}
+	s.sum.Add(v.Sum)
+	s.count.Add(v.Count)
+	s.seq.Add(1)
+}
+
+// load returns a consistent copy of the record
+func (s *seqStat) load() stat {
+	for {
+		seq := s.seq.Load()
+		if seq&1 != 0 {
+			runtime.Gosched()
+			continue
+		}
+		v := stat{
+			Min:   s.min.Load(),
+			Max:   s.max.Load(),
+			Sum:   s.sum.Load(),
+			Count: s.count.Load(),
+		}
+		if s.seq.Load() == seq {
+			return v
+		}
+	}
+}
+
+func newSharedTable() *sharedTable {
+	t := &sharedTable{}
+	for i := range t.shards {
+		t.shards[i].stats = make(map[string]*seqStat)
+	}
+	return t
+}
+
+// add merges the stats of a worker into the table
+func (t *sharedTable) add(stats map[string]*stat) {
+	for k, v := range stats {
+		s := &t.shards[shardOf([]byte(k), sharedTableShards)]
+		s.mu.RLock()
+		rec := s.stats[k]
+		s.mu.RUnlock()
+		if rec == nil {
+			s.mu.Lock()
+			if rec = s.stats[k]; rec == nil {
+				// Fill in new records before they are published, so
+				// readers never see them empty
+				rec = &seqStat{}
+				rec.add(v)
+				s.stats[k] = rec
+				s.mu.Unlock()
+				continue
+			}
+			s.mu.Unlock()
+		}
+		rec.add(v)
+	}
+}
+
+// load returns a consistent copy of the stat of a station
+func (t *sharedTable) load(station string) (stat, bool) {
+	s := &t.shards[shardOf([]byte(station), sharedTableShards)]
+	s.mu.RLock()
+	rec := s.stats[station]
+	s.mu.RUnlock()
+	if rec == nil {
+		return stat{}, false
+	}
+	return rec.load(), true
+}
+
+// snapshot returns a copy of the table as it is now. Workers may keep
+// updating it meanwhile; each station is consistent on its own.
+func (t *sharedTable) snapshot() *stationStats {
+	stats := make(map[string]*stat)
+	for i := range t.shards {
+		s := &t.shards[i]
+		s.mu.RLock()
+		for k, rec := range s.stats {
+			v := rec.load()
+			stats[k] = &v
+		}
+		s.mu.RUnlock()
+	}
+	return &stationStats{stats}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSharedTable(t *testing.T) {
+	table := newSharedTable()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				table.add(map[string]*stat{
+					"Hamburg": {Min: -1, Max: 1, Sum: 0, Count: 2},
+					"Oslo":    {Min: 5, Max: 5, Sum: 5, Count: 1},
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	ss := table.snapshot()
+	assert.Len(t, ss.stats, 2)
+	assert.Equal(t, &stat{Min: -1, Max: 1, Sum: 0, Count: 1600}, ss.stats["Hamburg"])
+	assert.Equal(t, &stat{Min: 5, Max: 5, Sum: 4000, Count: 800}, ss.stats["Oslo"])
+}
+
+func TestSharedTableConsistentReads(t *testing.T) {
+	table := newSharedTable()
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10000; j++ {
+				table.add(map[string]*stat{
+					"Hamburg": {Min: -1, Max: 1, Sum: 3, Count: 1},
+				})
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	// Every update adds 3 to the sum and 1 to the count, so a torn read
+	// would break the ratio between them
+	for {
+		if v, ok := table.load("Hamburg"); ok {
+			assert.Equal(t, 3*v.Count, v.Sum)
+		}
+		select {
+		case <-done:
+			v, _ := table.load("Hamburg")
+			assert.Equal(t, stat{Min: -1, Max: 1, Sum: 120000, Count: 40000}, v)
+			return
+		default:
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// textSampleSize is the size of each block of the input sampled for NUL bytes
+const textSampleSize = 64 * 1024 // 64 KiB
+
+// textSampleBlocks is the number of blocks sampled, spread evenly over the
+// input so holes in sparse files are found wherever they are
+const textSampleBlocks = 8
+
+// maxNULDensity is the largest fraction of NUL bytes tolerated in the samples.
+// Measurements are plain text, so any real density means the input is binary
+// or has holes in it.
+const maxNULDensity = 0.01
+
+// checkText samples the input for NUL bytes and returns an error if it does
+// not look like text. Parsing binary data yields a station for nearly every
+// line and can use huge amounts of memory.
+func checkText(fpath string) error {
+	if *force {
+		return nil
+	}
+	if fpath == stdinInput {
+		// Only the start of stdin can be sampled without consuming it
+		head, err := peekStdin(textSampleSize)
+		if err != nil {
+			return err
+		}
+		return checkNULDensity(len(head), bytes.Count(head, []byte{0}))
+	}
+	// Only regular files can be read at offsets. Devices such as /dev/zero
+	// are sampled from the start, and pipes are not even opened since
+	// reading them would consume the input.
+	info, err := os.Stat(fpath)
+	if err != nil {
+		return fmt.Errorf("could not stat file: %w", err)
+	}
+	var offsets []int64
+	switch mode := info.Mode(); {
+	case mode.IsRegular():
+		offsets = sampleOffsets(info.Size())
+	case mode&os.ModeCharDevice != 0:
+		offsets = []int64{0}
+	default:
+		return nil
+	}
+	f, err := os.Open(fpath)
+	if err != nil {
+		return fmt.Errorf("could not open file: %w", err)
+	}
+	defer f.Close()
+
+	buf := make([]byte, textSampleSize)
+	var sampled, nuls int
+	for _, off := range offsets {
+		n, err := f.ReadAt(buf, off)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("error reading file: %w", err)
+		}
+		sampled += n
+		nuls += bytes.Count(buf[:n], []byte{0})
+	}
+	return checkNULDensity(sampled, nuls)
+}
+
+// checkNULDensity returns an error if there are too many NUL bytes among those
+// sampled for the input to be text
+func checkNULDensity(sampled, nuls int) error {
+	if sampled == 0 {
+		return nil
+	}
+	if density := float64(nuls) / float64(sampled); density > maxNULDensity {
+		return fmt.Errorf(
+			"input does not look like text: %.1f%% of sampled bytes are "+
+				"NUL; use -force to process it anyway",
+			density*100,
+		)
+	}
+	return nil
+}
+
+// sampleOffsets returns the offsets of the blocks sampled from a file of the
+// given size
+func sampleOffsets(size int64) []int64 {
+	if size <= textSampleSize*textSampleBlocks {
+		offsets := []int64{}
+		for off := int64(0); off < size; off += textSampleSize {
+			offsets = append(offsets, off)
+		}
+		return offsets
+	}
+	step := (size - textSampleSize) / (textSampleBlocks - 1)
+	offsets := make([]int64, textSampleBlocks)
+	for i := range offsets {
+		offsets[i] = int64(i) * step
+	}
+	return offsets
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckText(t *testing.T) {
+	defer func(b bool) { *force = b }(*force)
+	dir := t.TempDir()
+	text := filepath.Join(dir, "text.txt")
+	require.NoError(t, os.WriteFile(
+		text, []byte(strings.Repeat("Hamburg;12.0\n", 1000)), 0o644,
+	))
+	// A file that is all hole past its first line
+	sparse := filepath.Join(dir, "sparse.txt")
+	require.NoError(t, os.WriteFile(sparse, []byte("Hamburg;12.0\n"), 0o644))
+	require.NoError(t, os.Truncate(sparse, 1<<30))
+
+	*force = false
+	assert.NoError(t, checkText(text))
+	assert.ErrorContains(t, checkText(sparse), "use -force")
+	*force = true
+	assert.NoError(t, checkText(sparse))
+}
+
+func TestSampleOffsets(t *testing.T) {
+	assert.Empty(t, sampleOffsets(0))
+	assert.Equal(t, []int64{0, textSampleSize}, sampleOffsets(textSampleSize+1))
+	offsets := sampleOffsets(1 << 30)
+	assert.Len(t, offsets, textSampleBlocks)
+	assert.LessOrEqual(t, offsets[len(offsets)-1], int64(1<<30-textSampleSize))
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// tokenBucket limits a byte rate. Tokens accrue at the rate up to a burst
+// size; taking more tokens than are available puts the bucket in debt, which
+// is paid off by sleeping before the call returns.
+type tokenBucket struct {
+	rate   float64 // bytes per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket returns a full bucket for a rate given in megabits per second
+func newTokenBucket(mbps float64, burst int) *tokenBucket {
+	return &tokenBucket{
+		rate:   mbps * 1e6 / 8,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// wait takes n bytes worth of tokens, sleeping until the rate allows them or
+// the context is done
+func (b *tokenBucket) wait(ctx context.Context, n int) error {
+	now := time.Now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return nil
+	}
+	delay := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenBucket(t *testing.T) {
+	// 8 megabits per second is 1 MB per second
+	b := newTokenBucket(8, 100_000)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, b.wait(context.Background(), 100_000))
+	}
+	// The first 100 kB are the burst, the other 200 kB take 200 ms
+	assert.GreaterOrEqual(t, time.Since(start), 190*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, b.wait(ctx, 1_000_000), context.Canceled)
+}
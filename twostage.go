@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"runtime/debug"
+	"sync"
+
+	"github.com/aeolyus/1brc/brc/fastparse"
+	"github.com/aeolyus/1brc/internal/pipeline"
+)
+
+// recordBatch is a batch of parsed lines bound for one aggregator shard, the
+// station names packed one after the other
+type recordBatch struct {
+	names  []byte
+	ends   []int32
+	tenths []int16
+}
+
+// recordBatches recycles the batches merged by the aggregator shards, so that
+// parsers mostly refill buffers already grown to the size of a batch
+var recordBatches = sync.Pool{
+	New: func() any { return &recordBatch{} },
+}
+
+// newRecordBatch returns an empty batch, reusing a recycled one if any
+func newRecordBatch() *recordBatch {
+	b := recordBatches.Get().(*recordBatch)
+	b.names, b.ends, b.tenths = b.names[:0], b.ends[:0], b.tenths[:0]
+	return b
+}
+
+func (b *recordBatch) add(station []byte, tenths int16) {
+	b.names = append(b.names, station...)
+	b.ends = append(b.ends, int32(len(b.names)))
+	b.tenths = append(b.tenths, tenths)
+}
+
+// processTwoStage runs the pipeline with parsing and aggregation split into
+// stages of their own: parsers only tokenize chunks into batches of records,
+// and aggregator shards, each owning the stations that hash to it, look the
+// stations up and merge the records. It is an experiment to compare against
+// the fused workers of process, and supports none of their side outputs.
+func processTwoStage(
+	ctx context.Context,
+	stations int,
+	read pipeline.Producer[[]byte],
+	counts *chunkCounts,
+	workers int,
+) (*stationStats, error) {
+	shards := make([]chan *recordBatch, workers)
+	results := make([]map[string]*stat, workers)
+	var aggregate *stageMetrics
+	if counts.stages != nil {
+		aggregate = &counts.stages.aggregate
+	}
+	var wg sync.WaitGroup
+	for i := range shards {
+		shards[i] = make(chan *recordBatch, workers)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = aggregateShard(
+				shards[i], min(stations, maxPreallocStations)/workers,
+				aggregate,
+			)
+		}()
+	}
+
+	err := pipeline.Run(ctx, prefetchDepth, workers, read,
+		func(ctx context.Context, chunkChan <-chan []byte) error {
+			return parser(ctx, chunkChan, shards, counts)
+		},
+	)
+	for _, shard := range shards {
+		close(shard)
+	}
+	wg.Wait()
+	if err == nil {
+		err = counts.check()
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Shards own disjoint stations, so their results only need joining
+	stats := make(map[string]*stat, min(stations, maxPreallocStations))
+	for _, r := range results {
+		for k, v := range r {
+			stats[k] = v
+		}
+	}
+	return &stationStats{stats}, nil
+}
+
+// parser tokenizes chunks into batches of records for the aggregator shards,
+// routing each station by a hash of its name
+func parser(
+	ctx context.Context,
+	chunkChan <-chan []byte,
+	shards []chan *recordBatch,
+	counts *chunkCounts,
+) (err error) {
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer recoverWorker(&err)
+	var clock *stageClock
+	if counts.stages != nil {
+		clock = counts.stages.parse.clock()
+	}
+	batches := make([]*recordBatch, len(shards))
+	for i := range batches {
+		batches[i] = newRecordBatch()
+	}
+	send := func(i int) {
+		shards[i] <- batches[i]
+		batches[i] = newRecordBatch()
+	}
+	for {
+		clock.waiting()
+		chunk, ok := <-chunkChan
+		if !ok {
+			clock.done()
+			break
+		}
+		clock.working()
+		origin := counts.origin(chunk)
+		counts.received.Add(int64(len(chunk)))
+		if ctx.Err() != nil {
+			// Drain the remaining chunks without processing them
+			continue
+		}
+		start := len(chunk)
+		for len(chunk) > 0 {
+			pos := start - len(chunk)
+			station, value, rest := fastparse.ScanLine(chunk)
+			line := chunk[:len(chunk)-len(rest)]
+			chunk = rest
+			tenths, n := fastparse.ParseTempTenths(value)
+			if station == nil || n != len(value) {
+				// Malformed lines are skipped, but counted for -report
+				if counts.bad != nil {
+					counts.bad.add(
+						origin, pos, bytes.TrimSuffix(line, []byte{'\n'}),
+					)
+				}
+				continue
+			}
+			i := int(fnv1a(station) % uint64(len(shards)))
+			batches[i].add(station, tenths)
+			if len(batches[i].ends) >= *batchSize {
+				send(i)
+			}
+		}
+	}
+	for i, b := range batches {
+		if len(b.ends) > 0 {
+			shards[i] <- b
+		} else {
+			recordBatches.Put(b)
+		}
+	}
+	return nil
+}
+
+// aggregateShard merges the batches of records of one shard
+func aggregateShard(
+	batches <-chan *recordBatch, expected int, metrics *stageMetrics,
+) map[string]*stat {
+	stats := make(map[string]*stat, expected)
+	clock := metrics.clock()
+	for {
+		clock.waiting()
+		b, ok := <-batches
+		if !ok {
+			clock.done()
+			break
+		}
+		clock.working()
+		prev := int32(0)
+		for j, end := range b.ends {
+			station := b.names[prev:end]
+			prev = end
+			tenths := int64(b.tenths[j])
+			val, ok := stats[string(station)]
+			if !ok {
+				val = &stat{}
+				stats[string(station)] = val
+			}
+			val.Add(tenths)
+		}
+		recordBatches.Put(b)
+	}
+	return stats
+}
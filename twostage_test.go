@@ -0,0 +1,19 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestTwoStage(t *testing.T) {
+	defer func(b bool, n, j, size int) {
+		*twoStage, chunkSize, *jobs, *batchSize = b, n, j, size
+	}(*twoStage, chunkSize, *jobs, *batchSize)
+	*twoStage = true
+	chunkSize = 4096
+	for _, j := range []int{1, 3, 8} {
+		for _, size := range []int{1, 7, 4096} {
+			*jobs, *batchSize = j, size
+			t.Run("results", testSamples)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// usageExamples are printed above the flags in the usage
+const usageExamples = `Examples:
+  %[1]s -input measurements.txt
+  %[1]s -input measurements.txt -format json -output results.json
+  %[1]s -input data/ -recursive -ext .csv
+  %[1]s -state state.bin -input today.txt
+  zcat measurements.txt.gz | %[1]s
+`
+
+// inputFormat explains the input to those running the tool at a terminal
+// without one
+const inputFormat = `The input holds one measurement per line, as <station>;<temperature> with
+temperatures from -99.9 to 99.9 and exactly one decimal, e.g.
+
+  Hamburg;12.0
+  Bulawayo;8.9
+  St. John's;-4.2
+
+Generate some with: go run ./cmd/generate -rows 1000000 -out measurements.txt
+`
+
+func init() {
+	flag.Usage = func() {
+		printUsage(flag.CommandLine)
+	}
+}
+
+// printUsage prints how to invoke the tool, examples and its flags
+func printUsage(fs *flag.FlagSet) {
+	w := fs.Output()
+	name := filepath.Base(fs.Name())
+	fmt.Fprintf(w, "Usage: %s [flags] [-input] FILE...\n", name)
+	fmt.Fprintf(w, "       command | %s [flags]\n\n", name)
+	fmt.Fprintf(w, usageExamples, name)
+	fmt.Fprintln(w, "\nFlags:")
+	printDefaults(fs)
+}
+
+// missingInput prints the usage for a run given no input at a terminal,
+// explaining the input format too since the tool is likely new to whoever
+// runs it that way
+func missingInput(fs *flag.FlagSet) {
+	w := fs.Output()
+	fmt.Fprintln(w, "no input given")
+	fmt.Fprintln(w)
+	fmt.Fprint(w, inputFormat)
+	fmt.Fprintln(w)
+	printUsage(fs)
+}
+
+// isTerminal reports whether a file is a terminal rather than a pipe or a
+// regular file
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
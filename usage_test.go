@@ -0,0 +1,25 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMissingInput(t *testing.T) {
+	fs := flag.NewFlagSet("1brc", flag.ContinueOnError)
+	fs.String("input", "", "input file path")
+	fs.Int("chaos-drop-chunk", 0, "drop every nth chunk handed out")
+	var out strings.Builder
+	fs.SetOutput(&out)
+	missingInput(fs)
+	usage := out.String()
+	assert.True(t, strings.HasPrefix(usage, "no input given\n"))
+	assert.Contains(t, usage, "Hamburg;12.0")
+	assert.Contains(t, usage, "Usage: 1brc [flags] [-input] FILE...")
+	assert.Contains(t, usage, "  1brc -input measurements.txt\n")
+	assert.Contains(t, usage, "-input string")
+	assert.NotContains(t, usage, "chaos")
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+)
+
+// buildInfo identifies the exact build of the binary
+type buildInfo struct {
+	Module    string `json:"module"`
+	Version   string `json:"version"`
+	Revision  string `json:"revision,omitempty"`
+	Time      string `json:"time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"go_version"`
+	Tags      string `json:"tags,omitempty"`
+}
+
+// readBuildInfo reads the build information embedded in the binary
+func readBuildInfo() buildInfo {
+	b := buildInfo{Version: "(unknown)", GoVersion: runtime.Version()}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return b
+	}
+	b.Module = info.Main.Path
+	b.Version = info.Main.Version
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			b.Revision = s.Value
+		case "vcs.time":
+			b.Time = s.Value
+		case "vcs.modified":
+			b.Modified = s.Value == "true"
+		case "-tags":
+			b.Tags = s.Value
+		}
+	}
+	return b
+}
+
+// write prints the build information in a human readable form
+func (b buildInfo) write(w io.Writer) {
+	fmt.Fprintf(w, "%s %s\n", b.Module, b.Version)
+	if b.Revision != "" {
+		modified := ""
+		if b.Modified {
+			modified = " (modified)"
+		}
+		fmt.Fprintf(w, "revision: %s%s %s\n", b.Revision, modified, b.Time)
+	}
+	fmt.Fprintf(w, "go: %s %s/%s\n", b.GoVersion, runtime.GOOS, runtime.GOARCH)
+	tags := b.Tags
+	if tags == "" {
+		tags = "none"
+	}
+	fmt.Fprintf(w, "tags: %s\n", tags)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"runtime/debug"
+	"runtime/metrics"
+	"sync/atomic"
+	"time"
+)
+
+// Fractions of -memlimit at which the watchdog steps in: first the run slows
+// down to hold fewer chunks, and then the in-memory aggregation is abandoned
+const (
+	memDegradeFraction = 0.75
+	memAbortFraction   = 0.9
+)
+
+// memPollInterval is how often the watchdog samples the heap
+const memPollInterval = 50 * time.Millisecond
+
+// heapMetric is the runtime metric of the memory held by live and not yet
+// swept heap objects
+const heapMetric = "/memory/classes/heap/objects:bytes"
+
+// errMemoryLimit is the error of a run abandoned for nearing -memlimit
+var errMemoryLimit = errors.New("heap neared -memlimit")
+
+// watchdog samples the heap while a run is in progress and degrades it
+// gracefully as the heap nears the memory limit, rather than leaving it to
+// the OOM killer
+type watchdog struct {
+	limit    int64
+	degraded atomic.Bool
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// startWatchdog starts watching the heap against the limit, calling abort
+// once it is nearly reached. It also has the garbage collector work harder
+// as the heap nears the limit.
+func startWatchdog(limit int64, abort func()) *watchdog {
+	debug.SetMemoryLimit(limit)
+	w := &watchdog{
+		limit: limit,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go w.run(abort)
+	return w
+}
+
+func (w *watchdog) run(abort func()) {
+	defer close(w.done)
+	sample := []metrics.Sample{{Name: heapMetric}}
+	ticker := time.NewTicker(memPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+		metrics.Read(sample)
+		heap := float64(sample[0].Value.Uint64())
+		if heap >= memAbortFraction*float64(w.limit) {
+			abort()
+			return
+		}
+		if heap >= memDegradeFraction*float64(w.limit) &&
+			!w.degraded.Swap(true) {
+			log.Printf(
+				"heap at %.0f%% of -memlimit, prefetching no more chunks",
+				100*heap/float64(w.limit),
+			)
+			// Give back what the collector freed so far, so that the
+			// memory of the process reflects the heap
+			debug.FreeOSMemory()
+		}
+	}
+}
+
+// close stops watching the heap
+func (w *watchdog) close() {
+	close(w.stop)
+	<-w.done
+}
+
+// throttle waits until the workers have taken every chunk already handed out
+// if the run is degraded, so that no chunks are held in the queue beyond the
+// one about to be sent
+func (w *watchdog) throttle(ctx context.Context, chunkChan chan<- []byte) error {
+	if w == nil || !w.degraded.Load() {
+		return nil
+	}
+	for len(chunkChan) > 0 {
+		select {
+		case <-time.After(time.Millisecond):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// canSpill reports whether a run abandoned for nearing -memlimit can be redone
+// through spill files, which only aggregate a single input without any of the
+// extras of a run in memory
+func canSpill(fpaths []string) bool {
+	return len(fpaths) == 1 && fpaths[0] != stdinInput && *sqlQuery == "" &&
+		!*perFileFlag && len(extractStations) == 0 && *cleanOut == "" &&
+		*sampleOut == "" && *normalizeOut == "" && *rejectOut == "" &&
+		!*dedupeFlag && *statePath == "" && *outputFormat == formatBrc &&
+		*explodeDir == "" &&
+		*sortBy == colStation && !*noSort
+}
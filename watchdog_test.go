@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchdog(t *testing.T) {
+	defer debug.SetMemoryLimit(debug.SetMemoryLimit(-1))
+	aborted := make(chan struct{})
+	w := startWatchdog(1, func() { close(aborted) })
+	defer w.close()
+	select {
+	case <-aborted:
+	case <-time.After(time.Second):
+		t.Fatal("watchdog did not abort over the limit")
+	}
+
+	// Far below the limit, nothing happens
+	w = startWatchdog(1<<50, func() { t.Error("aborted under the limit") })
+	time.Sleep(2 * memPollInterval)
+	assert.False(t, w.degraded.Load())
+	w.close()
+}
+
+func TestEvalMemLimitSpills(t *testing.T) {
+	defer debug.SetMemoryLimit(debug.SetMemoryLimit(-1))
+	defer func(n int64, d time.Duration, c int) {
+		*memLimit, *chaosSlowReader, chunkSize = n, d, c
+	}(*memLimit, *chaosSlowReader, chunkSize)
+	input := filepath.Join(sampleInputDir, "measurements-10000-unique-keys")
+	expected, err := readFile(input + sampleOutputExt)
+	require.NoError(t, err)
+
+	// Slow the run down so the watchdog sees it over the limit before it
+	// is done, and have it redone through spill files
+	*memLimit = 1
+	*chaosSlowReader = 5 * time.Millisecond
+	chunkSize = 4096
+	var out strings.Builder
+	require.NoError(t, eval(context.Background(), input+sampleInputExt, &out))
+	assert.Equal(t, expected, out.String())
+
+	// Malformed lines are skipped when spilling as they are in memory
+	data, err := os.ReadFile(input + sampleInputExt)
+	require.NoError(t, err)
+	bad := filepath.Join(t.TempDir(), "bad.txt")
+	data = append([]byte("no separator\n"), data...)
+	require.NoError(t, os.WriteFile(bad, data, 0o644))
+	out.Reset()
+	require.NoError(t, eval(context.Background(), bad, &out))
+	assert.Equal(t, expected, out.String())
+}
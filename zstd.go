@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Magic numbers of the zstd seekable format, whose seek table is a skippable
+// frame at the end of the file listing the size of every frame before it
+const (
+	zstdSkippableMagic = 0x184D2A5E
+	zstdSeekableMagic  = 0x8F92EAB1
+	// zstdSeekFooterSize is the size of the footer ending the seek table:
+	// the number of frames, a descriptor and the seekable magic
+	zstdSeekFooterSize = 9
+	// zstdSeekChecksumFlag marks seek table entries with a checksum
+	zstdSeekChecksumFlag = 1 << 7
+)
+
+// zstdMaxSeekFrames bounds the number of frames a seek table may list, so a
+// corrupt footer does not allocate an absurd table
+const zstdMaxSeekFrames = 1 << 24
+
+// blockDecoderZstd decompresses the frames of seekable zstd files, which may
+// be used concurrently
+var blockDecoderZstd, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+
+// zstdDecoder decodes zstd files, in parallel if they are in the seekable
+// format
+type zstdDecoder struct{}
+
+func init() {
+	registerDecoder(zstdDecoder{}, []byte{0x28, 0xb5, 0x2f, 0xfd}, ".zst")
+}
+
+func (zstdDecoder) name() string { return "zstd" }
+
+func (zstdDecoder) newReader(r io.Reader) (io.ReadCloser, error) {
+	d, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return d.IOReadCloser(), nil
+}
+
+func (zstdDecoder) blocks(
+	fpath string, f io.ReaderAt, size int64,
+) ([]block, error) {
+	if size < zstdSeekFooterSize {
+		return nil, nil
+	}
+	footer := make([]byte, zstdSeekFooterSize)
+	if _, err := f.ReadAt(footer, size-zstdSeekFooterSize); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(footer[5:]) != zstdSeekableMagic {
+		return nil, nil
+	}
+	frames := int64(binary.LittleEndian.Uint32(footer))
+	if frames > zstdMaxSeekFrames {
+		return nil, fmt.Errorf("seek table lists %d frames", frames)
+	}
+	entrySize := int64(8)
+	if footer[4]&zstdSeekChecksumFlag != 0 {
+		entrySize = 12
+	}
+	tableSize := frames*entrySize + zstdSeekFooterSize
+	// The seek table is preceded by the header of its skippable frame
+	start := size - tableSize - 8
+	if start < 0 {
+		return nil, errors.New("seek table is larger than the file")
+	}
+	table := make([]byte, tableSize+8)
+	if _, err := f.ReadAt(table, start); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(table) != zstdSkippableMagic ||
+		int64(binary.LittleEndian.Uint32(table[4:])) != tableSize {
+		return nil, errors.New("seek table frame is corrupt")
+	}
+	blocks := make([]block, frames)
+	var offset int64
+	for i := range blocks {
+		entry := table[8+int64(i)*entrySize:]
+		blocks[i] = block{
+			offset: offset,
+			size:   int64(binary.LittleEndian.Uint32(entry)),
+		}
+		offset += blocks[i].size
+	}
+	if offset != start {
+		return nil, fmt.Errorf(
+			"seek table covers %d bytes of frames, the file has %d",
+			offset, start,
+		)
+	}
+	return blocks, nil
+}
+
+func (zstdDecoder) decodeBlock(src []byte) ([]byte, error) {
+	return blockDecoderZstd.DecodeAll(src, nil)
+}